@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"fmt"
+	"gomonkey/evaluator"
+	"gomonkey/token"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota + 1
+	SeverityWarning
+	SeverityHint
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "hint"
+	}
+}
+
+// Diagnostic は lint が見つけた問題1個
+type Diagnostic struct {
+	Pos      token.Position
+	Length   int // 波線を引く長さ(バイト数)
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Message)
+}
+
+// knownBuiltins は lint で「定義されてない」と言わない組み込み関数。
+// fs / os / time は実行時に許可されるかわからないけど、書けること自体は正しいので全部入れておく。
+var knownBuiltins = func() *evaluator.Registry {
+	r := evaluator.DefaultRegistry()
+	r.Grant(nil, evaluator.Capabilities...)
+	return r
+}()
+
+// Lint は実行しなくてもわかる問題を探す。今見ているのは
+//   - 定義されていない名前の参照(組み込み関数は除く)
+//   - 関数の中で let したのに使っていない名前
+//
+// の2つ。引数が使われていないのはコールバックとかでよくあるので言わない。
+func Lint(info *Info) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for _, ident := range info.Unresolved {
+		if IsBuiltin(ident.Value) {
+			continue
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Pos:      ident.Token.Pos,
+			Length:   len(ident.Value),
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("undefined: %s", ident.Value),
+		})
+	}
+
+	for _, binding := range info.Bindings {
+		// トップレベルの let はスクリプトの「結果」だったり REPL で使ったりするので言わない。_ 始まりはわざと使わないやつ
+		if binding.Kind != LetBinding || binding.TopLevel || len(binding.References) > 0 || binding.Name.Value[0] == '_' {
+			continue
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Pos:      binding.Name.Token.Pos,
+			Length:   len(binding.Name.Value),
+			Severity: SeverityHint,
+			Message:  fmt.Sprintf("%s declared but not used", binding.Name.Value),
+		})
+	}
+
+	sortDiagnostics(diagnostics)
+
+	return diagnostics
+}
+
+func sortDiagnostics(diagnostics []Diagnostic) {
+	// 挿入ソートで十分(lint の結果はそんなに多くならない)。位置が同じなら元の順番のまま
+	for i := 1; i < len(diagnostics); i++ {
+		for j := i; j > 0 && before(diagnostics[j].Pos, diagnostics[j-1].Pos); j-- {
+			diagnostics[j], diagnostics[j-1] = diagnostics[j-1], diagnostics[j]
+		}
+	}
+}
+
+// IsBuiltin は name が組み込み関数か
+func IsBuiltin(name string) bool {
+	_, ok := knownBuiltins.Lookup(name)
+	return ok
+}
@@ -0,0 +1,189 @@
+package analysis
+
+import (
+	"gomonkey/ast"
+	"gomonkey/token"
+)
+
+type BindingKind int
+
+const (
+	LetBinding       BindingKind = iota // let x = ...
+	ParameterBinding                    // fn(x) { ... } や macro(x) { ... } の引数
+)
+
+func (k BindingKind) String() string {
+	if k == ParameterBinding {
+		return "parameter"
+	}
+	return "let"
+}
+
+// Binding は名前を1回束縛したところ。同じ名前でも let し直したら別の Binding になる。
+type Binding struct {
+	Name       *ast.Identifier
+	Kind       BindingKind
+	Decl       ast.Node          // let なら *ast.LetStatement、引数なら *ast.FunctionLiteral か *ast.MacroLiteral
+	References []*ast.Identifier // この束縛を指している識別子(定義の Name 自身は入らない)
+	TopLevel   bool              // プログラムの一番外側の束縛か
+}
+
+// Info は Resolve の結果
+type Info struct {
+	Bindings   []*Binding                   // 見つけた順(let の名前は右辺の後なので、右辺の関数の引数のほうが先)
+	Uses       map[*ast.Identifier]*Binding // 識別子 → 束縛。定義の Name も参照も両方入っている
+	Unresolved []*ast.Identifier            // どの束縛も指していない識別子(組み込み関数もここに入る)
+	idents     []*ast.Identifier            // IdentifierAt 用に、出てきた識別子を全部
+}
+
+// IdentifierAt は pos の位置にある識別子を返す。なければ nil。
+// 識別子は1行に収まっているので、同じ行で Column が [先頭, 先頭+長さ) に入っているかを見る。
+func (info *Info) IdentifierAt(pos token.Position) *ast.Identifier {
+	for _, ident := range info.idents {
+		start := ident.Token.Pos
+		if start.Line == pos.Line && start.Column <= pos.Column && pos.Column < start.Column+len(ident.Value) {
+			return ident
+		}
+	}
+
+	return nil
+}
+
+// Resolve はプログラムの識別子がどの let や引数を指しているかを調べる。evaluator の環境と同じ考え方で、
+//   - スコープを作るのはプログラム全体と、関数・マクロリテラルだけ(if のブロックは外側と同じ環境)
+//   - 同じスコープの中では、その時点までに let されたもののうち一番最後のもの
+//   - 関数の本体は呼ばれたときに評価されるので、外側のスコープの名前は「外側を最後まで見てから」探す。
+//     そのとき、参照より前に定義されたものがあればその一番最後、なければ後ろで最初に定義されたもの
+//     (let f = fn() { f() } の再帰とか、後ろで定義される関数を呼ぶのとか)
+func Resolve(program *ast.Program) *Info {
+	r := &resolver{info: &Info{Uses: make(map[*ast.Identifier]*Binding)}}
+
+	global := &scope{}
+	r.visit(program, global)
+	r.finish(global)
+
+	return r.info
+}
+
+type scope struct {
+	parent   *scope
+	bindings []*Binding
+	deferred []func() // このスコープを見終わってから見る関数の本体
+}
+
+type resolver struct {
+	info *Info
+}
+
+func (r *resolver) visit(node ast.Node, sc *scope) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			// let x = x は右辺を先に評価するので、右辺の x は前の x
+			if node.Value != nil {
+				r.visit(node.Value, sc)
+			}
+			if node.Name != nil {
+				r.declare(sc, node.Name, LetBinding, node)
+			}
+			return false
+
+		case *ast.FunctionLiteral:
+			r.visitFunction(node, node.Parameters, node.Body, sc)
+			return false
+
+		case *ast.MacroLiteral:
+			r.visitFunction(node, node.Parameters, node.Body, sc)
+			return false
+
+		case *ast.Identifier:
+			r.resolve(node, sc)
+			return false
+		}
+
+		return true
+	})
+}
+
+func (r *resolver) visitFunction(fn ast.Node, parameters []*ast.Identifier, body *ast.BlockStatement, sc *scope) {
+	fnScope := &scope{parent: sc}
+	for _, param := range parameters {
+		if param != nil {
+			r.declare(fnScope, param, ParameterBinding, fn)
+		}
+	}
+
+	sc.deferred = append(sc.deferred, func() {
+		if body != nil {
+			r.visit(body, fnScope)
+		}
+		r.finish(fnScope)
+	})
+}
+
+func (r *resolver) finish(sc *scope) {
+	for _, visitBody := range sc.deferred {
+		visitBody()
+	}
+}
+
+func (r *resolver) declare(sc *scope, name *ast.Identifier, kind BindingKind, decl ast.Node) {
+	binding := &Binding{Name: name, Kind: kind, Decl: decl, TopLevel: sc.parent == nil}
+
+	sc.bindings = append(sc.bindings, binding)
+	r.info.Bindings = append(r.info.Bindings, binding)
+	r.info.Uses[name] = binding
+	r.info.idents = append(r.info.idents, name)
+}
+
+func (r *resolver) resolve(ident *ast.Identifier, sc *scope) {
+	r.info.idents = append(r.info.idents, ident)
+
+	binding := lastBinding(sc.bindings, ident.Value)
+	for outer := sc.parent; binding == nil && outer != nil; outer = outer.parent {
+		binding = nearestBinding(outer.bindings, ident.Value, ident.Token.Pos)
+	}
+
+	if binding == nil {
+		r.info.Unresolved = append(r.info.Unresolved, ident)
+		return
+	}
+
+	binding.References = append(binding.References, ident)
+	r.info.Uses[ident] = binding
+}
+
+func lastBinding(bindings []*Binding, name string) *Binding {
+	for i := len(bindings) - 1; i >= 0; i-- {
+		if bindings[i].Name.Value == name {
+			return bindings[i]
+		}
+	}
+
+	return nil
+}
+
+// nearestBinding は pos より前の一番最後の束縛、なければ pos より後ろの最初の束縛を返す
+func nearestBinding(bindings []*Binding, name string, pos token.Position) *Binding {
+	var after *Binding
+
+	for i := len(bindings) - 1; i >= 0; i-- {
+		b := bindings[i]
+		if b.Name.Value != name {
+			continue
+		}
+		if before(b.Name.Token.Pos, pos) {
+			return b
+		}
+		after = b
+	}
+
+	return after
+}
+
+func before(a, b token.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
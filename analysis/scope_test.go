@@ -0,0 +1,131 @@
+package analysis_test
+
+import (
+	"gomonkey/analysis"
+	"gomonkey/ast"
+	"gomonkey/lexer"
+	"gomonkey/parser"
+	"gomonkey/token"
+	"testing"
+)
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("パースエラー: %v", p.Errors())
+	}
+
+	return program
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	// ref は参照している識別子の位置、def はそれが指しているはずの定義の位置(なければ定義なし)
+	tests := []struct {
+		name  string
+		input string
+		ref   token.Position
+		def   token.Position
+	}{
+		{"let", "let x = 1;\nx;", token.Position{Line: 2, Column: 1}, token.Position{Line: 1, Column: 5}},
+		{"引数", "let f = fn(a, b) { a + b };", token.Position{Line: 1, Column: 24}, token.Position{Line: 1, Column: 15}},
+		{"let し直し", "let x = 1;\nlet x = 2;\nx;", token.Position{Line: 3, Column: 1}, token.Position{Line: 2, Column: 5}},
+		{"let x = x の右辺は前の x", "let x = 1;\nlet x = x + 1;", token.Position{Line: 2, Column: 9}, token.Position{Line: 1, Column: 5}},
+		{"再帰", "let f = fn(n) { f(n - 1) };", token.Position{Line: 1, Column: 17}, token.Position{Line: 1, Column: 5}},
+		{"後ろで定義される関数", "let f = fn() { g() };\nlet g = fn() { 1 };", token.Position{Line: 1, Column: 16}, token.Position{Line: 2, Column: 5}},
+		{"引数が外側の名前を隠す", "let x = 1;\nlet f = fn(x) { x };", token.Position{Line: 2, Column: 17}, token.Position{Line: 2, Column: 12}},
+		{"if のブロックは同じスコープ", "let f = fn() { if (true) { let y = 1; } y };", token.Position{Line: 1, Column: 41}, token.Position{Line: 1, Column: 32}},
+		{"関数の中の let は外から見えない", "let f = fn() { let y = 1; };\ny;", token.Position{Line: 2, Column: 1}, token.Position{}},
+		{"定義より前の参照", "x;\nlet x = 1;", token.Position{Line: 1, Column: 1}, token.Position{}},
+		{"マクロの引数", "let m = macro(a) { quote(unquote(a)) };", token.Position{Line: 1, Column: 34}, token.Position{Line: 1, Column: 15}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			info := analysis.Resolve(parseProgram(t, tt.input))
+
+			ref := info.IdentifierAt(tt.ref)
+			if ref == nil {
+				t.Fatalf("%s に識別子がないよ", tt.ref)
+			}
+
+			binding := info.Uses[ref]
+			if !tt.def.IsValid() {
+				if binding != nil {
+					t.Errorf("定義なしのはずなのに %s を指してるよ", binding.Name.Token.Pos)
+				}
+				return
+			}
+
+			if binding == nil {
+				t.Fatalf("%s の %s が定義を指してないよ", tt.ref, ref.Value)
+			}
+			if binding.Name.Token.Pos != tt.def {
+				t.Errorf("%s を指してほしいけど、%s を指してるよ", tt.def, binding.Name.Token.Pos)
+			}
+		})
+	}
+}
+
+func TestResolveReferences(t *testing.T) {
+	t.Parallel()
+
+	info := analysis.Resolve(parseProgram(t, "let x = 1;\nlet f = fn(y) { x + y };\nf(x);\nlet x = 2;"))
+
+	if len(info.Bindings) != 4 {
+		t.Fatalf("束縛は4個のはず。got=%d", len(info.Bindings))
+	}
+
+	first := info.Bindings[0]
+	if first.Kind != analysis.LetBinding || !first.TopLevel {
+		t.Errorf("最初の x はトップレベルの let のはず。got=%s, TopLevel=%t", first.Kind, first.TopLevel)
+	}
+	if len(first.References) != 2 {
+		t.Errorf("最初の x は2回参照されてるはず。got=%d", len(first.References))
+	}
+
+	// let f の右辺を先に見るので、f より引数の y が先
+	y := info.Bindings[1]
+	if y.Name.Value != "y" || y.Kind != analysis.ParameterBinding || y.TopLevel {
+		t.Errorf("2番目は引数の y のはず。got=%s (%s)", y.Name.Value, y.Kind)
+	}
+
+	if last := info.Bindings[3]; len(last.References) != 0 {
+		t.Errorf("最後の x は誰にも参照されてないはず。got=%d", len(last.References))
+	}
+}
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	input := `let f = fn(unused) {
+	let tmp = 1;
+	let _ignored = 2;
+	puts(nope, len([]), math.sqrt(4), fs.exists("x"));
+	macroexpand(quote(1));
+};
+let top = 1;`
+
+	diagnostics := analysis.Lint(analysis.Resolve(parseProgram(t, input)))
+
+	expected := []string{
+		"2:6: hint: tmp declared but not used",
+		"4:7: warning: undefined: nope",
+	}
+
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("診断は %d 個のはず。got=%v", len(expected), diagnostics)
+	}
+	for i, diag := range diagnostics {
+		if diag.String() != expected[i] {
+			t.Errorf("diagnostics[%d] が %q じゃないよ。got=%q", i, expected[i], diag.String())
+		}
+	}
+}
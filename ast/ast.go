@@ -3,6 +3,7 @@ package ast
 import (
 	"fmt"
 	"gomonkey/token"
+	"math/big"
 	"strings"
 )
 
@@ -147,8 +148,9 @@ func (es *ExpressionStatement) TokenLiteral() string {
 }
 
 type IntegerLiteral struct {
-	Token token.Token // token.INT
-	Value int64
+	Token    token.Token // token.INT
+	Value    int64
+	BigValue *big.Int // int64 に収まらないリテラルのときだけ入る(そのとき Value は 0)
 }
 
 func (il *IntegerLiteral) expressionNode() {
@@ -450,10 +452,10 @@ func (hl *HashLiteral) String() string {
 	// {"foo": "bar", "bob": "tom", }
 	var out strings.Builder
 
+	// マップをそのまま range すると毎回順番が変わるので、Walk と同じ順番に並べる
 	var pairs []string
-	for key, value := range hl.Pairs {
-		// pairs = append(pairs, key.String()+":"+value.String())
-		pairs = append(pairs, fmt.Sprintf("%s: %s", key.String(), value.String()))
+	for _, key := range sortedHashKeys(hl) {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", key.String(), hl.Pairs[key].String()))
 	}
 
 	out.WriteString("{")
@@ -496,3 +498,110 @@ func (ml *MacroLiteral) String() string {
 
 	return out.String()
 }
+
+// SliceExpression
+//
+//	<expression>[<start>:<end>]
+//
+// Start と End は省略できる(nil になる)。 arr[:2] とか arr[1:] とか。
+type SliceExpression struct {
+	Token token.Token // '['
+	Left  Expression
+	Start Expression // 省略されたら nil
+	End   Expression // 省略されたら nil
+}
+
+func (se *SliceExpression) expressionNode() {
+	panic("implement me")
+}
+
+func (se *SliceExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+
+func (se *SliceExpression) String() string {
+	// (array[start:end])
+	var out strings.Builder
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("]")
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// QuoteExpression
+//
+//	quote(<expression>)
+//
+// 関数呼び出しに見えるけど専用の構文なので、`let quote = ...` みたいに上書きされる心配がない。
+type QuoteExpression struct {
+	Token      token.Token // token.QUOTE
+	Expression Expression
+}
+
+func (qe *QuoteExpression) expressionNode() {
+	panic("implement me")
+}
+
+func (qe *QuoteExpression) TokenLiteral() string {
+	return qe.Token.Literal
+}
+
+func (qe *QuoteExpression) String() string {
+	return "quote(" + qe.Expression.String() + ")"
+}
+
+// UnquoteExpression
+//
+//	unquote(<expression>)
+//	unquote_splicing(<expression>)
+//
+// unquote_splicing は配列を展開して、関数呼び出しの引数や配列リテラルの要素として埋め込む。
+type UnquoteExpression struct {
+	Token      token.Token // token.UNQUOTE か token.UNQUOTE_SPLICING
+	Expression Expression
+}
+
+func (ue *UnquoteExpression) expressionNode() {
+	panic("implement me")
+}
+
+func (ue *UnquoteExpression) TokenLiteral() string {
+	return ue.Token.Literal
+}
+
+func (ue *UnquoteExpression) String() string {
+	return ue.TokenLiteral() + "(" + ue.Expression.String() + ")"
+}
+
+// Splicing は unquote_splicing かどうか
+func (ue *UnquoteExpression) Splicing() bool {
+	return ue.Token.Type == token.UNQUOTE_SPLICING
+}
+
+// NullLiteral は null。unquote で NULL を埋め込んだときにも使う。
+type NullLiteral struct {
+	Token token.Token // token.NULL
+}
+
+func (nl *NullLiteral) expressionNode() {
+	panic("implement me")
+}
+
+func (nl *NullLiteral) TokenLiteral() string {
+	return nl.Token.Literal
+}
+
+func (nl *NullLiteral) String() string {
+	return nl.Token.Literal
+}
@@ -0,0 +1,144 @@
+package ast
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Clone は node を丸ごと複製する。子ノードも全部新しく作るので、複製した側を Modify で書き換えても元のノードには影響しない。
+// トークン(位置も含む)もそのままコピーする。
+func Clone(node Node) Node {
+	if node == nil {
+		return nil
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		return &Program{Statements: cloneList(n.Statements)}
+
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: n.Token, Expression: cloneAs(n.Expression)}
+
+	case *LetStatement:
+		return &LetStatement{Token: n.Token, Name: cloneAs(n.Name), Value: cloneAs(n.Value)}
+
+	case *ReturnStatement:
+		return &ReturnStatement{Token: n.Token, ReturnValue: cloneAs(n.ReturnValue)}
+
+	case *BlockStatement:
+		return &BlockStatement{Token: n.Token, Statements: cloneList(n.Statements)}
+
+	case *Identifier:
+		return &Identifier{Token: n.Token, Value: n.Value}
+
+	case *IntegerLiteral:
+		lit := &IntegerLiteral{Token: n.Token, Value: n.Value}
+		if n.BigValue != nil {
+			// *big.Int もポインタなので、共有しないように作り直す
+			lit.BigValue = new(big.Int).Set(n.BigValue)
+		}
+		return lit
+
+	case *StringLiteral:
+		return &StringLiteral{Token: n.Token, Value: n.Value}
+
+	case *Boolean:
+		return &Boolean{Token: n.Token, Value: n.Value}
+
+	case *PrefixExpression:
+		return &PrefixExpression{Token: n.Token, Operator: n.Operator, Right: cloneAs(n.Right)}
+
+	case *InfixExpression:
+		return &InfixExpression{Token: n.Token, Left: cloneAs(n.Left), Operator: n.Operator, Right: cloneAs(n.Right)}
+
+	case *IfExpression:
+		return &IfExpression{
+			Token:       n.Token,
+			Condition:   cloneAs(n.Condition),
+			Consequence: cloneAs(n.Consequence),
+			Alternative: cloneAs(n.Alternative),
+		}
+
+	case *FunctionLiteral:
+		return &FunctionLiteral{Token: n.Token, Parameters: cloneList(n.Parameters), Body: cloneAs(n.Body)}
+
+	case *MacroLiteral:
+		return &MacroLiteral{Token: n.Token, Parameters: cloneList(n.Parameters), Body: cloneAs(n.Body)}
+
+	case *CallExpression:
+		return &CallExpression{Token: n.Token, Function: cloneAs(n.Function), Arguments: cloneList(n.Arguments)}
+
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: n.Token, Elements: cloneList(n.Elements)}
+
+	case *IndexExpression:
+		return &IndexExpression{Token: n.Token, Left: cloneAs(n.Left), Index: cloneAs(n.Index)}
+
+	case *SliceExpression:
+		return &SliceExpression{Token: n.Token, Left: cloneAs(n.Left), Start: cloneAs(n.Start), End: cloneAs(n.End)}
+
+	case *HashLiteral:
+		var pairs map[Expression]Expression
+		if n.Pairs != nil {
+			pairs = make(map[Expression]Expression, len(n.Pairs))
+			for key, value := range n.Pairs {
+				pairs[cloneAs(key)] = cloneAs(value)
+			}
+		}
+		return &HashLiteral{Token: n.Token, Pairs: pairs}
+
+	case *QuoteExpression:
+		return &QuoteExpression{Token: n.Token, Expression: cloneAs(n.Expression)}
+
+	case *UnquoteExpression:
+		return &UnquoteExpression{Token: n.Token, Expression: cloneAs(n.Expression)}
+
+	case *NullLiteral:
+		return &NullLiteral{Token: n.Token}
+
+	default:
+		// Modify や Walk と同じで、新しいノードを足したらここも直してね
+		panic(fmt.Sprintf("ast.Clone: unknown node type %T", n))
+	}
+}
+
+// cloneAs は Clone して元の型に戻す。nil(省略されたelse節とか)は nil のまま。
+func cloneAs[T Node](node T) T {
+	var zero T
+
+	// Expression の nil も *BlockStatement の nil も、Node に入れると判定がややこしいので isNilNode で見る
+	if isNilNode(node) {
+		return zero
+	}
+
+	return Clone(node).(T)
+}
+
+// cloneList はスライスの中身を Clone する。nil と空スライスの区別は残す(String() は同じだけど DeepEqual で比べたいので)。
+func cloneList[T Node](nodes []T) []T {
+	if nodes == nil {
+		return nil
+	}
+
+	cloned := make([]T, len(nodes))
+	for i, node := range nodes {
+		cloned[i] = cloneAs(node)
+	}
+
+	return cloned
+}
+
+func isNilNode(node Node) bool {
+	if node == nil {
+		return true
+	}
+
+	switch n := node.(type) {
+	case *BlockStatement:
+		return n == nil
+	case *Identifier:
+		return n == nil
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package ast_test
+
+import (
+	"gomonkey/ast"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	tests := []string{
+		"let x = 5; return x;",
+		"-a * b + c % 99999999999999999999999",
+		"if (x < y) { x } else { y }; if (true) { 1 }",
+		"let f = fn(x, y) { x + y }; f(1, 2)",
+		"fn() {}",
+		"let m = macro(a) { quote(unquote(a) + 1) };",
+		"[1, [2, 3]][0][1:][:1][-1:2]",
+		`{"one": 1, true: [2], 3: {}}`,
+		"quote([unquote(a), unquote_splicing(b), null])",
+	}
+
+	for _, input := range tests {
+		input := input
+		t.Run(input, func(t *testing.T) {
+			program := parseProgram(t, input)
+			cloned := ast.Clone(program)
+
+			// ハッシュのキーはポインタなので DeepEqual では比べられない。位置まで入る JSON で比べる
+			want, _ := ast.EncodeJSON(program)
+			got, err := ast.EncodeJSON(cloned)
+			if err != nil {
+				t.Fatalf("エンコードでエラーになっちゃだめだよ。err=%s", err)
+			}
+			if string(got) != string(want) {
+				t.Fatalf("複製したら中身が変わっちゃったよ。\ngot =%s\nwant=%s", got, want)
+			}
+
+			// 元のノードと複製したノードで、同じポインタが1つもないこと
+			original := make(map[ast.Node]bool)
+			ast.Inspect(program, func(node ast.Node) bool {
+				original[node] = true
+				return true
+			})
+
+			ast.Inspect(cloned, func(node ast.Node) bool {
+				if node != nil && original[node] {
+					t.Errorf("ノードが共有されてるよ。%T %q", node, node.String())
+				}
+				return true
+			})
+		})
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	program := parseProgram(t, "let x = 1 + 99999999999999999999;")
+	cloned := ast.Clone(program).(*ast.Program)
+
+	// 複製した方を書き換えても、元のプログラムは変わらない
+	_, err := ast.Modify(cloned, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			node.Value = "y"
+		case *ast.IntegerLiteral:
+			if node.BigValue != nil {
+				node.BigValue.SetInt64(2)
+			}
+		}
+		return node
+	})
+	if err != nil {
+		t.Fatalf("エラーになっちゃだめだよ。err=%s", err)
+	}
+
+	letStmt := program.Statements[0].(*ast.LetStatement)
+	if letStmt.Name.Value != "x" {
+		t.Errorf("元のプログラムの名前が変わっちゃったよ。got=%q", letStmt.Name.Value)
+	}
+
+	big := letStmt.Value.(*ast.InfixExpression).Right.(*ast.IntegerLiteral)
+	if big.BigValue.String() != "99999999999999999999" {
+		t.Errorf("元のプログラムの big.Int が変わっちゃったよ。got=%s", big.BigValue)
+	}
+}
+
+func TestCloneNil(t *testing.T) {
+	if ast.Clone(nil) != nil {
+		t.Errorf("nil を複製したら nil じゃないとだめだよ")
+	}
+
+	// 省略された子ノードは nil のまま
+	ifExpr := &ast.IfExpression{Condition: &ast.Boolean{Value: true}, Consequence: &ast.BlockStatement{}}
+	cloned := ast.Clone(ifExpr).(*ast.IfExpression)
+	if cloned.Alternative != nil {
+		t.Errorf("Alternative が nil じゃないよ。got=%#v", cloned.Alternative)
+	}
+}
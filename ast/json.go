@@ -0,0 +1,593 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"gomonkey/token"
+	"math/big"
+	"strconv"
+)
+
+// JSON にするときは、どのノードも "kind" (ノードの型名から *ast. を取ったもの) と "pos" を持つ。
+//
+//	{"kind": "InfixExpression", "pos": {"line": 1, "column": 3}, "operator": "+", "left": {...}, "right": {...}}
+//
+// pos はそのノードのトークンの位置。レキサーを通っていないノード(評価器が作ったやつとか)には付かない。
+// トークンそのものは JSON に入れずに、デコードするときに kind と中身から組み立て直す。
+
+type jsonPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type jsonPair struct {
+	Key   *jsonNode `json:"key"`
+	Value *jsonNode `json:"value"`
+}
+
+// jsonNode は全部のノードのフィールドを1つにまとめたもの。kind ごとに使うフィールドだけが入る。
+type jsonNode struct {
+	Kind string   `json:"kind"`
+	Pos  *jsonPos `json:"pos,omitempty"`
+
+	Name *jsonNode `json:"name,omitempty"`
+
+	// Identifier, IntegerLiteral, StringLiteral, Boolean はリテラルの値、
+	// LetStatement と ReturnStatement は式のノードが入る
+	Value json.RawMessage `json:"value,omitempty"`
+
+	Operator    string      `json:"operator,omitempty"`
+	Splicing    bool        `json:"splicing,omitempty"`
+	Expression  *jsonNode   `json:"expression,omitempty"`
+	Statements  []*jsonNode `json:"statements,omitempty"`
+	Left        *jsonNode   `json:"left,omitempty"`
+	Right       *jsonNode   `json:"right,omitempty"`
+	Index       *jsonNode   `json:"index,omitempty"`
+	Start       *jsonNode   `json:"start,omitempty"`
+	End         *jsonNode   `json:"end,omitempty"`
+	Condition   *jsonNode   `json:"condition,omitempty"`
+	Consequence *jsonNode   `json:"consequence,omitempty"`
+	Alternative *jsonNode   `json:"alternative,omitempty"`
+	Parameters  []*jsonNode `json:"parameters,omitempty"`
+	Body        *jsonNode   `json:"body,omitempty"`
+	Function    *jsonNode   `json:"function,omitempty"`
+	Arguments   []*jsonNode `json:"arguments,omitempty"`
+	Elements    []*jsonNode `json:"elements,omitempty"`
+	Pairs       []jsonPair  `json:"pairs,omitempty"`
+}
+
+// EncodeJSON は node を JSON にする
+func EncodeJSON(node Node) ([]byte, error) {
+	jn, err := toJSONNode(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jn)
+}
+
+// DecodeJSON は EncodeJSON で作った JSON からノードを組み立て直す
+func DecodeJSON(data []byte) (Node, error) {
+	var jn jsonNode
+	if err := json.Unmarshal(data, &jn); err != nil {
+		return nil, fmt.Errorf("ast: invalid JSON: %w", err)
+	}
+
+	return fromJSONNode(&jn)
+}
+
+func toJSONNode(node Node) (*jsonNode, error) {
+	if node == nil {
+		return nil, nil
+	}
+
+	jn := &jsonNode{}
+
+	var err error
+
+	switch n := node.(type) {
+	case *Program:
+		jn.Kind = "Program"
+		jn.Statements, err = toJSONNodes(n.Statements)
+
+	case *LetStatement:
+		jn.Kind = "LetStatement"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		if n.Name != nil {
+			jn.Name, err = toJSONNode(n.Name)
+		}
+		if err == nil && n.Value != nil {
+			jn.Value, err = encodeChild(n.Value)
+		}
+
+	case *ReturnStatement:
+		jn.Kind = "ReturnStatement"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		if n.ReturnValue != nil {
+			jn.Value, err = encodeChild(n.ReturnValue)
+		}
+
+	case *ExpressionStatement:
+		jn.Kind = "ExpressionStatement"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		if n.Expression != nil {
+			jn.Expression, err = toJSONNode(n.Expression)
+		}
+
+	case *BlockStatement:
+		jn.Kind = "BlockStatement"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Statements, err = toJSONNodes(n.Statements)
+
+	case *Identifier:
+		jn.Kind = "Identifier"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Value, err = json.Marshal(n.Value)
+
+	case *IntegerLiteral:
+		jn.Kind = "IntegerLiteral"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		// int64 に収まらない値もあるので、10進数の文字列をそのまま JSON の数値として書く
+		jn.Value = json.RawMessage(integerLiteralText(n))
+
+	case *StringLiteral:
+		jn.Kind = "StringLiteral"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Value, err = json.Marshal(n.Value)
+
+	case *Boolean:
+		jn.Kind = "Boolean"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Value, err = json.Marshal(n.Value)
+
+	case *PrefixExpression:
+		jn.Kind = "PrefixExpression"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Operator = n.Operator
+		jn.Right, err = toJSONNode(n.Right)
+
+	case *InfixExpression:
+		jn.Kind = "InfixExpression"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Operator = n.Operator
+		jn.Left, err = toJSONNode(n.Left)
+		if err == nil {
+			jn.Right, err = toJSONNode(n.Right)
+		}
+
+	case *IfExpression:
+		jn.Kind = "IfExpression"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Condition, err = toJSONNode(n.Condition)
+		if err == nil && n.Consequence != nil {
+			jn.Consequence, err = toJSONNode(n.Consequence)
+		}
+		if err == nil && n.Alternative != nil {
+			jn.Alternative, err = toJSONNode(n.Alternative)
+		}
+
+	case *FunctionLiteral:
+		jn.Kind = "FunctionLiteral"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Parameters, err = toJSONNodes(n.Parameters)
+		if err == nil && n.Body != nil {
+			jn.Body, err = toJSONNode(n.Body)
+		}
+
+	case *MacroLiteral:
+		jn.Kind = "MacroLiteral"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Parameters, err = toJSONNodes(n.Parameters)
+		if err == nil && n.Body != nil {
+			jn.Body, err = toJSONNode(n.Body)
+		}
+
+	case *CallExpression:
+		jn.Kind = "CallExpression"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Function, err = toJSONNode(n.Function)
+		if err == nil {
+			jn.Arguments, err = toJSONNodes(n.Arguments)
+		}
+
+	case *ArrayLiteral:
+		jn.Kind = "ArrayLiteral"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Elements, err = toJSONNodes(n.Elements)
+
+	case *IndexExpression:
+		jn.Kind = "IndexExpression"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Left, err = toJSONNode(n.Left)
+		if err == nil {
+			jn.Index, err = toJSONNode(n.Index)
+		}
+
+	case *SliceExpression:
+		jn.Kind = "SliceExpression"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Left, err = toJSONNode(n.Left)
+		if err == nil && n.Start != nil {
+			jn.Start, err = toJSONNode(n.Start)
+		}
+		if err == nil && n.End != nil {
+			jn.End, err = toJSONNode(n.End)
+		}
+
+	case *HashLiteral:
+		jn.Kind = "HashLiteral"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		for _, key := range sortedHashKeys(n) {
+			pair := jsonPair{}
+			if pair.Key, err = toJSONNode(key); err != nil {
+				return nil, err
+			}
+			if pair.Value, err = toJSONNode(n.Pairs[key]); err != nil {
+				return nil, err
+			}
+			jn.Pairs = append(jn.Pairs, pair)
+		}
+
+	case *QuoteExpression:
+		jn.Kind = "QuoteExpression"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Expression, err = toJSONNode(n.Expression)
+
+	case *UnquoteExpression:
+		jn.Kind = "UnquoteExpression"
+		jn.Pos = toJSONPos(n.Token.Pos)
+		jn.Splicing = n.Splicing()
+		jn.Expression, err = toJSONNode(n.Expression)
+
+	case *NullLiteral:
+		jn.Kind = "NullLiteral"
+		jn.Pos = toJSONPos(n.Token.Pos)
+
+	default:
+		return nil, fmt.Errorf("ast: cannot encode node type %T", node)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return jn, nil
+}
+
+func toJSONNodes[T Node](nodes []T) ([]*jsonNode, error) {
+	var jns []*jsonNode
+	for _, node := range nodes {
+		jn, err := toJSONNode(node)
+		if err != nil {
+			return nil, err
+		}
+		jns = append(jns, jn)
+	}
+
+	return jns, nil
+}
+
+// encodeChild は value フィールドに入れる子ノードを JSON にする
+func encodeChild(node Node) (json.RawMessage, error) {
+	jn, err := toJSONNode(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jn)
+}
+
+func toJSONPos(pos token.Position) *jsonPos {
+	if !pos.IsValid() {
+		return nil
+	}
+
+	return &jsonPos{Line: pos.Line, Column: pos.Column}
+}
+
+// integerLiteralText は整数リテラルの値を10進数で返す。
+// トークンの文字列をそのまま使うと 010 みたいな先頭に0がついた書き方が JSON の数値として壊れるので、値から作る。
+func integerLiteralText(il *IntegerLiteral) string {
+	if il.BigValue != nil {
+		return il.BigValue.String()
+	}
+
+	return strconv.FormatInt(il.Value, 10)
+}
+
+func fromJSONNode(jn *jsonNode) (Node, error) {
+	if jn == nil {
+		return nil, fmt.Errorf("ast: missing node")
+	}
+
+	pos := token.Position{}
+	if jn.Pos != nil {
+		pos = token.Position{Line: jn.Pos.Line, Column: jn.Pos.Column}
+	}
+
+	tok := func(typ token.Type, literal string) token.Token {
+		return token.Token{Type: typ, Literal: literal, Pos: pos}
+	}
+
+	var err error
+
+	switch jn.Kind {
+	case "Program":
+		program := &Program{}
+		program.Statements, err = fromJSONNodes[Statement](jn.Statements)
+		return program, err
+
+	case "LetStatement":
+		stmt := &LetStatement{Token: tok(token.LET, "let")}
+		if jn.Name != nil {
+			stmt.Name, err = fromJSONNodeAs[*Identifier](jn.Name)
+		}
+		if err == nil && len(jn.Value) > 0 {
+			stmt.Value, err = decodeChild[Expression](jn.Value)
+		}
+		return stmt, err
+
+	case "ReturnStatement":
+		stmt := &ReturnStatement{Token: tok(token.RETURN, "return")}
+		if len(jn.Value) > 0 {
+			stmt.ReturnValue, err = decodeChild[Expression](jn.Value)
+		}
+		return stmt, err
+
+	case "ExpressionStatement":
+		stmt := &ExpressionStatement{}
+		if jn.Expression != nil {
+			stmt.Expression, err = fromJSONNodeAs[Expression](jn.Expression)
+		}
+		if err == nil && stmt.Expression != nil {
+			// パーサーは式の先頭のトークンを入れている
+			stmt.Token = firstToken(stmt.Expression)
+		}
+		stmt.Token.Pos = pos
+		return stmt, err
+
+	case "BlockStatement":
+		block := &BlockStatement{Token: tok(token.LBRACE, "{")}
+		block.Statements, err = fromJSONNodes[Statement](jn.Statements)
+		if block.Statements == nil {
+			block.Statements = []Statement{}
+		}
+		return block, err
+
+	case "Identifier":
+		var value string
+		if err := json.Unmarshal(jn.Value, &value); err != nil {
+			return nil, fmt.Errorf("ast: invalid Identifier value: %s", jn.Value)
+		}
+		return &Identifier{Token: tok(token.IDENT, value), Value: value}, nil
+
+	case "IntegerLiteral":
+		return decodeIntegerLiteral(string(jn.Value), tok)
+
+	case "StringLiteral":
+		var value string
+		if err := json.Unmarshal(jn.Value, &value); err != nil {
+			return nil, fmt.Errorf("ast: invalid StringLiteral value: %s", jn.Value)
+		}
+		return &StringLiteral{Token: tok(token.STRING, value), Value: value}, nil
+
+	case "Boolean":
+		var value bool
+		if err := json.Unmarshal(jn.Value, &value); err != nil {
+			return nil, fmt.Errorf("ast: invalid Boolean value: %s", jn.Value)
+		}
+		if value {
+			return &Boolean{Token: tok(token.TRUE, "true"), Value: true}, nil
+		}
+		return &Boolean{Token: tok(token.FALSE, "false"), Value: false}, nil
+
+	case "PrefixExpression":
+		expr := &PrefixExpression{Token: tok(token.Type(jn.Operator), jn.Operator), Operator: jn.Operator}
+		expr.Right, err = fromJSONNodeAs[Expression](jn.Right)
+		return expr, err
+
+	case "InfixExpression":
+		expr := &InfixExpression{Token: tok(token.Type(jn.Operator), jn.Operator), Operator: jn.Operator}
+		expr.Left, err = fromJSONNodeAs[Expression](jn.Left)
+		if err == nil {
+			expr.Right, err = fromJSONNodeAs[Expression](jn.Right)
+		}
+		return expr, err
+
+	case "IfExpression":
+		expr := &IfExpression{Token: tok(token.IF, "if")}
+		expr.Condition, err = fromJSONNodeAs[Expression](jn.Condition)
+		if err == nil {
+			expr.Consequence, err = fromJSONNodeAs[*BlockStatement](jn.Consequence)
+		}
+		if err == nil && jn.Alternative != nil {
+			expr.Alternative, err = fromJSONNodeAs[*BlockStatement](jn.Alternative)
+		}
+		return expr, err
+
+	case "FunctionLiteral":
+		fn := &FunctionLiteral{Token: tok(token.FUNCTION, "fn")}
+		fn.Parameters, err = fromJSONNodes[*Identifier](jn.Parameters)
+		if err == nil {
+			fn.Body, err = fromJSONNodeAs[*BlockStatement](jn.Body)
+		}
+		return fn, err
+
+	case "MacroLiteral":
+		macro := &MacroLiteral{Token: tok(token.MACRO, "macro")}
+		macro.Parameters, err = fromJSONNodes[*Identifier](jn.Parameters)
+		if err == nil {
+			macro.Body, err = fromJSONNodeAs[*BlockStatement](jn.Body)
+		}
+		return macro, err
+
+	case "CallExpression":
+		call := &CallExpression{Token: tok(token.LPAREN, "(")}
+		call.Function, err = fromJSONNodeAs[Expression](jn.Function)
+		if err == nil {
+			call.Arguments, err = fromJSONNodes[Expression](jn.Arguments)
+		}
+		return call, err
+
+	case "ArrayLiteral":
+		array := &ArrayLiteral{Token: tok(token.LBRACKET, "[")}
+		array.Elements, err = fromJSONNodes[Expression](jn.Elements)
+		return array, err
+
+	case "IndexExpression":
+		expr := &IndexExpression{Token: tok(token.LBRACKET, "[")}
+		expr.Left, err = fromJSONNodeAs[Expression](jn.Left)
+		if err == nil {
+			expr.Index, err = fromJSONNodeAs[Expression](jn.Index)
+		}
+		return expr, err
+
+	case "SliceExpression":
+		expr := &SliceExpression{Token: tok(token.LBRACKET, "[")}
+		expr.Left, err = fromJSONNodeAs[Expression](jn.Left)
+		if err == nil && jn.Start != nil {
+			expr.Start, err = fromJSONNodeAs[Expression](jn.Start)
+		}
+		if err == nil && jn.End != nil {
+			expr.End, err = fromJSONNodeAs[Expression](jn.End)
+		}
+		return expr, err
+
+	case "HashLiteral":
+		hash := &HashLiteral{Token: tok(token.LBRACE, "{"), Pairs: make(map[Expression]Expression)}
+		for _, pair := range jn.Pairs {
+			key, err := fromJSONNodeAs[Expression](pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := fromJSONNodeAs[Expression](pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			hash.Pairs[key] = value
+		}
+		return hash, nil
+
+	case "QuoteExpression":
+		expr := &QuoteExpression{Token: tok(token.QUOTE, "quote")}
+		expr.Expression, err = fromJSONNodeAs[Expression](jn.Expression)
+		return expr, err
+
+	case "UnquoteExpression":
+		expr := &UnquoteExpression{Token: tok(token.UNQUOTE, "unquote")}
+		if jn.Splicing {
+			expr.Token = tok(token.UNQUOTE_SPLICING, "unquote_splicing")
+		}
+		expr.Expression, err = fromJSONNodeAs[Expression](jn.Expression)
+		return expr, err
+
+	case "NullLiteral":
+		return &NullLiteral{Token: tok(token.NULL, "null")}, nil
+
+	default:
+		return nil, fmt.Errorf("ast: unknown node kind %q", jn.Kind)
+	}
+}
+
+// fromJSONNodeAs はデコードしたノードが T として使えるかまでチェックする。式のところに文が来たりしたらエラー。
+func fromJSONNodeAs[T Node](jn *jsonNode) (T, error) {
+	var zero T
+
+	node, err := fromJSONNode(jn)
+	if err != nil {
+		return zero, err
+	}
+
+	result, ok := node.(T)
+	if !ok {
+		return zero, fmt.Errorf("ast: unexpected node kind %q here", jn.Kind)
+	}
+
+	return result, nil
+}
+
+func fromJSONNodes[T Node](jns []*jsonNode) ([]T, error) {
+	var nodes []T
+	for _, jn := range jns {
+		node, err := fromJSONNodeAs[T](jn)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+func decodeChild[T Node](raw json.RawMessage) (T, error) {
+	var jn jsonNode
+	if err := json.Unmarshal(raw, &jn); err != nil {
+		var zero T
+		return zero, fmt.Errorf("ast: invalid JSON: %w", err)
+	}
+
+	return fromJSONNodeAs[T](&jn)
+}
+
+func decodeIntegerLiteral(text string, tok func(token.Type, string) token.Token) (*IntegerLiteral, error) {
+	lit := &IntegerLiteral{Token: tok(token.INT, text)}
+
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err == nil {
+		lit.Value = value
+		return lit, nil
+	}
+
+	// パーサーと同じで、int64 に収まらなければ big.Int にする
+	bigValue, ok := new(big.Int).SetString(text, 10)
+	if !ok {
+		return nil, fmt.Errorf("ast: invalid IntegerLiteral value: %s", text)
+	}
+	lit.BigValue = bigValue
+
+	return lit, nil
+}
+
+// firstToken は式の一番左のトークンを返す。中置演算式とかはノード自身のトークンが先頭じゃないので左を辿る。
+func firstToken(expr Expression) token.Token {
+	switch e := expr.(type) {
+	case *InfixExpression:
+		return firstToken(e.Left)
+	case *CallExpression:
+		return firstToken(e.Function)
+	case *IndexExpression:
+		return firstToken(e.Left)
+	case *SliceExpression:
+		return firstToken(e.Left)
+	case *Identifier:
+		return e.Token
+	case *IntegerLiteral:
+		return e.Token
+	case *StringLiteral:
+		return e.Token
+	case *Boolean:
+		return e.Token
+	case *PrefixExpression:
+		return e.Token
+	case *IfExpression:
+		return e.Token
+	case *FunctionLiteral:
+		return e.Token
+	case *MacroLiteral:
+		return e.Token
+	case *ArrayLiteral:
+		return e.Token
+	case *HashLiteral:
+		return e.Token
+	case *QuoteExpression:
+		return e.Token
+	case *UnquoteExpression:
+		return e.Token
+	case *NullLiteral:
+		return e.Token
+	case *ExpressionStatement:
+		return e.Token
+	default:
+		return token.Token{}
+	}
+}
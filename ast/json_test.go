@@ -0,0 +1,197 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"gomonkey/ast"
+	"gomonkey/token"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []string{
+		"let x = 5;",
+		"return -a * b;",
+		"a + b * c - d / e % f;",
+		"!true == false",
+		`"hello" + " " + "world"`,
+		"if (x < y) { x } else { y }",
+		"if (x > y) { let z = x; z }",
+		"fn() {}",
+		"fn(x, y) { return x + y; }(1, 2)",
+		"let unless = macro(cond, cons) { quote(if (!(unquote(cond))) { unquote(cons) }) };",
+		"[1, 2 * 2, [3]][1:][0]",
+		"xs[:2]; xs[1:-1]; xs[:]",
+		`{"one": 1, true: fn(x) { x }, 2: [3]}`,
+		"{}",
+		"99999999999999999999999 * 2",
+		"add(a, b)(c)[d]",
+		"quote(f(unquote(x), unquote_splicing(xs), null))",
+	}
+
+	for _, input := range tests {
+		input := input
+		t.Run(input, func(t *testing.T) {
+			program := parseProgram(t, input)
+
+			data, err := ast.EncodeJSON(program)
+			if err != nil {
+				t.Fatalf("エンコードでエラーになっちゃだめだよ。err=%s", err)
+			}
+
+			decoded, err := ast.DecodeJSON(data)
+			if err != nil {
+				t.Fatalf("デコードでエラーになっちゃだめだよ。err=%s\njson=%s", err, data)
+			}
+
+			if _, ok := decoded.(*ast.Program); !ok {
+				t.Fatalf("*ast.Program じゃないよ。got=%T", decoded)
+			}
+
+			if decoded.String() != program.String() {
+				t.Errorf("元に戻ってないよ。got=%q, want=%q", decoded.String(), program.String())
+			}
+
+			// もう一回エンコードしても同じ JSON になる
+			again, err := ast.EncodeJSON(decoded)
+			if err != nil {
+				t.Fatalf("エンコードでエラーになっちゃだめだよ。err=%s", err)
+			}
+			if string(again) != string(data) {
+				t.Errorf("2回目の JSON がちがうよ。\ngot =%s\nwant=%s", again, data)
+			}
+		})
+	}
+}
+
+func TestJSONEncodeFormat(t *testing.T) {
+	program := parseProgram(t, "let x = 1 + y;")
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("エンコードでエラーになっちゃだめだよ。err=%s", err)
+	}
+
+	expected := `{"kind":"Program","statements":[` +
+		`{"kind":"LetStatement","pos":{"line":1,"column":1},` +
+		`"name":{"kind":"Identifier","pos":{"line":1,"column":5},"value":"x"},` +
+		`"value":{"kind":"InfixExpression","pos":{"line":1,"column":11},"operator":"+",` +
+		`"left":{"kind":"IntegerLiteral","pos":{"line":1,"column":9},"value":1},` +
+		`"right":{"kind":"Identifier","pos":{"line":1,"column":13},"value":"y"}}}]}`
+
+	if string(data) != expected {
+		t.Errorf("JSON がちがうよ。\ngot =%s\nwant=%s", data, expected)
+	}
+}
+
+func TestJSONDecodeKeepsPositions(t *testing.T) {
+	program := parseProgram(t, "let f = fn(a) {\n  a * 2\n};")
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("エンコードでエラーになっちゃだめだよ。err=%s", err)
+	}
+
+	decoded, err := ast.DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("デコードでエラーになっちゃだめだよ。err=%s", err)
+	}
+
+	// 元のプログラムとデコードしたプログラムを同じ順番で辿って、位置を比べる
+	var want, got []token.Position
+	collect := func(positions *[]token.Position) func(ast.Node) bool {
+		return func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.Identifier:
+				*positions = append(*positions, node.Token.Pos)
+			case *ast.IntegerLiteral:
+				*positions = append(*positions, node.Token.Pos)
+			case *ast.InfixExpression:
+				*positions = append(*positions, node.Token.Pos)
+			}
+			return true
+		}
+	}
+	ast.Inspect(program, collect(&want))
+	ast.Inspect(decoded, collect(&got))
+
+	if len(got) != len(want) {
+		t.Fatalf("ノードの数がちがうよ。got=%d, want=%d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("[%d] 位置がちがうよ。got=%s, want=%s", i, got[i], want[i])
+		}
+	}
+
+	// a * 2 の * は2行目
+	if want[2] != (token.Position{Line: 2, Column: 5}) {
+		t.Errorf("* の位置がおかしいよ。got=%s", want[2])
+	}
+}
+
+func TestJSONDecodeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "WhileStatement"}`, `ast: unknown node kind "WhileStatement"`},
+		{`{"kind": "ExpressionStatement", "expression": {"kind": "ReturnStatement"}}`, `ast: unexpected node kind "ReturnStatement" here`},
+		{`{"kind": "LetStatement", "name": {"kind": "IntegerLiteral", "value": 1}}`, `ast: unexpected node kind "IntegerLiteral" here`},
+		{`{"kind": "PrefixExpression", "operator": "-"}`, `ast: missing node`},
+		{`{"kind": "IntegerLiteral", "value": "1"}`, `ast: invalid IntegerLiteral value: "1"`},
+		{`[1, 2]`, `ast: invalid JSON`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := ast.DecodeJSON([]byte(tt.input))
+			if err == nil {
+				t.Fatalf("エラーにならないとだめだよ")
+			}
+
+			if !strings.HasPrefix(err.Error(), tt.expected) {
+				t.Errorf("エラーメッセージがちがうよ。got=%q, want=%q", err.Error(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestJSONIsValidJSON(t *testing.T) {
+	program := parseProgram(t, `let s = "a<b>&c"; {"k": [true, false]}`)
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("エンコードでエラーになっちゃだめだよ。err=%s", err)
+	}
+
+	if !json.Valid(data) {
+		t.Errorf("JSON として読めないよ。%s", data)
+	}
+}
+
+// 010 みたいに先頭に0がついた整数(8進数)も、10進数の JSON の数値として書ける
+func TestJSONRoundTripLeadingZeros(t *testing.T) {
+	program := parseProgram(t, "let a = 010; a + 99999999999999999999")
+
+	data, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("エンコードでエラーになっちゃだめだよ。err=%s", err)
+	}
+
+	if !json.Valid(data) {
+		t.Fatalf("JSON として読めないよ。%s", data)
+	}
+
+	decoded, err := ast.DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("デコードでエラーになっちゃだめだよ。err=%s\njson=%s", err, data)
+	}
+
+	expected := "let a = 8;(a + 99999999999999999999)"
+	if decoded.String() != expected {
+		t.Errorf("元に戻ってないよ。got=%q, want=%q", decoded.String(), expected)
+	}
+}
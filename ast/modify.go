@@ -1,69 +1,242 @@
 package ast
 
+import "fmt"
+
 type ModifyFunc func(Node) Node
 
-func Modify(node Node, modifier ModifyFunc) Node {
+// Modify は node を帰りがけ順(子ノードが先、自分が後)に辿って、modifier の戻り値でノードを置き換えていく。
+// modifier が置き換え先に入れられないノード(式のところに文とか、nilとか)を返したらエラーになる。
+func Modify(node Node, modifier ModifyFunc) (Node, error) {
+	return ModifyWithHooks(node, nil, modifier)
+}
+
+// ModifyWithHooks は pre を行きがけ(子ノードを辿る前)に、post を帰りがけ(子ノードを辿った後)に呼ぶ。
+// pre が別のノードを返したら、そのノードの子ノードを辿る。pre も post も nil でいい。
+func ModifyWithHooks(node Node, pre, post ModifyFunc) (Node, error) {
+	m := &modifier{pre: pre, post: post}
+
+	return m.modify(node)
+}
+
+// ModifyError は modifier が置き換え先に入れられないノードを返したときのエラー
+type ModifyError struct {
+	Parent Node   // 置き換えようとした子ノードの親
+	Field  string // 親のフィールド名。スライスやマップの要素なら Statements[0] みたいになる
+	Got    Node   // modifier が返したノード
+}
+
+func (e *ModifyError) Error() string {
+	return fmt.Sprintf("ast.Modify: cannot replace %T.%s with %T", e.Parent, e.Field, e.Got)
+}
+
+type modifier struct {
+	pre  ModifyFunc
+	post ModifyFunc
+}
+
+func (m *modifier) modify(node Node) (Node, error) {
+	if m.pre != nil {
+		node = m.pre(node)
+		if node == nil {
+			return nil, nil // 入れられるかどうかは親が判断する
+		}
+	}
+
+	// 省略できる子ノード(else節とか)は nil のことがあるので、nil のときは辿らない
+	var err error
+
 	switch node := node.(type) {
 	case *Program:
-		for i, statement := range node.Statements {
-			// MEMO: エラー処理は！？
-			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+		for i := range node.Statements {
+			if node.Statements[i] != nil {
+				node.Statements[i], err = modifyChild(m, node, fmt.Sprintf("Statements[%d]", i), node.Statements[i])
+			}
+			if err != nil {
+				return nil, err
+			}
 		}
+
 	case *ExpressionStatement:
-		// MEMO: エラー処理は！？
-		node.Expression, _ = Modify(node.Expression, modifier).(Expression)
+		if node.Expression != nil {
+			node.Expression, err = modifyChild(m, node, "Expression", node.Expression)
+		}
+
+	case *LetStatement:
+		if node.Name != nil {
+			node.Name, err = modifyChild(m, node, "Name", node.Name)
+		}
+		if err == nil && node.Value != nil {
+			node.Value, err = modifyChild(m, node, "Value", node.Value)
+		}
+
+	case *ReturnStatement:
+		if node.ReturnValue != nil {
+			node.ReturnValue, err = modifyChild(m, node, "ReturnValue", node.ReturnValue)
+		}
+
+	case *BlockStatement:
+		for i := range node.Statements {
+			if node.Statements[i] != nil {
+				node.Statements[i], err = modifyChild(m, node, fmt.Sprintf("Statements[%d]", i), node.Statements[i])
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
 
 	case *InfixExpression:
-		node.Left, _ = Modify(node.Left, modifier).(Expression)
-		node.Right, _ = Modify(node.Right, modifier).(Expression)
+		if node.Left != nil {
+			node.Left, err = modifyChild(m, node, "Left", node.Left)
+		}
+		if err == nil && node.Right != nil {
+			node.Right, err = modifyChild(m, node, "Right", node.Right)
+		}
 
 	case *PrefixExpression:
-		node.Right, _ = Modify(node.Right, modifier).(Expression)
+		if node.Right != nil {
+			node.Right, err = modifyChild(m, node, "Right", node.Right)
+		}
 
 	case *IndexExpression:
-		node.Index, _ = Modify(node.Index, modifier).(Expression)
-		node.Left, _ = Modify(node.Left, modifier).(Expression)
-
-	case *IfExpression:
-		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
-		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+		if node.Left != nil {
+			node.Left, err = modifyChild(m, node, "Left", node.Left)
+		}
+		if err == nil && node.Index != nil {
+			node.Index, err = modifyChild(m, node, "Index", node.Index)
+		}
 
-		if node.Alternative != nil {
-			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+	case *SliceExpression:
+		if node.Left != nil {
+			node.Left, err = modifyChild(m, node, "Left", node.Left)
+		}
+		if err == nil && node.Start != nil {
+			node.Start, err = modifyChild(m, node, "Start", node.Start)
+		}
+		if err == nil && node.End != nil {
+			node.End, err = modifyChild(m, node, "End", node.End)
 		}
 
-	case *BlockStatement:
-		for i, statement := range node.Statements {
-			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+	case *IfExpression:
+		if node.Condition != nil {
+			node.Condition, err = modifyChild(m, node, "Condition", node.Condition)
+		}
+		if err == nil && node.Consequence != nil {
+			node.Consequence, err = modifyChild(m, node, "Consequence", node.Consequence)
+		}
+		if err == nil && node.Alternative != nil {
+			node.Alternative, err = modifyChild(m, node, "Alternative", node.Alternative)
 		}
 
-	case *ReturnStatement:
-		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+	case *FunctionLiteral:
+		err = m.modifyParameters(node, node.Parameters)
+		if err == nil && node.Body != nil {
+			node.Body, err = modifyChild(m, node, "Body", node.Body)
+		}
 
-	case *LetStatement:
-		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *MacroLiteral:
+		err = m.modifyParameters(node, node.Parameters)
+		if err == nil && node.Body != nil {
+			node.Body, err = modifyChild(m, node, "Body", node.Body)
+		}
 
-	case *FunctionLiteral:
-		for i := range node.Parameters {
-			node.Parameters[i], _ = Modify(node.Parameters[i], modifier).(*Identifier)
+	case *CallExpression:
+		if node.Function != nil {
+			node.Function, err = modifyChild(m, node, "Function", node.Function)
+		}
+		if err == nil {
+			err = m.modifyExpressions(node, "Arguments", node.Arguments)
 		}
-		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
 
 	case *ArrayLiteral:
-		for i := range node.Elements {
-			node.Elements[i], _ = Modify(node.Elements[i], modifier).(Expression)
-		}
+		err = m.modifyExpressions(node, "Elements", node.Elements)
 
 	case *HashLiteral:
 		newPairs := make(map[Expression]Expression)
 		for key, value := range node.Pairs {
-			newKey, _ := Modify(key, modifier).(Expression)
-			newValue, _ := Modify(value, modifier).(Expression)
+			newKey, err := modifyChild(m, node, "Pairs(key)", key)
+			if err != nil {
+				return nil, err
+			}
+
+			newValue, err := modifyChild(m, node, "Pairs(value)", value)
+			if err != nil {
+				return nil, err
+			}
+
 			newPairs[newKey] = newValue
 		}
 
 		node.Pairs = newPairs
+
+	case *QuoteExpression:
+		if node.Expression != nil {
+			node.Expression, err = modifyChild(m, node, "Expression", node.Expression)
+		}
+
+	case *UnquoteExpression:
+		if node.Expression != nil {
+			node.Expression, err = modifyChild(m, node, "Expression", node.Expression)
+		}
+
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean, *NullLiteral:
+		// 子ノードを持たないやつら
+
+	default:
+		// 新しいノードを足したのにここを直し忘れたら、黙ってスルーせずに気づけるようにする
+		return nil, fmt.Errorf("ast.Modify: unknown node type %T", node)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m.post != nil {
+		return m.post(node), nil
+	}
+
+	return node, nil
+}
+
+func (m *modifier) modifyParameters(parent Node, parameters []*Identifier) error {
+	for i := range parameters {
+		var err error
+		parameters[i], err = modifyChild(m, parent, fmt.Sprintf("Parameters[%d]", i), parameters[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *modifier) modifyExpressions(parent Node, field string, expressions []Expression) error {
+	for i := range expressions {
+		if expressions[i] == nil {
+			continue
+		}
+
+		var err error
+		expressions[i], err = modifyChild(m, parent, fmt.Sprintf("%s[%d]", field, i), expressions[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// modifyChild は子ノードを辿って、その結果が元の場所(T型のフィールド)に入れられるかをチェックする。
+// 昔は `node.Left, _ = Modify(...).(Expression)` で型アサーションの失敗を握りつぶしていたので、nilが紛れ込んでいた。
+func modifyChild[T Node](m *modifier, parent Node, field string, child T) (T, error) {
+	modified, err := m.modify(child)
+	if err != nil {
+		return child, err
+	}
+
+	result, ok := modified.(T)
+	if !ok {
+		return child, &ModifyError{Parent: parent, Field: field, Got: modified}
 	}
 
-	return modifier(node)
+	return result, nil
 }
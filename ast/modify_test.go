@@ -1,6 +1,7 @@
 package ast_test
 
 import (
+	"errors"
 	"fmt"
 	"gomonkey/ast"
 	"reflect"
@@ -63,6 +64,17 @@ func TestModify(t *testing.T) {
 			&ast.IndexExpression{Left: two(), Index: two()},
 		},
 
+		// スライス式
+		{
+			&ast.SliceExpression{Left: one(), Start: one(), End: one()},
+			&ast.SliceExpression{Left: two(), Start: two(), End: two()},
+		},
+		{
+			// 省略されたところは nil のまま
+			&ast.SliceExpression{Left: one(), End: one()},
+			&ast.SliceExpression{Left: two(), End: two()},
+		},
+
 		// if式
 
 		{
@@ -136,6 +148,34 @@ func TestModify(t *testing.T) {
 			},
 		},
 
+		// マクロリテラル
+		{
+			// macro() { 1 }
+			&ast.MacroLiteral{
+				Parameters: []*ast.Identifier{},
+				Body: &ast.BlockStatement{
+					Statements: []ast.Statement{
+						&ast.ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			// macro() { 2 }
+			&ast.MacroLiteral{
+				Parameters: []*ast.Identifier{},
+				Body: &ast.BlockStatement{
+					Statements: []ast.Statement{
+						&ast.ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+
+		// 呼び出し式
+		{
+			&ast.CallExpression{Function: one(), Arguments: []ast.Expression{one(), one()}},
+			&ast.CallExpression{Function: two(), Arguments: []ast.Expression{two(), two()}},
+		},
+
 		// 配列リテラル
 		{
 			&ast.ArrayLiteral{Elements: []ast.Expression{one(), one()}},
@@ -147,7 +187,10 @@ func TestModify(t *testing.T) {
 		// ノード変更関数を渡す感じ
 		t.Run(fmt.Sprintf("test#%d", i), func(t *testing.T) {
 
-			modified := ast.Modify(tt.a, turnOneIntoTwo)
+			modified, err := ast.Modify(tt.a, turnOneIntoTwo)
+			if err != nil {
+				t.Fatalf("エラーになっちゃだめだよ。err=%s", err)
+			}
 
 			equal := reflect.DeepEqual(modified, tt.b)
 			if !equal {
@@ -184,7 +227,9 @@ func TestModifyHashLiteral(t *testing.T) {
 	}
 
 	// Pairsが書き換わっていればいいので、 modified = ... みたいにしなくていい
-	ast.Modify(hashLiteral, turnOneIntoTwo)
+	if _, err := ast.Modify(hashLiteral, turnOneIntoTwo); err != nil {
+		t.Fatalf("エラーになっちゃだめだよ。err=%s", err)
+	}
 
 	for key, val := range hashLiteral.Pairs {
 		key, _ := key.(*ast.IntegerLiteral)
@@ -198,3 +243,225 @@ func TestModifyHashLiteral(t *testing.T) {
 		}
 	}
 }
+
+func TestModifyVisitsLeafNodes(t *testing.T) {
+	ident := func(name string) *ast.Identifier { return &ast.Identifier{Value: name} }
+	str := func(value string) *ast.StringLiteral { return &ast.StringLiteral{Value: value} }
+
+	// x を y に、"x" を "y" に書き換える
+	turnXIntoY := func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if node.Value == "x" {
+				return ident("y")
+			}
+		case *ast.StringLiteral:
+			if node.Value == "x" {
+				return str("y")
+			}
+		}
+
+		return node
+	}
+
+	tests := []struct {
+		a ast.Node
+		b ast.Node
+	}{
+		{ident("x"), ident("y")},
+		{str("x"), str("y")},
+		{
+			// let文の名前も辿る
+			&ast.LetStatement{Name: ident("x"), Value: ident("x")},
+			&ast.LetStatement{Name: ident("y"), Value: ident("y")},
+		},
+		{
+			// 関数の仮引数も辿る
+			&ast.FunctionLiteral{
+				Parameters: []*ast.Identifier{ident("x"), ident("z")},
+				Body:       &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: str("x")}}},
+			},
+			&ast.FunctionLiteral{
+				Parameters: []*ast.Identifier{ident("y"), ident("z")},
+				Body:       &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: str("y")}}},
+			},
+		},
+		{
+			// マクロの仮引数も辿る
+			&ast.MacroLiteral{
+				Parameters: []*ast.Identifier{ident("x")},
+				Body:       &ast.BlockStatement{Statements: []ast.Statement{}},
+			},
+			&ast.MacroLiteral{
+				Parameters: []*ast.Identifier{ident("y")},
+				Body:       &ast.BlockStatement{Statements: []ast.Statement{}},
+			},
+		},
+		{
+			&ast.ArrayLiteral{Elements: []ast.Expression{ident("x"), &ast.Boolean{Value: true}}},
+			&ast.ArrayLiteral{Elements: []ast.Expression{ident("y"), &ast.Boolean{Value: true}}},
+		},
+	}
+
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("test#%d", i), func(t *testing.T) {
+			modified, err := ast.Modify(tt.a, turnXIntoY)
+			if err != nil {
+				t.Fatalf("エラーになっちゃだめだよ。err=%s", err)
+			}
+
+			if !reflect.DeepEqual(modified, tt.b) {
+				t.Errorf("not equal. got=%#v, want=%#v", modified, tt.b)
+			}
+		})
+	}
+}
+
+func TestModifyIncompatibleNode(t *testing.T) {
+	one := func() ast.Expression { return &ast.IntegerLiteral{Value: 1} }
+
+	tests := []struct {
+		node      ast.Node
+		modifier  ast.ModifyFunc
+		wantField string
+	}{
+		{
+			// 式のところに文は入れられない
+			&ast.InfixExpression{Left: one(), Operator: "+", Right: &ast.Boolean{Value: true}},
+			func(node ast.Node) ast.Node {
+				if _, ok := node.(*ast.IntegerLiteral); ok {
+					return &ast.ReturnStatement{}
+				}
+				return node
+			},
+			"Left",
+		},
+		{
+			// nil も入れられない
+			&ast.Program{Statements: []ast.Statement{
+				&ast.ExpressionStatement{Expression: one()},
+				&ast.ReturnStatement{ReturnValue: one()},
+			}},
+			func(node ast.Node) ast.Node {
+				if _, ok := node.(*ast.ReturnStatement); ok {
+					return nil
+				}
+				return node
+			},
+			"Statements[1]",
+		},
+		{
+			// let文の名前は Identifier じゃないとだめ
+			&ast.LetStatement{Name: &ast.Identifier{Value: "x"}, Value: one()},
+			func(node ast.Node) ast.Node {
+				if _, ok := node.(*ast.Identifier); ok {
+					return one()
+				}
+				return node
+			},
+			"Name",
+		},
+		{
+			// ブロックのところにただの文は入れられない
+			&ast.FunctionLiteral{Parameters: []*ast.Identifier{}, Body: &ast.BlockStatement{}},
+			func(node ast.Node) ast.Node {
+				if _, ok := node.(*ast.BlockStatement); ok {
+					return &ast.ExpressionStatement{Expression: one()}
+				}
+				return node
+			},
+			"Body",
+		},
+	}
+
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("test#%d", i), func(t *testing.T) {
+			_, err := ast.Modify(tt.node, tt.modifier)
+
+			var modifyErr *ast.ModifyError
+			if !errors.As(err, &modifyErr) {
+				t.Fatalf("*ast.ModifyError じゃないよ。got=%T (%v)", err, err)
+			}
+
+			if modifyErr.Field != tt.wantField {
+				t.Errorf("Fieldが %q じゃないよ。got=%q", tt.wantField, modifyErr.Field)
+			}
+		})
+	}
+}
+
+func TestModifyWithHooks(t *testing.T) {
+	// -(1 + 2)
+	node := &ast.PrefixExpression{
+		Operator: "-",
+		Right: &ast.InfixExpression{
+			Left:     &ast.IntegerLiteral{Value: 1},
+			Operator: "+",
+			Right:    &ast.IntegerLiteral{Value: 2},
+		},
+	}
+
+	var visited []string
+	record := func(prefix string) ast.ModifyFunc {
+		return func(node ast.Node) ast.Node {
+			visited = append(visited, fmt.Sprintf("%s %T", prefix, node))
+			return node
+		}
+	}
+
+	if _, err := ast.ModifyWithHooks(node, record("pre"), record("post")); err != nil {
+		t.Fatalf("エラーになっちゃだめだよ。err=%s", err)
+	}
+
+	want := []string{
+		"pre *ast.PrefixExpression",
+		"pre *ast.InfixExpression",
+		"pre *ast.IntegerLiteral",
+		"post *ast.IntegerLiteral",
+		"pre *ast.IntegerLiteral",
+		"post *ast.IntegerLiteral",
+		"post *ast.InfixExpression",
+		"post *ast.PrefixExpression",
+	}
+
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("辿る順番がちがうよ。\nwant=%v\ngot =%v", want, visited)
+	}
+}
+
+func TestModifyWithHooksPreReplacesBeforeVisitingChildren(t *testing.T) {
+	// pre で 1 を (1 + 1) に置き換えると、置き換えた後のノードの子が post で 2 になる
+	pre := func(node ast.Node) ast.Node {
+		if integer, ok := node.(*ast.IntegerLiteral); ok && integer.Value == 1 {
+			return &ast.InfixExpression{
+				Left:     &ast.IntegerLiteral{Value: 10},
+				Operator: "+",
+				Right:    &ast.IntegerLiteral{Value: 10},
+			}
+		}
+		return node
+	}
+	post := func(node ast.Node) ast.Node {
+		if integer, ok := node.(*ast.IntegerLiteral); ok && integer.Value == 10 {
+			return &ast.IntegerLiteral{Value: 2}
+		}
+		return node
+	}
+
+	modified, err := ast.ModifyWithHooks(&ast.ReturnStatement{ReturnValue: &ast.IntegerLiteral{Value: 1}}, pre, post)
+	if err != nil {
+		t.Fatalf("エラーになっちゃだめだよ。err=%s", err)
+	}
+
+	want := &ast.ReturnStatement{ReturnValue: &ast.InfixExpression{
+		Left:     &ast.IntegerLiteral{Value: 2},
+		Operator: "+",
+		Right:    &ast.IntegerLiteral{Value: 2},
+	}}
+
+	if !reflect.DeepEqual(modified, want) {
+		t.Errorf("not equal. got=%#v, want=%#v", modified, want)
+	}
+}
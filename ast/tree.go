@@ -0,0 +1,244 @@
+package ast
+
+import (
+	"fmt"
+	"gomonkey/token"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// String() だと全部1行にくっついちゃうので、ノードの型とフィールドを木にして見るためのもの。
+// 子ノードには JSON と同じフィールド名を付ける(配列なら "arguments[0]" みたいに番号も)。
+
+// treeNode はノード1個の見た目。attrs は子ノードじゃないフィールド(`operator "+"` とか)
+type treeNode struct {
+	kind     string
+	pos      token.Position
+	attrs    []string
+	children []treeChild
+}
+
+type treeChild struct {
+	field string
+	node  Node
+}
+
+func describe(node Node) treeNode {
+	t := treeNode{kind: strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")}
+
+	child := func(field string, n Node) {
+		if !isNilNode(n) {
+			t.children = append(t.children, treeChild{field: field, node: n})
+		}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for i, stmt := range n.Statements {
+			child(fmt.Sprintf("statements[%d]", i), stmt)
+		}
+
+	case *LetStatement:
+		t.pos = n.Token.Pos
+		if n.Name != nil {
+			child("name", n.Name)
+		}
+		child("value", n.Value)
+
+	case *ReturnStatement:
+		t.pos = n.Token.Pos
+		child("value", n.ReturnValue)
+
+	case *ExpressionStatement:
+		t.pos = n.Token.Pos
+		child("expression", n.Expression)
+
+	case *BlockStatement:
+		t.pos = n.Token.Pos
+		for i, stmt := range n.Statements {
+			child(fmt.Sprintf("statements[%d]", i), stmt)
+		}
+
+	case *Identifier:
+		t.pos = n.Token.Pos
+		t.attrs = append(t.attrs, "value "+strconv.Quote(n.Value))
+
+	case *IntegerLiteral:
+		t.pos = n.Token.Pos
+		t.attrs = append(t.attrs, "value "+integerLiteralText(n))
+
+	case *StringLiteral:
+		t.pos = n.Token.Pos
+		t.attrs = append(t.attrs, "value "+strconv.Quote(n.Value))
+
+	case *Boolean:
+		t.pos = n.Token.Pos
+		t.attrs = append(t.attrs, "value "+strconv.FormatBool(n.Value))
+
+	case *PrefixExpression:
+		t.pos = n.Token.Pos
+		t.attrs = append(t.attrs, "operator "+strconv.Quote(n.Operator))
+		child("right", n.Right)
+
+	case *InfixExpression:
+		t.pos = n.Token.Pos
+		t.attrs = append(t.attrs, "operator "+strconv.Quote(n.Operator))
+		child("left", n.Left)
+		child("right", n.Right)
+
+	case *IfExpression:
+		t.pos = n.Token.Pos
+		child("condition", n.Condition)
+		if n.Consequence != nil {
+			child("consequence", n.Consequence)
+		}
+		if n.Alternative != nil {
+			child("alternative", n.Alternative)
+		}
+
+	case *FunctionLiteral:
+		t.pos = n.Token.Pos
+		for i, param := range n.Parameters {
+			child(fmt.Sprintf("parameters[%d]", i), param)
+		}
+		if n.Body != nil {
+			child("body", n.Body)
+		}
+
+	case *MacroLiteral:
+		t.pos = n.Token.Pos
+		for i, param := range n.Parameters {
+			child(fmt.Sprintf("parameters[%d]", i), param)
+		}
+		if n.Body != nil {
+			child("body", n.Body)
+		}
+
+	case *CallExpression:
+		t.pos = n.Token.Pos
+		child("function", n.Function)
+		for i, arg := range n.Arguments {
+			child(fmt.Sprintf("arguments[%d]", i), arg)
+		}
+
+	case *ArrayLiteral:
+		t.pos = n.Token.Pos
+		for i, elem := range n.Elements {
+			child(fmt.Sprintf("elements[%d]", i), elem)
+		}
+
+	case *IndexExpression:
+		t.pos = n.Token.Pos
+		child("left", n.Left)
+		child("index", n.Index)
+
+	case *SliceExpression:
+		t.pos = n.Token.Pos
+		child("left", n.Left)
+		child("start", n.Start)
+		child("end", n.End)
+
+	case *HashLiteral:
+		t.pos = n.Token.Pos
+		for i, key := range sortedHashKeys(n) {
+			child(fmt.Sprintf("key[%d]", i), key)
+			child(fmt.Sprintf("value[%d]", i), n.Pairs[key])
+		}
+
+	case *QuoteExpression:
+		t.pos = n.Token.Pos
+		child("expression", n.Expression)
+
+	case *UnquoteExpression:
+		t.pos = n.Token.Pos
+		if n.Splicing() {
+			t.attrs = append(t.attrs, "splicing")
+		}
+		child("expression", n.Expression)
+
+	case *NullLiteral:
+		t.pos = n.Token.Pos
+	}
+
+	return t
+}
+
+// label は "InfixExpression 1:3 operator "+"" みたいに、型と位置とフィールドを1行にしたもの
+func (t treeNode) label(sep string) string {
+	parts := []string{t.kind}
+	if t.pos.IsValid() {
+		parts = append(parts, t.pos.String())
+	}
+
+	return strings.Join(append(parts, t.attrs...), sep)
+}
+
+// WriteTree は node を字下げした木にして書く。
+//
+//	Program
+//	  statements[0]: LetStatement 1:1
+//	    name: Identifier 1:5 value "x"
+//	    value: InfixExpression 1:11 operator "+"
+//	      left: IntegerLiteral 1:9 value 1
+//	      right: IntegerLiteral 1:13 value 2
+func WriteTree(w io.Writer, node Node) error {
+	var out strings.Builder
+	writeTree(&out, "", node, 0)
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func writeTree(out *strings.Builder, field string, node Node, depth int) {
+	t := describe(node)
+
+	out.WriteString(strings.Repeat("  ", depth))
+	if field != "" {
+		out.WriteString(field + ": ")
+	}
+	out.WriteString(t.label(" ") + "\n")
+
+	for _, c := range t.children {
+		writeTree(out, c.field, c.node, depth+1)
+	}
+}
+
+// WriteDot は node を Graphviz の dot 言語で書く。`dot -Tsvg` とかで絵にできる。
+// ノードの箱には型と位置とフィールドを、矢印には子ノードのフィールド名を書く。
+func WriteDot(w io.Writer, node Node) error {
+	var out strings.Builder
+	out.WriteString("digraph AST {\n")
+	out.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+
+	id := 0
+	var write func(node Node) int
+	write = func(node Node) int {
+		me := id
+		id++
+
+		t := describe(node)
+		fmt.Fprintf(&out, "  n%d [label=%s];\n", me, dotQuote(t.label("\n")))
+		for _, c := range t.children {
+			child := write(c.node)
+			fmt.Fprintf(&out, "  n%d -> n%d [label=%s];\n", me, child, dotQuote(c.field))
+		}
+
+		return me
+	}
+	write(node)
+
+	out.WriteString("}\n")
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// dotQuote は dot の "" で囲んだ文字列にする。改行は \n(中央揃え)に、" と \ はエスケープする
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+
+	return `"` + s + `"`
+}
@@ -0,0 +1,90 @@
+package ast_test
+
+import (
+	"gomonkey/ast"
+	"strings"
+	"testing"
+)
+
+func TestWriteTree(t *testing.T) {
+	program := parseProgram(t, `let f = fn(a) { if (!a) { a[1:] } else { {"k": [a]} } };
+f(1);`)
+
+	var out strings.Builder
+	if err := ast.WriteTree(&out, program); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Program
+  statements[0]: LetStatement 1:1
+    name: Identifier 1:5 value "f"
+    value: FunctionLiteral 1:9
+      parameters[0]: Identifier 1:12 value "a"
+      body: BlockStatement 1:15
+        statements[0]: ExpressionStatement 1:17
+          expression: IfExpression 1:17
+            condition: PrefixExpression 1:21 operator "!"
+              right: Identifier 1:22 value "a"
+            consequence: BlockStatement 1:25
+              statements[0]: ExpressionStatement 1:27
+                expression: SliceExpression 1:28
+                  left: Identifier 1:27 value "a"
+                  start: IntegerLiteral 1:29 value 1
+            alternative: BlockStatement 1:40
+              statements[0]: ExpressionStatement 1:42
+                expression: HashLiteral 1:42
+                  key[0]: StringLiteral 1:43 value "k"
+                  value[0]: ArrayLiteral 1:48
+                    elements[0]: Identifier 1:49 value "a"
+  statements[1]: ExpressionStatement 2:1
+    expression: CallExpression 2:2
+      function: Identifier 2:1 value "f"
+      arguments[0]: IntegerLiteral 2:3 value 1
+`
+	if out.String() != expected {
+		t.Errorf("木がおかしいよ。\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteDot(t *testing.T) {
+	program := parseProgram(t, `"a" + b;`)
+
+	var out strings.Builder
+	if err := ast.WriteDot(&out, program); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `digraph AST {
+  node [shape=box, fontname="monospace"];
+  n0 [label="Program"];
+  n1 [label="ExpressionStatement\n1:1"];
+  n2 [label="InfixExpression\n1:5\noperator \"+\""];
+  n3 [label="StringLiteral\n1:1\nvalue \"a\""];
+  n2 -> n3 [label="left"];
+  n4 [label="Identifier\n1:7\nvalue \"b\""];
+  n2 -> n4 [label="right"];
+  n1 -> n2 [label="expression"];
+  n0 -> n1 [label="statements[0]"];
+}
+`
+	if out.String() != expected {
+		t.Errorf("dot がおかしいよ。\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteTreeIntegerValue(t *testing.T) {
+	program := parseProgram(t, "010")
+
+	var out strings.Builder
+	if err := ast.WriteTree(&out, program); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Program
+  statements[0]: ExpressionStatement 1:1
+    expression: IntegerLiteral 1:1 value 8
+`
+	if out.String() != expected {
+		t.Errorf("木がおかしいよ。\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
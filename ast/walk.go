@@ -0,0 +1,205 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Visitor は Walk で辿るときに各ノードで呼ばれる。go/ast の Visitor と同じ考え方。
+// Visit が返した Visitor w が nil じゃなければ、node の子ノードを w で辿って、最後に w.Visit(nil) を呼ぶ。
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk は node を行きがけ順で辿る。Modify と違ってノードは書き換えない。
+// 省略されている子ノード(else節とか)は nil なので辿らない。
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *ExpressionStatement:
+		walkIfNotNil(v, n.Expression)
+
+	case *LetStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		walkIfNotNil(v, n.Value)
+
+	case *ReturnStatement:
+		walkIfNotNil(v, n.ReturnValue)
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *InfixExpression:
+		walkIfNotNil(v, n.Left)
+		walkIfNotNil(v, n.Right)
+
+	case *PrefixExpression:
+		walkIfNotNil(v, n.Right)
+
+	case *IndexExpression:
+		walkIfNotNil(v, n.Left)
+		walkIfNotNil(v, n.Index)
+
+	case *SliceExpression:
+		walkIfNotNil(v, n.Left)
+		walkIfNotNil(v, n.Start)
+		walkIfNotNil(v, n.End)
+
+	case *IfExpression:
+		walkIfNotNil(v, n.Condition)
+		if n.Consequence != nil {
+			Walk(v, n.Consequence)
+		}
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+
+	case *FunctionLiteral:
+		walkIdentifiers(v, n.Parameters)
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *MacroLiteral:
+		walkIdentifiers(v, n.Parameters)
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *CallExpression:
+		walkIfNotNil(v, n.Function)
+		walkExpressions(v, n.Arguments)
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *HashLiteral:
+		for _, key := range sortedHashKeys(n) {
+			Walk(v, key)
+			walkIfNotNil(v, n.Pairs[key])
+		}
+
+	case *QuoteExpression:
+		walkIfNotNil(v, n.Expression)
+
+	case *UnquoteExpression:
+		walkIfNotNil(v, n.Expression)
+
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean, *NullLiteral:
+		// 子ノードを持たないやつら
+
+	default:
+		// Modify と同じで、新しいノードを足したのにここを直し忘れたらすぐ気づけるようにする
+		panic(fmt.Sprintf("ast.Walk: unknown node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkIfNotNil(v Visitor, node Node) {
+	// Expression のフィールドに入った nil は interface の nil なので、これで弾ける
+	if node != nil {
+		Walk(v, node)
+	}
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+	for _, stmt := range statements {
+		walkIfNotNil(v, stmt)
+	}
+}
+
+func walkExpressions(v Visitor, expressions []Expression) {
+	for _, expr := range expressions {
+		walkIfNotNil(v, expr)
+	}
+}
+
+func walkIdentifiers(v Visitor, identifiers []*Identifier) {
+	for _, ident := range identifiers {
+		if ident != nil {
+			Walk(v, ident)
+		}
+	}
+}
+
+// sortedHashKeys は HashLiteral のキーを String() の順に並べて返す。
+// Pairs はマップなので、そのまま range すると辿る順番が毎回変わっちゃう。
+func sortedHashKeys(hl *HashLiteral) []Expression {
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	return keys
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect は node を行きがけ順で辿って f(node) を呼ぶ。f が false を返したら、そのノードの子ノードは辿らない。
+// 子ノードを辿り終わったら f(nil) が呼ばれる。
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// parentTracker は今いるノードまでの親をスタックで覚えておく Visitor
+type parentTracker struct {
+	f       func(node Node, parents []Node) bool
+	parents []Node
+}
+
+func (p *parentTracker) Visit(node Node) Visitor {
+	if node == nil {
+		// 子ノードを辿り終わったので、自分をスタックから降ろす
+		p.parents = p.parents[:len(p.parents)-1]
+		return nil
+	}
+
+	if !p.f(node, p.parents) {
+		return nil
+	}
+
+	p.parents = append(p.parents, node)
+
+	return p
+}
+
+// InspectWithParents は Inspect と同じように辿るけど、f に親ノードの列も渡す。
+// parents[0] が一番外側(ふつうは *Program)で、parents[len(parents)-1] が直接の親。ルートのときは空。
+// parents は辿っている途中で書き換わるので、取っておきたいときはコピーしてね。
+func InspectWithParents(node Node, f func(node Node, parents []Node) bool) {
+	Walk(&parentTracker{f: f}, node)
+}
+
+// Parents はルートから辿れる全ノードについて「直接の親」を引けるマップを作る。ルートは入らない。
+func Parents(root Node) map[Node]Node {
+	parents := make(map[Node]Node)
+
+	InspectWithParents(root, func(node Node, ancestors []Node) bool {
+		if len(ancestors) > 0 {
+			parents[node] = ancestors[len(ancestors)-1]
+		}
+		return true
+	})
+
+	return parents
+}
@@ -0,0 +1,188 @@
+package ast_test
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/lexer"
+	"gomonkey/parser"
+	"reflect"
+	"testing"
+)
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("パースエラーだよ。%v", p.Errors())
+	}
+
+	return program
+}
+
+func nodeTypes(nodes []ast.Node) []string {
+	var types []string
+	for _, node := range nodes {
+		types = append(types, fmt.Sprintf("%T", node))
+	}
+	return types
+}
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"let x = -1;",
+			[]string{"*ast.Program", "*ast.LetStatement", "*ast.Identifier", "*ast.PrefixExpression", "*ast.IntegerLiteral"},
+		},
+		{
+			"return a[1:];",
+			[]string{"*ast.Program", "*ast.ReturnStatement", "*ast.SliceExpression", "*ast.Identifier", "*ast.IntegerLiteral"},
+		},
+		{
+			"fn(a) { a + 1 }(2)",
+			[]string{
+				"*ast.Program", "*ast.ExpressionStatement", "*ast.CallExpression",
+				"*ast.FunctionLiteral", "*ast.Identifier", "*ast.BlockStatement", "*ast.ExpressionStatement",
+				"*ast.InfixExpression", "*ast.Identifier", "*ast.IntegerLiteral",
+				"*ast.IntegerLiteral",
+			},
+		},
+		{
+			`if (true) { "yes" } else { [macro(m) { m }] }`,
+			[]string{
+				"*ast.Program", "*ast.ExpressionStatement", "*ast.IfExpression",
+				"*ast.Boolean",
+				"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.StringLiteral",
+				"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.ArrayLiteral",
+				"*ast.MacroLiteral", "*ast.Identifier", "*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.Identifier",
+			},
+		},
+		{
+			// キーの String() 順に辿る
+			`{"b": 2, "a": x[1]}`,
+			[]string{
+				"*ast.Program", "*ast.ExpressionStatement", "*ast.HashLiteral",
+				"*ast.StringLiteral", "*ast.IndexExpression", "*ast.Identifier", "*ast.IntegerLiteral",
+				"*ast.StringLiteral", "*ast.IntegerLiteral",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			program := parseProgram(t, tt.input)
+			before := program.String()
+
+			var visited []ast.Node
+			ast.Inspect(program, func(node ast.Node) bool {
+				if node != nil {
+					visited = append(visited, node)
+				}
+				return true
+			})
+
+			if got := nodeTypes(visited); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("辿る順番がちがうよ。\nwant=%v\ngot =%v", tt.expected, got)
+			}
+
+			if program.String() != before {
+				t.Errorf("Inspect でプログラムが書き換わっちゃってるよ。got=%q, want=%q", program.String(), before)
+			}
+		})
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := parseProgram(t, "let f = fn(x) { x }; f(y);")
+
+	// 関数リテラルの中には入らないので、x は出てこない
+	var names []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.Identifier:
+			names = append(names, node.Value)
+		}
+		return true
+	})
+
+	expected := []string{"f", "f", "y"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("識別子がちがうよ。want=%v, got=%v", expected, names)
+	}
+}
+
+func TestInspectCallsNilAfterChildren(t *testing.T) {
+	program := parseProgram(t, "-1")
+
+	var events []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			events = append(events, "end")
+		} else {
+			events = append(events, fmt.Sprintf("%T", node))
+		}
+		return true
+	})
+
+	expected := []string{
+		"*ast.Program", "*ast.ExpressionStatement", "*ast.PrefixExpression", "*ast.IntegerLiteral",
+		"end", "end", "end", "end",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("呼ばれる順番がちがうよ。\nwant=%v\ngot =%v", expected, events)
+	}
+}
+
+func TestInspectWithParents(t *testing.T) {
+	program := parseProgram(t, "let f = fn(a) { a * 2 }; a;")
+
+	var got [][]string
+	ast.InspectWithParents(program, func(node ast.Node, parents []ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok && ident.Value == "a" {
+			got = append(got, nodeTypes(parents))
+		}
+		return true
+	})
+
+	expected := [][]string{
+		// 仮引数の a
+		{"*ast.Program", "*ast.LetStatement", "*ast.FunctionLiteral"},
+		// 関数本体の a
+		{"*ast.Program", "*ast.LetStatement", "*ast.FunctionLiteral", "*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.InfixExpression"},
+		// 外側の a
+		{"*ast.Program", "*ast.ExpressionStatement"},
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("親ノードがちがうよ。\nwant=%v\ngot =%v", expected, got)
+	}
+}
+
+func TestParents(t *testing.T) {
+	program := parseProgram(t, "x + 1")
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	infix := stmt.Expression.(*ast.InfixExpression)
+
+	parents := ast.Parents(program)
+
+	if _, ok := parents[program]; ok {
+		t.Errorf("ルートに親がいちゃだめだよ")
+	}
+	if parents[stmt] != program {
+		t.Errorf("文の親が *ast.Program じゃないよ。got=%T", parents[stmt])
+	}
+	if parents[infix] != stmt {
+		t.Errorf("中置演算式の親が *ast.ExpressionStatement じゃないよ。got=%T", parents[infix])
+	}
+	if parents[infix.Left] != infix || parents[infix.Right] != infix {
+		t.Errorf("オペランドの親が *ast.InfixExpression じゃないよ。got=%T, %T", parents[infix.Left], parents[infix.Right])
+	}
+}
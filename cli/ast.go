@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gomonkey/ast"
+	"io"
+)
+
+// runAST は `gomonkey ast [-dot] file.mk`。
+// パースしたプログラム(マクロは展開しない)の AST を、ノードの型とフィールドの木にして表示する。
+// -dot なら Graphviz の dot 言語で書き出すので、`gomonkey ast -dot file.mk | dot -Tsvg > ast.svg` で絵にできる。
+func runAST(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dot := flags.Bool("dot", false, "Graphviz の dot 言語で書き出す")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		_, _ = io.WriteString(stderr, "usage: gomonkey ast [-dot] file.mk\n")
+		return 2
+	}
+
+	program, ok := parseFile(flags.Arg(0), stderr)
+	if !ok {
+		return 1
+	}
+
+	write := ast.WriteTree
+	if *dot {
+		write = ast.WriteDot
+	}
+
+	if err := write(stdout, program); err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+
+	return 0
+}
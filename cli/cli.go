@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/lexer"
+	"gomonkey/parser"
+	"io"
+	"os"
+)
+
+const usage = `usage: gomonkey <command> [arguments]
+
+commands:
+	tokens [-json] file.mk     レキサーが出すトークンを位置と種類とリテラルつきで表示する。-json なら JSON で書き出す
+	parse [-json] [-trace] file.mk
+	                           パースしたプログラムを表示する。-json なら AST を JSON で書き出す。
+	                           -trace ならパース関数の呼び出しと優先順位の判断を stderr に書き出す
+	ast [-dot] file.mk         AST をノードの型とフィールドの木にして表示する。-dot なら Graphviz の dot で書き出す
+	expand [-trace] file.mk    マクロを展開したプログラムを整形して表示する
+	run [-allow fs,os,time] [-no-optimize] [-trace] [-profile] [-pprof out.pb.gz] file.mk [args...]
+	                           プログラムを実行する。fs / os / time のモジュールは -allow で許可したものだけ使える。
+	                           定数の畳み込みとかの最適化をしてから評価する。-no-optimize ならしない。
+	                           -trace なら評価したノードと結果を stderr に書く。
+	                           トレースされるのは最適化した後のプログラムなので、書いたとおりに見たければ -no-optimize もつける。
+	                           -profile なら関数ごとの時間の表を stderr に、-pprof なら pprof 形式で書き出す
+	test [-allow fs,os,time] [-cover] [-coverprofile lcov.info] [path...]
+	                           *_test.mk の test_ で始まる関数を1個ずつ実行する。-cover なら文と if の枝の網羅率を書く
+	debug [-allow fs,os,time] file.mk [args...]
+	                           プログラムをステップ実行する。-dap なら Debug Adapter Protocol で動く
+	lsp                        stdin/stdout で Language Server として動く
+`
+
+// Run は `gomonkey <command> [arguments]` を実行して、終了コードを返す。
+// 引数なしの `gomonkey` (REPL) は main の担当なのでここには来ない。
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		_, _ = io.WriteString(stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "tokens":
+		return runTokens(args[1:], stdout, stderr)
+	case "parse":
+		return runParse(args[1:], stdout, stderr)
+	case "ast":
+		return runAST(args[1:], stdout, stderr)
+	case "expand":
+		return runExpand(args[1:], stdout, stderr)
+	case "run":
+		return runRun(args[1:], stdin, stdout, stderr)
+	case "test":
+		return runTest(args[1:], stdin, stdout, stderr)
+	case "debug":
+		return runDebug(args[1:], stdin, stdout, stderr)
+	case "lsp":
+		return runLSP(args[1:], stdin, stdout, stderr)
+	default:
+		_, _ = fmt.Fprintf(stderr, "unknown command: %s\n", args[0])
+		_, _ = io.WriteString(stderr, usage)
+		return 2
+	}
+}
+
+// parseFile はファイルを読んでパースする。パースエラーがあったら stderr に書いて false を返す。
+// options は parser.New にそのまま渡す(parse -trace の parser.WithTrace とか)。
+func parseFile(path string, stderr io.Writer, options ...parser.Option) (*ast.Program, bool) {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return nil, false
+	}
+
+	p := parser.New(lexer.New(string(input)), options...)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		_, _ = fmt.Fprintf(stderr, "%s: parser errors:\n", path)
+		for _, msg := range p.Errors() {
+			_, _ = fmt.Fprintf(stderr, "\t%s\n", msg)
+		}
+		return nil, false
+	}
+
+	return program, true
+}
+
+// printProgram は文を1行ずつ書き出す。Program.String() だと全部1行にくっついちゃうので。
+func printProgram(out io.Writer, program *ast.Program) {
+	for _, stmt := range program.Statements {
+		_, _ = fmt.Fprintln(out, stmt.String())
+	}
+}
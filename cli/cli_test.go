@@ -0,0 +1,539 @@
+package cli_test
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/cli"
+	"gomonkey/format"
+	"gomonkey/lexer"
+	"gomonkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeScript はテスト用の .mk ファイルを一時ディレクトリに作ってパスを返す
+func writeScript(t *testing.T, input string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatalf("スクリプトを書き込めないよ: %s", err)
+	}
+
+	return path
+}
+
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr strings.Builder
+	code := cli.Run(args, strings.NewReader(""), &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	code, _, stderr := runCLI("nope")
+
+	if code != 2 {
+		t.Errorf("終了コードが 2 じゃないよ。got=%d", code)
+	}
+
+	if !strings.Contains(stderr, "unknown command: nope") {
+		t.Errorf("エラーメッセージがおかしいよ。got=%q", stderr)
+	}
+}
+
+func TestRunExpand(t *testing.T) {
+	path := writeScript(t, `
+let unless = macro(condition, consequence, alternative) {
+	quote(if (!(unquote(condition))) { unquote(consequence); } else { unquote(alternative); });
+};
+let x = 1;
+unless(x > 5, puts("not greater"), puts("greater"));
+`)
+
+	code, stdout, stderr := runCLI("expand", path)
+	if code != 0 {
+		t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr)
+	}
+
+	// マクロ定義は消えて、format で整形されて出てくる
+	expected := "let x = 1;\n" +
+		"if (!(x > 5)) {\n\tputs(\"not greater\");\n} else {\n\tputs(\"greater\");\n}\n"
+
+	if stdout != expected {
+		t.Errorf("want=%q, got=%q", expected, stdout)
+	}
+
+	// 展開結果はそのままパースし直せて、整形し直しても変わらない
+	formatted, err := format.Source(stdout)
+	if err != nil {
+		t.Fatalf("展開結果がパースし直せないよ。err=%s", err)
+	}
+	if formatted != stdout {
+		t.Errorf("整形し直したら変わっちゃったよ。got=%q", formatted)
+	}
+}
+
+func TestRunExpandTrace(t *testing.T) {
+	path := writeScript(t, `
+let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+reverse(2 + 2, 10 - 5);
+`)
+
+	code, stdout, stderr := runCLI("expand", "-trace", path)
+	if code != 0 {
+		t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr)
+	}
+
+	if stdout != "10 - 5 - (2 + 2);\n" {
+		t.Errorf("展開結果がおかしいよ。got=%q", stdout)
+	}
+
+	if !strings.Contains(stderr, "macro call: reverse\n") || !strings.Contains(stderr, "\t=> ((10 - 5) - (2 + 2))\n") {
+		t.Errorf("トレースが出てないよ。got=%q", stderr)
+	}
+}
+
+func TestRunExpandParseError(t *testing.T) {
+	path := writeScript(t, `let = 1;`)
+
+	code, _, stderr := runCLI("expand", path)
+	if code != 1 {
+		t.Errorf("終了コードが 1 じゃないよ。got=%d", code)
+	}
+
+	if !strings.Contains(stderr, "parser errors:") {
+		t.Errorf("パースエラーが出てないよ。got=%q", stderr)
+	}
+}
+
+func TestRunParse(t *testing.T) {
+	path := writeScript(t, "let x = 1;\nx + 2;\n")
+
+	code, stdout, stderr := runCLI("parse", path)
+	if code != 0 {
+		t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr)
+	}
+
+	expected := "let x = 1;\n(x + 2)\n"
+	if stdout != expected {
+		t.Errorf("出力がちがうよ。got=%q, want=%q", stdout, expected)
+	}
+}
+
+func TestRunParseJSON(t *testing.T) {
+	input := "let add = fn(a, b) { a + b };\nadd(1, [2][0]);\n"
+	path := writeScript(t, input)
+
+	code, stdout, stderr := runCLI("parse", "--json", path)
+	if code != 0 {
+		t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr)
+	}
+
+	if !strings.Contains(stdout, `"kind": "FunctionLiteral"`) {
+		t.Errorf("JSON に kind が入ってないよ。got=%s", stdout)
+	}
+
+	// 出力した JSON を読み戻すと、同じプログラムになる
+	decoded, err := ast.DecodeJSON([]byte(stdout))
+	if err != nil {
+		t.Fatalf("デコードでエラーになっちゃだめだよ。err=%s", err)
+	}
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	if decoded.String() != program.String() {
+		t.Errorf("元に戻ってないよ。got=%q, want=%q", decoded.String(), program.String())
+	}
+}
+
+func TestRunParseUsage(t *testing.T) {
+	code, _, stderr := runCLI("parse")
+
+	if code != 2 {
+		t.Errorf("終了コードが 2 じゃないよ。got=%d", code)
+	}
+
+	if !strings.Contains(stderr, "usage: gomonkey parse") {
+		t.Errorf("usage が出てないよ。got=%q", stderr)
+	}
+}
+
+func TestRunRun(t *testing.T) {
+	path := writeScript(t, `
+let unless = macro(condition, consequence) {
+	quote(if (!(unquote(condition))) { unquote(consequence) });
+};
+unless(false, puts("hello"));
+puts(os.args());
+os.exit_code(3);
+`)
+
+	code, stdout, stderr := runCLI("run", "-allow", "os", path, "a", "b")
+	if code != 3 {
+		t.Fatalf("終了コードが 3 じゃないよ。got=%d, stderr=%q", code, stderr)
+	}
+
+	if stdout != "hello\n[a, b]\n" {
+		t.Errorf("stdout がおかしいよ。got=%q", stdout)
+	}
+}
+
+func TestRunRunWithoutCapability(t *testing.T) {
+	path := writeScript(t, `puts("before"); os.exit_code(3); puts("after");`)
+
+	code, stdout, stderr := runCLI("run", path)
+	if code != 1 {
+		t.Fatalf("終了コードが 1 じゃないよ。got=%d", code)
+	}
+
+	if stdout != "before\n" {
+		t.Errorf("stdout がおかしいよ。got=%q", stdout)
+	}
+
+	if !strings.Contains(stderr, "identifier not found: os.exit_code") {
+		t.Errorf("エラーメッセージがおかしいよ。got=%q", stderr)
+	}
+}
+
+func TestRunRunUnknownCapability(t *testing.T) {
+	code, _, stderr := runCLI("run", "-allow", "net", "script.mk")
+	if code != 2 {
+		t.Fatalf("終了コードが 2 じゃないよ。got=%d", code)
+	}
+
+	if !strings.Contains(stderr, `unknown capability "net"`) {
+		t.Errorf("エラーメッセージがおかしいよ。got=%q", stderr)
+	}
+}
+
+func TestRunRunProfile(t *testing.T) {
+	path := writeScript(t, `let double = fn(x) { x * 2 };
+puts(double(double(1)));
+`)
+	pprofPath := filepath.Join(t.TempDir(), "out.pb.gz")
+
+	code, stdout, stderr := runCLI("run", "-profile", "-pprof", pprofPath, path)
+	if code != 0 {
+		t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr)
+	}
+
+	if stdout != "4\n" {
+		t.Errorf("stdout がおかしいよ。got=%q", stdout)
+	}
+
+	for _, want := range []string{"double (" + path + ":1:14)", "puts (builtin)", "CallExpression"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("レポートに %q がないよ。got=%q", want, stderr)
+		}
+	}
+
+	if info, err := os.Stat(pprofPath); err != nil || info.Size() == 0 {
+		t.Errorf("pprof のファイルが書かれてないよ: %v", err)
+	}
+}
+
+func TestRunLSP(t *testing.T) {
+	var in strings.Builder
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	} {
+		in.WriteString(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body))
+	}
+
+	var stdout, stderr strings.Builder
+	code := cli.Run([]string{"lsp"}, strings.NewReader(in.String()), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr.String())
+	}
+
+	if !strings.Contains(stdout.String(), `"id":2,"result":null`) {
+		t.Errorf("shutdown の返事がないよ。got=%q", stdout.String())
+	}
+}
+
+func TestRunDebug(t *testing.T) {
+	path := writeScript(t, `let add = fn(a, b) {
+	let c = a + b;
+	c
+};
+let x = add(1, 2);
+puts(x);
+`)
+
+	commands := "break 2\ncontinue\nlocals\nbacktrace\nprint a * 10\nout\ncontinue\n"
+
+	var stdout, stderr strings.Builder
+	code := cli.Run([]string{"debug", path}, strings.NewReader(commands), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr.String())
+	}
+
+	expected := strings.Join([]string{
+		"stopped at " + path + ":1 (entry)",
+		"    1\tlet add = fn(a, b) {",
+		"(gomonkey) breakpoint set at " + path + ":2",
+		"(gomonkey) stopped at " + path + ":2 (breakpoint)",
+		"    2\t\tlet c = a + b;",
+		"(gomonkey) a = 1",
+		"b = 2",
+		"(gomonkey) #0 add at " + path + ":2",
+		"#1 <main> at " + path + ":5",
+		"(gomonkey) 10",
+		"(gomonkey) stopped at " + path + ":6 (step)",
+		"    6\tputs(x);",
+		"(gomonkey) 3",
+		"",
+	}, "\n")
+	if stdout.String() != expected {
+		t.Errorf("stdout がおかしいよ。\nwant=%q\ngot =%q", expected, stdout.String())
+	}
+}
+
+func TestRunDebugQuit(t *testing.T) {
+	path := writeScript(t, `puts("before"); puts("after");`)
+
+	var stdout, stderr strings.Builder
+	code := cli.Run([]string{"debug", path}, strings.NewReader("step\nquit\n"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr.String())
+	}
+
+	if !strings.Contains(stdout.String(), "before\n") || strings.Contains(stdout.String(), "after\n") {
+		t.Errorf("quit したら残りは実行しないはずだよ。got=%q", stdout.String())
+	}
+}
+
+func TestRunTest(t *testing.T) {
+	dir := t.TempDir()
+	for name, input := range map[string]string{
+		"ok_test.mk": `let double = fn(x) { if (x > 0) { x * 2 } else { 0 } };
+let test_double = fn() { assert_eq(double(2), 4) };`,
+		"math_test.mk": `let test_add = fn() {
+	assert_eq(1 + 1, 2);
+};
+let test_list = fn() {
+	let xs = [1, 2, 3];
+	assert_eq(xs, [1, 2, 4], "list");
+};`,
+		"broken_test.mk": `1 + true;`,
+		"lib.mk":         `this is not a test file`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(input), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lcovPath := filepath.Join(t.TempDir(), "lcov.info")
+
+	code, stdout, stderr := runCLI("test", "--cover", "-coverprofile", lcovPath, dir)
+	if code != 1 {
+		t.Fatalf("終了コードが 1 じゃないよ。got=%d, stderr=%q", code, stderr)
+	}
+
+	broken := filepath.Join(dir, "broken_test.mk")
+	math := filepath.Join(dir, "math_test.mk")
+	for _, want := range []string{
+		"FAIL\t" + broken + "\n    " + broken + ":1: type mismatch: INTEGER + BOOLEAN\n",
+		"--- PASS: test_add (" + math + ":1)\n",
+		"--- FAIL: test_list (" + math + ":4)\n    " + math + ":6: assert_eq failed: list\n" +
+			"    \tgot:  [1, 2, 3]\n    \twant: [1, 2, 4]\n    \tdiff: at [2]: got 3, want 4\n",
+		"FAIL\t" + math + "\t(1 passed, 1 failed)\n",
+		"ok\t" + filepath.Join(dir, "ok_test.mk") + "\t(1 passed)\n",
+		filepath.Join(dir, "ok_test.mk") + ": 83.3% of statements (5/6), 50.0% of branches (1/2)\n",
+		"\nFAIL\n",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout に %q がないよ。got=%q", want, stdout)
+		}
+	}
+
+	lcov, err := os.ReadFile(lcovPath)
+	if err != nil {
+		t.Fatalf("LCOV が書かれてないよ: %s", err)
+	}
+	if !strings.Contains(string(lcov), "SF:"+filepath.Join(dir, "ok_test.mk")+"\n") || !strings.Contains(string(lcov), "end_of_record\n") {
+		t.Errorf("LCOV がおかしいよ。got=%q", lcov)
+	}
+}
+
+func TestRunTestNoFiles(t *testing.T) {
+	code, stdout, _ := runCLI("test", t.TempDir())
+	if code != 0 || stdout != "no test files\n" {
+		t.Errorf("テストファイルがないときがおかしいよ。code=%d, stdout=%q", code, stdout)
+	}
+}
+
+func TestRunParseTrace(t *testing.T) {
+	path := writeScript(t, "1 + 2;\n")
+
+	code, stdout, stderr := runCLI("parse", "-trace", path)
+	if code != 0 {
+		t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr)
+	}
+
+	if stdout != "(1 + 2)\n" {
+		t.Errorf("stdout はプログラムだけのはずだよ。got=%q", stdout)
+	}
+	if !strings.HasPrefix(stderr, "parseExpressionStatement 1:1\n") || !strings.Contains(stderr, "    peek \"+\" SUM > LOWEST: infix\n") {
+		t.Errorf("トレースが出てないよ。got=%q", stderr)
+	}
+}
+
+func TestRunRunTrace(t *testing.T) {
+	path := writeScript(t, "let x = 2;\nputs(x * 3);\n")
+
+	code, stdout, stderr := runCLI("run", "-no-optimize", "-trace", "-profile", path)
+	if code != 0 {
+		t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr)
+	}
+
+	if stdout != "6\n" {
+		t.Errorf("stdout はプログラムの出力だけのはずだよ。got=%q", stdout)
+	}
+
+	// -profile といっしょでもトレースは出る
+	for _, want := range []string{"env 0   let x = 2;\n", "env 0       (x * 3) => 6\n", "call puts(6)\n", "total time:"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr に %q がないよ。got=%q", want, stderr)
+		}
+	}
+}
+
+func TestRunRunOptimize(t *testing.T) {
+	path := writeScript(t, "let x = 2;\nputs(x * 3 + 1 * 2);\n")
+
+	tests := []struct {
+		args    []string
+		traced  string // トレースに出てくるはずの式
+		missing string // トレースに出てこないはずの式
+	}{
+		// 最適化すると x が 2 に置き換わって、x * 3 + 1 * 2 は 8 に畳み込まれている
+		{[]string{"run", "-trace", path}, "puts(8) => NULL", "(x * 3)"},
+		{[]string{"run", "-no-optimize", "-trace", path}, "((x * 3) + (1 * 2)) => 8", "puts(8) => NULL"},
+	}
+
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(tt.args...)
+		if code != 0 {
+			t.Fatalf("%v の終了コードが 0 じゃないよ。got=%d, stderr=%q", tt.args, code, stderr)
+		}
+		if stdout != "8\n" {
+			t.Errorf("%v の出力が 8 じゃないよ。got=%q", tt.args, stdout)
+		}
+		if !strings.Contains(stderr, tt.traced) {
+			t.Errorf("%v のトレースに %q がないよ。got=%q", tt.args, tt.traced, stderr)
+		}
+		if strings.Contains(stderr, tt.missing) {
+			t.Errorf("%v のトレースに %q があるよ。got=%q", tt.args, tt.missing, stderr)
+		}
+	}
+}
+
+func TestRunTokens(t *testing.T) {
+	path := writeScript(t, "let x = 1;\n")
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{
+			[]string{"tokens", path},
+			"1:1   LET    \"let\"\n1:5   IDENT  \"x\"\n1:7   =      \"=\"\n1:9   INT    \"1\"\n1:10  ;      \";\"\n2:1   EOF    \"\"\n",
+		},
+		{
+			[]string{"tokens", "-json", path},
+			`[
+  {
+    "type": "LET",
+    "literal": "let",
+    "line": 1,
+    "column": 1
+  },
+  {
+    "type": "IDENT",
+    "literal": "x",
+    "line": 1,
+    "column": 5
+  },
+  {
+    "type": "=",
+    "literal": "=",
+    "line": 1,
+    "column": 7
+  },
+  {
+    "type": "INT",
+    "literal": "1",
+    "line": 1,
+    "column": 9
+  },
+  {
+    "type": ";",
+    "literal": ";",
+    "line": 1,
+    "column": 10
+  },
+  {
+    "type": "EOF",
+    "literal": "",
+    "line": 2,
+    "column": 1
+  }
+]
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(tt.args...)
+		if code != 0 {
+			t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr)
+		}
+		if stdout != tt.expected {
+			t.Errorf("%v の出力がおかしいよ。\nwant=%q\ngot =%q", tt.args, tt.expected, stdout)
+		}
+	}
+}
+
+func TestRunAST(t *testing.T) {
+	path := writeScript(t, "-x;\n")
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{
+			[]string{"ast", path},
+			"Program\n" +
+				"  statements[0]: ExpressionStatement 1:1\n" +
+				"    expression: PrefixExpression 1:1 operator \"-\"\n" +
+				"      right: Identifier 1:2 value \"x\"\n",
+		},
+		{
+			[]string{"ast", "--dot", path},
+			"digraph AST {\n" +
+				"  node [shape=box, fontname=\"monospace\"];\n" +
+				"  n0 [label=\"Program\"];\n" +
+				"  n1 [label=\"ExpressionStatement\\n1:1\"];\n" +
+				"  n2 [label=\"PrefixExpression\\n1:1\\noperator \\\"-\\\"\"];\n" +
+				"  n3 [label=\"Identifier\\n1:2\\nvalue \\\"x\\\"\"];\n" +
+				"  n2 -> n3 [label=\"right\"];\n" +
+				"  n1 -> n2 [label=\"expression\"];\n" +
+				"  n0 -> n1 [label=\"statements[0]\"];\n" +
+				"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(tt.args...)
+		if code != 0 {
+			t.Fatalf("終了コードが 0 じゃないよ。got=%d, stderr=%q", code, stderr)
+		}
+		if stdout != tt.expected {
+			t.Errorf("%v の出力がおかしいよ。\nwant=%q\ngot =%q", tt.args, tt.expected, stdout)
+		}
+	}
+}
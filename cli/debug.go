@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"gomonkey/debugger"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+	"io"
+	"os"
+	"strings"
+)
+
+// runDebug は `gomonkey debug [-allow fs,os,time] file.mk [args...]`。
+// 最初の文で止まって、stdin からデバッガのコマンド(break, step, next, continue, locals, backtrace, print…)を読む。
+// -dap なら stdin/stdout で Debug Adapter Protocol をしゃべる(ファイルは launch リクエストでもらう)。
+func runDebug(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	allow := flags.String("allow", "", "許可する権限をカンマ区切りで(fs,os,time か all)")
+	dap := flags.Bool("dap", false, "stdin/stdout で Debug Adapter Protocol をしゃべる")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if (*dap && flags.NArg() != 0) || (!*dap && flags.NArg() < 1) {
+		_, _ = io.WriteString(stderr, "usage: gomonkey debug [-allow fs,os,time] file.mk [args...]\n       gomonkey debug -dap [-allow fs,os,time]\n")
+		return 2
+	}
+
+	capabilities, err := evaluator.ParseCapabilities(*allow)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 2
+	}
+
+	if *dap {
+		return runDAP(capabilities, stdin, stdout, stderr)
+	}
+
+	path := flags.Arg(0)
+	source, err := os.ReadFile(path)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+
+	// デバッガのコマンドとスクリプトの read_line は同じ stdin を読むので、バッファも共有する
+	in := bufio.NewReader(stdin)
+	program, env, process, ok := loadProgram(path, flags.Args()[1:], capabilities, object.NewIO(in, stdout, stderr), stderr)
+	if !ok {
+		return 1
+	}
+
+	result, quit := debugger.NewConsole(path, string(source), in, stdout).Run(program, env)
+	if quit {
+		return 0
+	}
+
+	if errObj, ok := result.(*object.Error); ok {
+		_, _ = fmt.Fprintf(stderr, "%s: %s\n", path, errObj.Message)
+		return 1
+	}
+
+	return process.ExitCode
+}
+
+// runDAP は DAP のサーバーを動かす。stdout はプロトコル専用なので、スクリプトの出力は output イベントになる
+func runDAP(capabilities []evaluator.Capability, stdin io.Reader, stdout, stderr io.Writer) int {
+	launch := func(path string, args []string, io *object.IO) (*debugger.Target, error) {
+		var errOut strings.Builder
+		program, env, process, ok := loadProgram(path, args, capabilities, io, &errOut)
+		if !ok {
+			return nil, errors.New(strings.TrimSpace(errOut.String()))
+		}
+
+		return &debugger.Target{Program: program, Env: env, Process: process}, nil
+	}
+
+	if err := debugger.NewDAPServer(stdin, stdout, launch).Serve(); err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/evaluator"
+	"gomonkey/format"
+	"gomonkey/object"
+	"io"
+)
+
+// runExpand は `gomonkey expand [-trace] file.mk`。
+// マクロ定義を取り除いて、マクロ呼び出しを展開したあとのプログラムを format で整形して表示する。
+// 整形した出力はそのままパースし直せるので、ファイルに保存して実行することもできる。
+func runExpand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("expand", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	trace := flags.Bool("trace", false, "マクロ呼び出しごとに実引数と展開結果を stderr に書き出す")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		_, _ = io.WriteString(stderr, "usage: gomonkey expand [-trace] file.mk\n")
+		return 2
+	}
+
+	program, ok := parseFile(flags.Arg(0), stderr)
+	if !ok {
+		return 1
+	}
+
+	macroEnv := object.NewEnvironment()
+	// マクロの中で puts されたものは stderr へ。stdout は展開したプログラムだけにしておきたい
+	macroEnv.SetIO(object.NewIO(nil, stderr, stderr))
+	evaluator.DefineMacros(program, macroEnv)
+
+	var expanded ast.Node
+	var err error
+	if *trace {
+		expanded, err = evaluator.ExpandMacrosWithTrace(program, macroEnv, stderr)
+	} else {
+		expanded, err = evaluator.ExpandMacros(program, macroEnv)
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "macro expansion error: %s\n", err)
+		return 1
+	}
+
+	_, _ = io.WriteString(stdout, format.Program(expanded.(*ast.Program)))
+
+	return 0
+}
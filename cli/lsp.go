@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"fmt"
+	"gomonkey/lsp"
+	"io"
+)
+
+// runLSP は `gomonkey lsp`。stdin と stdout で LSP をしゃべる(エディタから起動してもらう)。
+// stdout はプロトコル専用なので、ログやエラーは stderr へ。
+func runLSP(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) != 0 {
+		_, _ = io.WriteString(stderr, "usage: gomonkey lsp\n")
+		return 2
+	}
+
+	if err := lsp.NewServer(stdin, stdout).Serve(); err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/parser"
+	"io"
+)
+
+// runParse は `gomonkey parse [-json] file.mk`。
+// パースしただけのプログラム(マクロは展開しない)を表示する。-json なら AST を JSON で書き出す。
+func runParse(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "AST を JSON で書き出す")
+	trace := flags.Bool("trace", false, "パース関数の呼び出しを字下げした木にして stderr に書き出す")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		_, _ = io.WriteString(stderr, "usage: gomonkey parse [-json] [-trace] file.mk\n")
+		return 2
+	}
+
+	var options []parser.Option
+	if *trace {
+		options = append(options, parser.WithTrace(stderr))
+	}
+
+	program, ok := parseFile(flags.Arg(0), stderr, options...)
+	if !ok {
+		return 1
+	}
+
+	if !*asJSON {
+		printProgram(stdout, program)
+		return 0
+	}
+
+	if err := writeJSON(stdout, program); err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// writeJSON は人が読めるようにインデントして書き出す
+func writeJSON(out io.Writer, node ast.Node) error {
+	data, err := ast.EncodeJSON(node)
+	if err != nil {
+		return err
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return err
+	}
+	indented.WriteByte('\n')
+
+	_, err = indented.WriteTo(out)
+	return err
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+	"gomonkey/optimizer"
+	"gomonkey/profiler"
+	"io"
+	"os"
+)
+
+// runRun は `gomonkey run [-allow fs,os,time] [-no-optimize] [-trace] [-profile] [-pprof out.pb.gz] file.mk [args...]`。
+// マクロを展開して、optimizer で定数の畳み込みとかをしてから評価する。-no-optimize なら最適化しないで、書いたとおりに評価する。fs / os / time のモジュールは -allow で許可したものしか使えない。
+// -trace なら評価したノードと結果を1個ずつ stderr に書く(evaluator.Tracer)。トレースするのは最適化した後のプログラムなので、書いたとおりに見たければ -no-optimize もつける。
+// -profile なら終わったあとに関数ごとの時間の表を stderr に、-pprof なら `go tool pprof` 用のファイルを書く。
+// 終了コードは、評価がエラーで終わったら 1、そうでなければスクリプトが os.exit_code(n) で決めた値(デフォルト0)。
+func runRun(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	allow := flags.String("allow", "", "許可する権限をカンマ区切りで(fs,os,time か all)")
+	profile := flags.Bool("profile", false, "関数ごとの呼び出し回数と時間を stderr に書く")
+	pprof := flags.String("pprof", "", "pprof 形式のプロファイルを書き出すファイル")
+	trace := flags.Bool("trace", false, "評価したノードと結果を1個ずつ stderr に書く(最適化した後のプログラムを評価するので、書いたとおりに見たければ -no-optimize もつける)")
+	noOptimize := flags.Bool("no-optimize", false, "定数の畳み込みとかの最適化をしない")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() < 1 {
+		_, _ = io.WriteString(stderr, "usage: gomonkey run [-allow fs,os,time] [-no-optimize] [-trace] [-profile] [-pprof out.pb.gz] file.mk [args...]\n")
+		return 2
+	}
+
+	capabilities, err := evaluator.ParseCapabilities(*allow)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 2
+	}
+
+	// os.args() にはスクリプトのパスは入れず、その後ろの引数だけを渡す
+	program, env, process, ok := loadProgram(flags.Arg(0), flags.Args()[1:], capabilities, object.NewIO(stdin, stdout, stderr), stderr)
+	if !ok {
+		return 1
+	}
+
+	if !*noOptimize {
+		if program, err = optimizer.Optimize(program); err != nil {
+			_, _ = fmt.Fprintf(stderr, "optimizer error: %s\n", err)
+			return 1
+		}
+	}
+
+	if *trace {
+		env.SetHooks(evaluator.NewTracer(stderr))
+	}
+
+	var result object.Object
+	if *profile || *pprof != "" {
+		prof := profiler.New(flags.Arg(0), program)
+		result = prof.Run(program, env)
+		if !writeProfile(prof, *profile, *pprof, stderr) {
+			return 1
+		}
+	} else {
+		result = evaluator.Eval(program, env)
+	}
+
+	if errObj, ok := result.(*object.Error); ok {
+		_, _ = fmt.Fprintf(stderr, "%s: %s\n", flags.Arg(0), errObj.Message)
+		return 1
+	}
+
+	return process.ExitCode
+}
+
+// writeProfile はプロファイルの結果を、text なら表にして stderr に、pprofPath があればそこに書く
+func writeProfile(prof *profiler.Profiler, text bool, pprofPath string, stderr io.Writer) bool {
+	if text {
+		if err := prof.WriteText(stderr); err != nil {
+			_, _ = fmt.Fprintf(stderr, "%s\n", err)
+			return false
+		}
+	}
+
+	if pprofPath == "" {
+		return true
+	}
+
+	f, err := os.Create(pprofPath)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return false
+	}
+
+	if err := prof.WritePprof(f); err != nil {
+		_ = f.Close()
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return false
+	}
+
+	if err := f.Close(); err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return false
+	}
+
+	return true
+}
+
+// loadProgram は path をパースしてマクロを展開し、評価に使う環境といっしょに返す。
+// 環境では capabilities で許可したモジュールが使えて、入出力は io につながっている。
+// パースやマクロ展開でエラーになったら errOut に書いて false を返す。
+func loadProgram(path string, args []string, capabilities []evaluator.Capability, io *object.IO, errOut io.Writer) (*ast.Program, *object.Environment, *evaluator.Process, bool) {
+	program, ok := parseFile(path, errOut)
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	registry := evaluator.DefaultRegistry()
+	process := registry.Grant(&evaluator.Process{Args: args}, capabilities...)
+
+	macroEnv := object.NewEnvironmentWithBuiltins(registry)
+	macroEnv.SetIO(io)
+	env := object.NewEnclosedEnvironment(macroEnv)
+
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		_, _ = fmt.Fprintf(errOut, "macro expansion error: %s\n", err)
+		return nil, nil, nil, false
+	}
+
+	return expanded.(*ast.Program), env, process, true
+}
@@ -0,0 +1,208 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gomonkey/coverage"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+	"gomonkey/testrunner"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runTest は `gomonkey test [-allow fs,os,time] [-cover] [-coverprofile lcov.info] [path...]`。
+// path がディレクトリならその下の *_test.mk を全部、ファイルならそのファイルを動かす。path がなければカレントディレクトリ。
+// ファイルの中の test_ で始まる関数がテストで、1個ずつ新しい環境で呼ぶ(testrunner を見てね)。1個でも失敗したら終了コードは 1。
+// -cover なら実行された文と if の枝を数えて要約を書く。-coverprofile なら LCOV のファイルも書く。
+func runTest(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	allow := flags.String("allow", "", "許可する権限をカンマ区切りで(fs,os,time か all)")
+	cover := flags.Bool("cover", false, "実行された文と if の枝を数えて要約を書く")
+	coverProfile := flags.String("coverprofile", "", "LCOV 形式のカバレッジを書き出すファイル(-cover も付いたことになる)")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	capabilities, err := evaluator.ParseCapabilities(*allow)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := findTestFiles(paths)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+	if len(files) == 0 {
+		_, _ = io.WriteString(stdout, "no test files\n")
+		return 0
+	}
+
+	var tracker *coverage.Tracker
+	if *cover || *coverProfile != "" {
+		tracker = coverage.NewTracker()
+	}
+
+	failed := false
+	for _, path := range files {
+		if !runTestFile(path, capabilities, tracker, stdin, stdout, stderr) {
+			failed = true
+		}
+	}
+
+	if tracker != nil && !writeCoverage(tracker, *coverProfile, stdout, stderr) {
+		return 1
+	}
+
+	if failed {
+		_, _ = io.WriteString(stdout, "FAIL\n")
+		return 1
+	}
+
+	return 0
+}
+
+// runTestFile はテストファイル1個を動かして、全部通ったら true。
+// test_ で始まる関数があれば1個ずつ新しい環境で呼んで、結果を1行ずつ書く。なければファイルをそのまま評価する。
+func runTestFile(path string, capabilities []evaluator.Capability, tracker *coverage.Tracker, stdin io.Reader, stdout, stderr io.Writer) bool {
+	program, env, _, ok := loadProgram(path, nil, capabilities, object.NewIO(stdin, stdout, stderr), stderr)
+	if !ok {
+		_, _ = fmt.Fprintf(stdout, "FAIL\t%s\n", path)
+		return false
+	}
+
+	// テストごとに、組み込み関数と IO の入った環境の中に新しい環境を作る
+	base := env.Outer()
+
+	var hooks object.EvalHooks
+	if tracker != nil {
+		tracker.Add(path, program)
+		hooks = tracker
+	}
+
+	tests := testrunner.Discover(program)
+	if len(tests) == 0 {
+		result := testrunner.RunProgram(program, base, hooks)
+		if !result.Passed {
+			_, _ = fmt.Fprintf(stdout, "FAIL\t%s\n", path)
+			writeTestFailure(stdout, path, result)
+			return false
+		}
+		_, _ = fmt.Fprintf(stdout, "ok\t%s\t(no tests)\n", path)
+		return true
+	}
+
+	passed := 0
+	for _, test := range tests {
+		result := testrunner.Run(program, base, test, hooks)
+		if result.Passed {
+			passed++
+			_, _ = fmt.Fprintf(stdout, "--- PASS: %s (%s:%d)\n", test.Name, path, test.Pos.Line)
+			continue
+		}
+		_, _ = fmt.Fprintf(stdout, "--- FAIL: %s (%s:%d)\n", test.Name, path, test.Pos.Line)
+		writeTestFailure(stdout, path, result)
+	}
+
+	if failed := len(tests) - passed; failed > 0 {
+		_, _ = fmt.Fprintf(stdout, "FAIL\t%s\t(%d passed, %d failed)\n", path, passed, failed)
+		return false
+	}
+
+	_, _ = fmt.Fprintf(stdout, "ok\t%s\t(%d passed)\n", path, passed)
+	return true
+}
+
+// writeTestFailure は失敗したところとメッセージを、字下げして書く。
+//
+//	math_test.mk:4: assert_eq failed
+//		got:  1
+//		want: 2
+func writeTestFailure(w io.Writer, path string, result testrunner.Result) {
+	message := result.Message
+	if result.ErrPos.IsValid() {
+		message = fmt.Sprintf("%s:%d: %s", path, result.ErrPos.Line, message)
+	}
+
+	for _, line := range strings.Split(message, "\n") {
+		_, _ = fmt.Fprintf(w, "    %s\n", line)
+	}
+}
+
+// findTestFiles は paths からテストファイルを探して、名前順に返す。ファイルを直接指定したら名前は何でもいい
+func findTestFiles(paths []string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), "_test.mk") {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// writeCoverage は要約を stdout に書いて、profilePath があれば LCOV をそこに書く
+func writeCoverage(tracker *coverage.Tracker, profilePath string, stdout, stderr io.Writer) bool {
+	if err := tracker.WriteSummary(stdout); err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return false
+	}
+
+	if profilePath == "" {
+		return true
+	}
+
+	f, err := os.Create(profilePath)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return false
+	}
+
+	if err := tracker.WriteLCOV(f); err != nil {
+		_ = f.Close()
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return false
+	}
+
+	if err := f.Close(); err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gomonkey/lexer"
+	"io"
+	"os"
+)
+
+// jsonToken は tokens -json で書き出すトークン1個
+type jsonToken struct {
+	Type    string `json:"type"`
+	Literal string `json:"literal"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+}
+
+// runTokens は `gomonkey tokens [-json] file.mk`。
+// レキサーが出すトークンを最後の EOF まで全部、位置と種類とリテラルといっしょに書く。パースはしないので、構文エラーがあっても出る。
+func runTokens(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("tokens", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "トークンを JSON の配列で書き出す")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		_, _ = io.WriteString(stderr, "usage: gomonkey tokens [-json] file.mk\n")
+		return 2
+	}
+
+	input, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+
+	tokens := lexer.New(string(input)).All()
+
+	if !*asJSON {
+		if err := lexer.WriteTokens(stdout, tokens); err != nil {
+			_, _ = fmt.Fprintf(stderr, "%s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	out := make([]jsonToken, len(tokens))
+	for i, tok := range tokens {
+		out[i] = jsonToken{Type: string(tok.Type), Literal: tok.Literal, Line: tok.Pos.Line, Column: tok.Pos.Column}
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+	if _, err := fmt.Fprintf(stdout, "%s\n", data); err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,149 @@
+// Package coverage は Monkey のプログラムのどの文と、if のどっちの枝が実行されたかを記録する。
+// 評価のフック(object.EvalHooks)で数えるので、Tracker を環境に SetHooks したときだけ記録される。
+// 結果は AST の位置をもとに行ごとにまとめて、テキストの要約(WriteSummary)か LCOV(WriteLCOV)で書き出す。
+package coverage
+
+import (
+	"gomonkey/ast"
+	"gomonkey/object"
+	"gomonkey/token"
+)
+
+// Tracker は object.EvalHooks を実装している。ファイルをいくつ Add してもいい
+type Tracker struct {
+	files      []*File
+	statements map[ast.Statement]*Statement
+	blocks     map[*ast.BlockStatement]*int // if の枝のブロックから、その枝の回数を引く
+	conditions map[ast.Expression]*If
+}
+
+// File は1ファイル分の記録
+type File struct {
+	Path       string
+	Statements []*Statement // ファイルの前から順
+	Ifs        []*If
+}
+
+// Statement は文1個。Count は実行された回数
+type Statement struct {
+	Pos   token.Position
+	Count int
+}
+
+// If は if 式1個の2つの枝。else がなくても「条件が偽だった」のを Else として数える
+type If struct {
+	Pos       token.Position
+	HasElse   bool
+	Evaluated int // 条件式がエラーにならずに評価された回数
+	Then      int // then の枝を通った回数
+
+	elseCount int
+}
+
+// Else は else の枝を通った回数。else がなければ、条件が偽だった回数
+func (i *If) Else() int {
+	if i.HasElse {
+		return i.elseCount
+	}
+
+	return i.Evaluated - i.Then
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		statements: make(map[ast.Statement]*Statement),
+		blocks:     make(map[*ast.BlockStatement]*int),
+		conditions: make(map[ast.Expression]*If),
+	}
+}
+
+// Add は path のプログラムを記録の対象にする。program は評価するもの(マクロ展開済み)を渡すこと。
+// 位置のわからない文(マクロが作ったものとか)は数えない。
+func (t *Tracker) Add(path string, program *ast.Program) *File {
+	f := &File{Path: path}
+	ast.Walk(&collector{t: t, f: f}, program)
+	t.files = append(t.files, f)
+
+	return f
+}
+
+// Files は Add した順にファイルを返す
+func (t *Tracker) Files() []*File {
+	return t.files
+}
+
+type collector struct {
+	t *Tracker
+	f *File
+}
+
+func (c *collector) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		c.statement(node, node.Token.Pos)
+	case *ast.ReturnStatement:
+		c.statement(node, node.Token.Pos)
+	case *ast.ExpressionStatement:
+		c.statement(node, node.Token.Pos)
+
+	case *ast.IfExpression:
+		if !node.Token.Pos.IsValid() || node.Condition == nil {
+			break
+		}
+		ifExpr := &If{Pos: node.Token.Pos, HasElse: node.Alternative != nil}
+		c.f.Ifs = append(c.f.Ifs, ifExpr)
+		c.t.conditions[node.Condition] = ifExpr
+		if node.Consequence != nil {
+			c.t.blocks[node.Consequence] = &ifExpr.Then
+		}
+		if node.Alternative != nil {
+			c.t.blocks[node.Alternative] = &ifExpr.elseCount
+		}
+	}
+
+	return c
+}
+
+func (c *collector) statement(stmt ast.Statement, pos token.Position) {
+	if !pos.IsValid() {
+		return
+	}
+
+	s := &Statement{Pos: pos}
+	c.f.Statements = append(c.f.Statements, s)
+	c.t.statements[stmt] = s
+}
+
+func (t *Tracker) BeforeEval(node ast.Node, env *object.Environment) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		if count, ok := t.blocks[node]; ok {
+			*count++
+		}
+	case ast.Statement:
+		if s, ok := t.statements[node]; ok {
+			s.Count++
+		}
+	}
+}
+
+// AfterEval は if の条件式を見張る。else のない if は、条件式を評価したのに Then に入らなかった分が Else になる
+func (t *Tracker) AfterEval(node ast.Node, env *object.Environment, result object.Object) {
+	expr, ok := node.(ast.Expression)
+	if !ok {
+		return
+	}
+
+	ifExpr, ok := t.conditions[expr]
+	if !ok {
+		return
+	}
+
+	if _, isErr := result.(*object.Error); !isErr {
+		ifExpr.Evaluated++
+	}
+}
+
+func (t *Tracker) EnterFunction(call *ast.CallExpression, fn object.Object, args []object.Object) {}
+
+func (t *Tracker) ExitFunction(call *ast.CallExpression, fn object.Object, result object.Object) {}
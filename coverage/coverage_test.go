@@ -0,0 +1,148 @@
+package coverage_test
+
+import (
+	"gomonkey/coverage"
+	"gomonkey/evaluator"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const script = `let abs = fn(n) {
+	if (n < 0) {
+		return -n;
+	}
+	n
+};
+let pick = fn(x) { if (x) { 1 } else { 2 } };
+let unused = fn() {
+	puts("never");
+};
+abs(3);
+abs(-4);
+pick(true);
+`
+
+func track(t *testing.T, input string) *coverage.Tracker {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("パースエラーだよ: %v", p.Errors())
+	}
+
+	tracker := coverage.NewTracker()
+	tracker.Add("lib_test.mk", program)
+
+	env := object.NewEnvironment()
+	env.SetHooks(tracker)
+	evaluator.Eval(program, env)
+
+	return tracker
+}
+
+func TestLines(t *testing.T) {
+	tracker := track(t, script)
+
+	expected := []coverage.Line{
+		{Line: 1, Count: 1},
+		{Line: 2, Count: 2},
+		{Line: 3, Count: 1},
+		{Line: 5, Count: 1},
+		{Line: 7, Count: 0}, // else の 2 が動いてない
+		{Line: 8, Count: 1},
+		{Line: 9, Count: 0},
+		{Line: 11, Count: 1},
+		{Line: 12, Count: 1},
+		{Line: 13, Count: 1},
+	}
+
+	if lines := tracker.Files()[0].Lines(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("行ごとの回数がおかしいよ。\nwant=%v\ngot =%v", expected, lines)
+	}
+}
+
+func TestBranches(t *testing.T) {
+	tracker := track(t, script)
+	ifs := tracker.Files()[0].Ifs
+
+	tests := []struct {
+		line      int
+		evaluated int
+		then      int
+		els       int
+	}{
+		{2, 2, 1, 1}, // else はないけど、条件が偽だった1回を数える
+		{7, 1, 1, 0},
+	}
+
+	if len(ifs) != len(tests) {
+		t.Fatalf("if が %d 個じゃないよ。got=%d", len(tests), len(ifs))
+	}
+
+	for i, tt := range tests {
+		got := ifs[i]
+		if got.Pos.Line != tt.line || got.Evaluated != tt.evaluated || got.Then != tt.then || got.Else() != tt.els {
+			t.Errorf("%d 行目の if がおかしいよ。got=line %d, evaluated %d, then %d, else %d",
+				tt.line, got.Pos.Line, got.Evaluated, got.Then, got.Else())
+		}
+	}
+
+	if covered, total := tracker.Files()[0].BranchesCovered(); covered != 3 || total != 4 {
+		t.Errorf("枝の網羅が 3/4 じゃないよ。got=%d/%d", covered, total)
+	}
+}
+
+func TestConditionError(t *testing.T) {
+	// 条件式がエラーなら、どっちの枝も通ってない
+	tracker := track(t, `if (1 + true) { 1 }`)
+	ifs := tracker.Files()[0].Ifs
+
+	if ifs[0].Evaluated != 0 || ifs[0].Then != 0 || ifs[0].Else() != 0 {
+		t.Errorf("エラーなのに枝を通ったことになってるよ。got=%+v", ifs[0])
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	tracker := track(t, script)
+
+	var out strings.Builder
+	if err := tracker.WriteSummary(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "lib_test.mk: 84.6% of statements (11/13), 75.0% of branches (3/4)\n\tnot covered: 7, 9\n"
+	if out.String() != expected {
+		t.Errorf("要約がおかしいよ。\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+	tracker := track(t, "let f = fn(x) { if (x) { 1 } };\nlet g = fn() { 2 };\nf(true);\n")
+
+	var out strings.Builder
+	if err := tracker.WriteLCOV(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `TN:
+SF:lib_test.mk
+BRDA:1,0,0,1
+BRDA:1,0,1,0
+BRF:2
+BRH:1
+DA:1,1
+DA:2,0
+DA:3,1
+LF:3
+LH:2
+end_of_record
+`
+	if out.String() != expected {
+		t.Errorf("LCOV がおかしいよ。\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
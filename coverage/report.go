@@ -0,0 +1,173 @@
+package coverage
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Line は1行分の結果。1行に文がいくつかあったら、一番少なく実行された文の回数にする
+// (`let f = fn() { 1 };` で f を呼ばなかったら、let が動いていてもその行は通ってないことにする)
+type Line struct {
+	Line  int
+	Count int
+}
+
+// Lines は文のある行を小さい順に返す
+func (f *File) Lines() []Line {
+	counts := make(map[int]int)
+	for _, s := range f.Statements {
+		if count, ok := counts[s.Pos.Line]; !ok || s.Count < count {
+			counts[s.Pos.Line] = s.Count
+		}
+	}
+
+	lines := make([]Line, 0, len(counts))
+	for line, count := range counts {
+		lines = append(lines, Line{Line: line, Count: count})
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Line < lines[j].Line })
+
+	return lines
+}
+
+// StatementsCovered は実行された文の数と、文の数
+func (f *File) StatementsCovered() (covered, total int) {
+	for _, s := range f.Statements {
+		if s.Count > 0 {
+			covered++
+		}
+	}
+
+	return covered, len(f.Statements)
+}
+
+// BranchesCovered は通った枝の数と、枝の数(if 1個につき2本)
+func (f *File) BranchesCovered() (covered, total int) {
+	for _, i := range f.Ifs {
+		if i.Then > 0 {
+			covered++
+		}
+		if i.Else() > 0 {
+			covered++
+		}
+	}
+
+	return covered, len(f.Ifs) * 2
+}
+
+// WriteSummary はファイルごとに文と枝の網羅率と、実行されなかった行を書く。
+//
+//	lib_test.mk: 83.3% of statements (5/6), 50.0% of branches (1/2)
+//		not covered: 4, 7-9
+func (t *Tracker) WriteSummary(w io.Writer) error {
+	var covered, total int
+
+	for _, f := range t.files {
+		c, n := f.StatementsCovered()
+		bc, bn := f.BranchesCovered()
+		covered += c
+		total += n
+
+		if _, err := fmt.Fprintf(w, "%s: %s of statements (%d/%d), %s of branches (%d/%d)\n",
+			f.Path, percent(c, n), c, n, percent(bc, bn), bc, bn); err != nil {
+			return err
+		}
+
+		if missed := f.uncoveredLines(); missed != "" {
+			if _, err := fmt.Fprintf(w, "\tnot covered: %s\n", missed); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(t.files) > 1 {
+		if _, err := fmt.Fprintf(w, "total: %s of statements (%d/%d)\n", percent(covered, total), covered, total); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uncoveredLines は実行されなかった行を "4, 7-9" みたいに続いているところをまとめて返す
+func (f *File) uncoveredLines() string {
+	var ranges []string
+	start, end := 0, 0
+
+	flush := func() {
+		switch {
+		case start == 0:
+		case start == end:
+			ranges = append(ranges, strconv.Itoa(start))
+		default:
+			ranges = append(ranges, fmt.Sprintf("%d-%d", start, end))
+		}
+	}
+
+	for _, line := range f.Lines() {
+		if line.Count > 0 {
+			flush()
+			start, end = 0, 0
+			continue
+		}
+		if start != 0 && line.Line == end+1 {
+			end = line.Line
+			continue
+		}
+		flush()
+		start, end = line.Line, line.Line
+	}
+	flush()
+
+	return strings.Join(ranges, ", ")
+}
+
+func percent(covered, total int) string {
+	if total == 0 {
+		return "100.0%"
+	}
+
+	return fmt.Sprintf("%.1f%%", float64(covered)*100/float64(total))
+}
+
+// WriteLCOV は LCOV のトレースファイル(genhtml とかエディタの拡張が読めるもの)を書く。
+// 枝は if 1個をブロック1個として、then を 0 番、else(なければ「条件が偽」)を 1 番にする。
+// 条件式が一度も評価されなかった if の枝の回数は、LCOV の決まりどおり "-" にする。
+func (t *Tracker) WriteLCOV(w io.Writer) error {
+	var out strings.Builder
+
+	for _, f := range t.files {
+		out.WriteString("TN:\n")
+		out.WriteString("SF:" + f.Path + "\n")
+
+		for block, i := range f.Ifs {
+			for branch, count := range []int{i.Then, i.Else()} {
+				taken := "-"
+				if i.Evaluated > 0 {
+					taken = strconv.Itoa(count)
+				}
+				fmt.Fprintf(&out, "BRDA:%d,%d,%d,%s\n", i.Pos.Line, block, branch, taken)
+			}
+		}
+		bc, bn := f.BranchesCovered()
+		fmt.Fprintf(&out, "BRF:%d\nBRH:%d\n", bn, bc)
+
+		lines := f.Lines()
+		hit := 0
+		for _, line := range lines {
+			fmt.Fprintf(&out, "DA:%d,%d\n", line.Line, line.Count)
+			if line.Count > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(&out, "LF:%d\nLH:%d\n", len(lines), hit)
+
+		out.WriteString("end_of_record\n")
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
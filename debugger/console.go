@@ -0,0 +1,213 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/object"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const consoleHelp = `commands:
+	break [line]   (b)  line 行目にブレークポイントを置く。line なしなら一覧
+	delete line    (d)  line 行目のブレークポイントを外す
+	continue       (c)  次のブレークポイントまで進む
+	step           (s)  次の文まで進む(関数の中にも入る)
+	next           (n)  今の関数の次の文まで進む
+	out            (o)  今の関数から戻るまで進む
+	locals         (l)  今の関数のローカル変数を表示する
+	globals        (g)  トップレベルの変数を表示する
+	backtrace      (bt) 呼び出しスタックを表示する
+	print expr     (p)  止まっているところで式を評価して表示する
+	quit           (q)  実行をやめる
+`
+
+const consolePrompt = "(gomonkey) "
+
+// Console は端末で対話するフロントエンド。止まるたびに in からコマンドを読む。
+// in はデバッグするプログラムの read_line と同じものを渡すこと(先読みした分を取り合わないように)
+type Console struct {
+	Debugger *Debugger
+
+	path  string
+	lines []string
+	in    *bufio.Reader
+	out   io.Writer
+	last  string // 空行のときにくり返すコマンド
+}
+
+func NewConsole(path, source string, in *bufio.Reader, out io.Writer) *Console {
+	c := &Console{
+		path:  path,
+		lines: strings.Split(source, "\n"),
+		in:    in,
+		out:   out,
+	}
+	c.Debugger = New(c.pause)
+
+	return c
+}
+
+// Run は program をデバッガの下で評価する。quit したら quit が true
+func (c *Console) Run(program *ast.Program, env *object.Environment) (object.Object, bool) {
+	return c.Debugger.Run(program, env)
+}
+
+func (c *Console) pause(stop *Stop) Action {
+	c.printf("stopped at %s:%d (%s)\n", c.path, stop.Pos.Line, stop.Reason)
+	c.printLine(stop.Pos.Line)
+
+	for {
+		c.printf("%s", consolePrompt)
+
+		line, err := c.in.ReadString('\n')
+		if err != nil && line == "" {
+			// 入力が終わったらもう操作できないので終わりにする
+			c.printf("\n")
+			return Quit
+		}
+
+		command := strings.TrimSpace(line)
+		if command == "" {
+			command = c.last
+		}
+		c.last = command
+
+		if action, ok := c.execute(command, stop); ok {
+			return action
+		}
+	}
+}
+
+// execute はコマンドを1個実行する。評価を進めるコマンドなら ok が true
+func (c *Console) execute(command string, stop *Stop) (Action, bool) {
+	name, arg := command, ""
+	if i := strings.IndexAny(command, " \t"); i >= 0 {
+		name, arg = command[:i], strings.TrimSpace(command[i+1:])
+	}
+
+	switch name {
+	case "":
+		return 0, false
+	case "continue", "c":
+		return Continue, true
+	case "step", "s":
+		return StepIn, true
+	case "next", "n":
+		return StepOver, true
+	case "out", "o":
+		return StepOut, true
+	case "quit", "q":
+		return Quit, true
+
+	case "break", "b":
+		c.breakCommand(arg)
+	case "delete", "d":
+		c.deleteCommand(arg)
+	case "locals", "l":
+		c.printVariables(c.Debugger.Locals(stop.Frames[0]), "(no locals)")
+	case "globals", "g":
+		c.printVariables(c.Debugger.Globals(), "(no globals)")
+	case "backtrace", "bt":
+		for i, frame := range stop.Frames {
+			c.printf("#%d %s at %s:%d\n", i, frame.Name, c.path, frame.Pos.Line)
+		}
+	case "print", "p":
+		c.printCommand(arg, stop)
+	case "help", "h":
+		c.printf("%s", consoleHelp)
+	default:
+		c.printf("unknown command %q (type help for commands)\n", name)
+	}
+
+	return 0, false
+}
+
+func (c *Console) breakCommand(arg string) {
+	if arg == "" {
+		lines := c.Debugger.Breakpoints()
+		if len(lines) == 0 {
+			c.printf("no breakpoints\n")
+			return
+		}
+		for _, line := range lines {
+			c.printf("breakpoint at %s:%d\n", c.path, line)
+		}
+		return
+	}
+
+	line, ok := c.parseLine(arg)
+	if !ok {
+		return
+	}
+	c.Debugger.SetBreakpoint(line)
+	c.printf("breakpoint set at %s:%d\n", c.path, line)
+}
+
+func (c *Console) deleteCommand(arg string) {
+	line, ok := c.parseLine(arg)
+	if !ok {
+		return
+	}
+
+	if !c.Debugger.ClearBreakpoint(line) {
+		c.printf("no breakpoint at line %d\n", line)
+		return
+	}
+	c.printf("breakpoint at %s:%d deleted\n", c.path, line)
+}
+
+func (c *Console) parseLine(arg string) (int, bool) {
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 {
+		c.printf("invalid line number %q\n", arg)
+		return 0, false
+	}
+
+	return line, true
+}
+
+func (c *Console) printCommand(arg string, stop *Stop) {
+	if arg == "" {
+		c.printf("usage: print expr\n")
+		return
+	}
+
+	result, err := c.Debugger.Evaluate(arg, stop.Frames[0].Env)
+	if err != nil {
+		c.printf("parse error: %s\n", err)
+		return
+	}
+
+	if errObj, ok := result.(*object.Error); ok {
+		c.printf("error: %s\n", errObj.Message)
+		return
+	}
+	c.printf("%s\n", result.Inspect())
+}
+
+func (c *Console) printVariables(vars []Variable, empty string) {
+	if len(vars) == 0 {
+		c.printf("%s\n", empty)
+		return
+	}
+
+	for _, v := range vars {
+		c.printf("%s = %s\n", v.Name, v.Value)
+	}
+}
+
+// printLine はソースの line 行目を行番号つきで表示する
+func (c *Console) printLine(line int) {
+	if line < 1 || line > len(c.lines) {
+		return
+	}
+
+	c.printf("%5d\t%s\n", line, strings.TrimRight(c.lines[line-1], " \t\r"))
+}
+
+func (c *Console) printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(c.out, format, args...)
+}
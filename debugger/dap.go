@@ -0,0 +1,493 @@
+package debugger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+	"io"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Debug Adapter Protocol。ヘッダ(Content-Length)と JSON の本体という形は LSP と同じだけど、中身は JSON-RPC じゃない。
+// https://microsoft.github.io/debug-adapter-protocol/specification
+//
+// スレッドは1個(id 1)だけ。評価は別の goroutine で動かして、止まっている間はそっちが actions を待つ。
+
+// Target はデバッグするプログラム
+type Target struct {
+	Program *ast.Program        // マクロを展開し終わったもの
+	Env     *object.Environment // 評価に使う環境
+	Process *evaluator.Process  // 終了コードを読むのに使う。nil なら 0
+}
+
+// Launcher は launch リクエストでプログラムを用意する。
+// プログラムの出力は output イベントにしたいので、出力先の io をもらって環境に設定してもらう。
+type Launcher func(path string, args []string, io *object.IO) (*Target, error)
+
+const threadID = 1
+
+// DAPServer は DAP でエディタとしゃべる
+type DAPServer struct {
+	in     *bufio.Reader
+	out    io.Writer
+	launch Launcher
+
+	writeMu sync.Mutex // out と seq を守る。評価の goroutine からもイベントを送るので
+	seq     int
+
+	debugger *Debugger
+	target   *Target
+	path     string
+
+	mu      sync.Mutex // stop と scopes を守る
+	stop    *Stop      // 止まっている間だけ nil じゃない
+	refs    []scopeRef // variablesReference - 1 で引く。止まるたびに作り直す
+	actions chan Action
+	quit    chan struct{} // 閉じたら、止まっているところから抜けて終わる
+	done    chan struct{} // 評価の goroutine が終わったら閉じる
+}
+
+// scopeRef は variablesReference の指している先
+type scopeRef struct {
+	env     *object.Environment
+	globals bool
+}
+
+func NewDAPServer(in io.Reader, out io.Writer, launch Launcher) *DAPServer {
+	s := &DAPServer{
+		in:      bufio.NewReader(in),
+		out:     out,
+		launch:  launch,
+		actions: make(chan Action),
+		quit:    make(chan struct{}),
+	}
+	s.debugger = New(s.pause)
+
+	return s
+}
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type dapResponse struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+// Serve は disconnect が来るか接続が切れるまでリクエストに答える。
+// 評価中だったら止めて、評価の goroutine が終わるのを待ってから返る。
+func (s *DAPServer) Serve() error {
+	defer s.shutdown()
+
+	for {
+		req, err := readDAPRequest(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if req.Command == "disconnect" {
+			s.shutdown()
+			return s.respond(req, nil, nil)
+		}
+
+		body, err := s.handle(req)
+		if err := s.respond(req, body, err); err != nil {
+			return err
+		}
+
+		// initialized イベントは initialize の返事のあとに送る決まり
+		if req.Command == "initialize" {
+			if err := s.event("initialized", nil); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *DAPServer) handle(req *dapRequest) (any, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+		}, nil
+
+	case "launch":
+		var args struct {
+			Program     string   `json:"program"`
+			Args        []string `json:"args"`
+			StopOnEntry bool     `json:"stopOnEntry"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launchProgram(args.Program, args.Args, args.StopOnEntry)
+
+	case "setBreakpoints":
+		var args struct {
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		// ファイルは1個しかないので、来たもので全部置き換える
+		s.debugger.ClearBreakpoints()
+		breakpoints := []map[string]any{}
+		for _, bp := range args.Breakpoints {
+			s.debugger.SetBreakpoint(bp.Line)
+			breakpoints = append(breakpoints, map[string]any{"verified": true, "line": bp.Line})
+		}
+		return map[string]any{"breakpoints": breakpoints}, nil
+
+	case "configurationDone":
+		if s.target == nil {
+			return nil, errors.New("no program launched")
+		}
+		s.start()
+		return nil, nil
+
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": threadID, "name": "main"}}}, nil
+
+	case "stackTrace":
+		return s.stackTrace(), nil
+
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args.FrameID)
+
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args.VariablesReference)
+
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+			FrameID    int    `json:"frameId"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args.Expression, args.FrameID)
+
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, s.resume(Continue)
+	case "next":
+		return nil, s.resume(StepOver)
+	case "stepIn":
+		return nil, s.resume(StepIn)
+	case "stepOut":
+		return nil, s.resume(StepOut)
+	}
+
+	return nil, fmt.Errorf("unsupported request: %s", req.Command)
+}
+
+func (s *DAPServer) launchProgram(path string, args []string, stopOnEntry bool) error {
+	if s.target != nil {
+		return errors.New("program already launched")
+	}
+
+	io := object.NewIO(nil, &outputWriter{s: s, category: "stdout"}, &outputWriter{s: s, category: "stderr"})
+	target, err := s.launch(path, args, io)
+	if err != nil {
+		return err
+	}
+
+	s.target = target
+	s.path = path
+	s.debugger.StopOnEntry = stopOnEntry
+
+	return nil
+}
+
+// start は評価の goroutine を動かす
+func (s *DAPServer) start() {
+	if s.done != nil {
+		return
+	}
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		result, quit := s.debugger.Run(s.target.Program, s.target.Env)
+		if quit {
+			return
+		}
+
+		exitCode := 0
+		if s.target.Process != nil {
+			exitCode = s.target.Process.ExitCode
+		}
+		if errObj, ok := result.(*object.Error); ok {
+			_ = s.event("output", map[string]any{"category": "stderr", "output": s.path + ": " + errObj.Message + "\n"})
+			exitCode = 1
+		}
+
+		_ = s.event("exited", map[string]any{"exitCode": exitCode})
+		_ = s.event("terminated", nil)
+	}()
+}
+
+// shutdown は評価を止めて、評価の goroutine が終わるのを待つ
+func (s *DAPServer) shutdown() {
+	if s.done == nil {
+		return
+	}
+
+	// 走っていたら次の文で、止まっていたらその場で終わる
+	s.debugger.RequestQuit()
+	close(s.quit)
+
+	<-s.done
+	s.done = nil
+}
+
+// pause は評価の goroutine で呼ばれる。stopped イベントを送って、続け方が来るまで待つ
+func (s *DAPServer) pause(stop *Stop) Action {
+	s.mu.Lock()
+	s.stop = stop
+	s.refs = nil
+	s.mu.Unlock()
+
+	_ = s.event("stopped", map[string]any{"reason": string(stop.Reason), "threadId": threadID, "allThreadsStopped": true})
+
+	var action Action
+	select {
+	case action = <-s.actions:
+	case <-s.quit:
+		action = Quit
+	}
+
+	s.mu.Lock()
+	s.stop = nil
+	s.refs = nil
+	s.mu.Unlock()
+
+	return action
+}
+
+func (s *DAPServer) resume(action Action) error {
+	if s.currentStop() == nil {
+		return errors.New("not stopped")
+	}
+
+	s.actions <- action
+
+	return nil
+}
+
+func (s *DAPServer) currentStop() *Stop {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stop
+}
+
+// frame は DAP の frameId(1始まり、内側から順)から Frame を引く
+func (s *DAPServer) frame(id int) (Frame, error) {
+	stop := s.currentStop()
+	if stop == nil {
+		return Frame{}, errors.New("not stopped")
+	}
+	if id < 1 || id > len(stop.Frames) {
+		return Frame{}, fmt.Errorf("unknown frame %d", id)
+	}
+
+	return stop.Frames[id-1], nil
+}
+
+func (s *DAPServer) stackTrace() any {
+	frames := []map[string]any{}
+
+	if stop := s.currentStop(); stop != nil {
+		for i, frame := range stop.Frames {
+			frames = append(frames, map[string]any{
+				"id":     i + 1,
+				"name":   frame.Name,
+				"line":   frame.Pos.Line,
+				"column": frame.Pos.Column,
+				"source": map[string]any{"name": filepath.Base(s.path), "path": s.path},
+			})
+		}
+	}
+
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+// scopes は Locals と Globals の2つ。variablesReference は止まるたびに振り直す
+func (s *DAPServer) scopes(frameID int) (any, error) {
+	frame, err := s.frame(frameID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.refs = append(s.refs, scopeRef{env: frame.Env}, scopeRef{globals: true})
+	localsRef := len(s.refs) - 1
+	s.mu.Unlock()
+
+	return map[string]any{"scopes": []map[string]any{
+		{"name": "Locals", "variablesReference": localsRef, "expensive": false},
+		{"name": "Globals", "variablesReference": localsRef + 1, "expensive": false},
+	}}, nil
+}
+
+func (s *DAPServer) variables(ref int) (any, error) {
+	s.mu.Lock()
+	if ref < 1 || ref > len(s.refs) {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("unknown variablesReference %d", ref)
+	}
+	scope := s.refs[ref-1]
+	s.mu.Unlock()
+
+	vars := s.debugger.Globals()
+	if !scope.globals {
+		vars = s.debugger.Locals(Frame{Env: scope.env})
+	}
+
+	variables := []map[string]any{}
+	for _, v := range vars {
+		variables = append(variables, map[string]any{"name": v.Name, "value": v.Value, "variablesReference": 0})
+	}
+
+	return map[string]any{"variables": variables}, nil
+}
+
+func (s *DAPServer) evaluate(expression string, frameID int) (any, error) {
+	frame, err := s.frame(frameID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.debugger.Evaluate(expression, frame.Env)
+	if err != nil {
+		return nil, err
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, errors.New(errObj.Message)
+	}
+
+	return map[string]any{"result": result.Inspect(), "variablesReference": 0}, nil
+}
+
+func (s *DAPServer) respond(req *dapRequest, body any, err error) error {
+	resp := dapResponse{Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.seq++
+	resp.Seq = s.seq
+
+	return writeDAPMessage(s.out, resp)
+}
+
+func (s *DAPServer) event(event string, body any) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.seq++
+
+	return writeDAPMessage(s.out, dapEvent{Seq: s.seq, Type: "event", Event: event, Body: body})
+}
+
+// outputWriter はプログラムの出力を output イベントにする(stdout はプロトコルで使っているので)
+type outputWriter struct {
+	s        *DAPServer
+	category string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	if err := w.s.event("output", map[string]any{"category": w.category, "output": string(p)}); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func readDAPRequest(r *bufio.Reader) (*dapRequest, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("dap: invalid header: %w", err)
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("dap: invalid Content-Length %q", header.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("dap: reading body: %w", err)
+	}
+
+	var req dapRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("dap: %w", err)
+	}
+
+	return &req, nil
+}
+
+func writeDAPMessage(w io.Writer, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+
+	return err
+}
@@ -0,0 +1,290 @@
+package debugger_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"gomonkey/debugger"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"io"
+	"net/textproto"
+	"strconv"
+	"testing"
+)
+
+// dapMessage は届いたメッセージ。返事もイベントもこれで読む
+type dapMessage struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// dapClient はテスト用のクライアント。エディタの代わりに DAPServer としゃべる
+type dapClient struct {
+	t      *testing.T
+	w      io.Writer
+	r      *bufio.Reader
+	seq    int
+	events []dapMessage
+}
+
+func startDAP(t *testing.T, launch debugger.Launcher) (*dapClient, chan error) {
+	t.Helper()
+
+	clientToServer, serverIn := io.Pipe()
+	serverOut, serverToClient := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		err := debugger.NewDAPServer(clientToServer, serverToClient, launch).Serve()
+		_ = serverToClient.Close()
+		done <- err
+	}()
+
+	t.Cleanup(func() {
+		_ = serverIn.Close()
+		_ = serverOut.Close()
+	})
+
+	return &dapClient{t: t, w: serverIn, r: bufio.NewReader(serverOut)}, done
+}
+
+// request は返事が来るまで待つ。途中で来たイベントは events にためておく
+func (c *dapClient) request(command string, arguments any) dapMessage {
+	c.t.Helper()
+
+	c.seq++
+	body, err := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatalf("送れないよ: %s", err)
+	}
+
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg.RequestSeq != c.seq || msg.Command != command {
+			c.t.Fatalf("%s の返事じゃないよ。got=%+v", command, msg)
+		}
+		return msg
+	}
+}
+
+// waitEvent は event が来るまで読む(ためてあったらそれを返す)
+func (c *dapClient) waitEvent(event string) dapMessage {
+	c.t.Helper()
+
+	for i, msg := range c.events {
+		if msg.Event == event {
+			c.events = append(c.events[:i], c.events[i+1:]...)
+			return msg
+		}
+	}
+
+	for {
+		msg := c.read()
+		if msg.Type == "event" && msg.Event == event {
+			return msg
+		}
+		c.events = append(c.events, msg)
+	}
+}
+
+func (c *dapClient) read() dapMessage {
+	c.t.Helper()
+
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("読めないよ: %s", err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		c.t.Fatalf("読めないよ: %s", err)
+	}
+
+	var msg dapMessage
+	decodeJSON(c.t, body, &msg)
+
+	return msg
+}
+
+func decodeJSON(t *testing.T, data []byte, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("デコードできないよ: %s (%s)", err, data)
+	}
+}
+
+// launchSource はファイルを読む代わりに source をそのまま使う Launcher
+func launchSource(source string) debugger.Launcher {
+	return func(path string, args []string, io *object.IO) (*debugger.Target, error) {
+		p := parser.New(lexer.New(source))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return nil, fmt.Errorf("%s: %s", path, p.Errors()[0])
+		}
+
+		env := object.NewEnvironment()
+		env.SetIO(io)
+
+		return &debugger.Target{Program: program, Env: env}, nil
+	}
+}
+
+func TestDAPSession(t *testing.T) {
+	c, done := startDAP(t, launchSource(script+"puts(x + y);\n"))
+
+	if resp := c.request("initialize", map[string]any{"adapterID": "gomonkey"}); !resp.Success {
+		t.Fatalf("initialize に失敗したよ: %s", resp.Message)
+	}
+	c.waitEvent("initialized")
+
+	if resp := c.request("launch", map[string]any{"program": "script.mk"}); !resp.Success {
+		t.Fatalf("launch に失敗したよ: %s", resp.Message)
+	}
+
+	resp := c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": "script.mk"}, "breakpoints": []map[string]any{{"line": 3}}})
+	var breakpoints struct {
+		Breakpoints []struct {
+			Verified bool `json:"verified"`
+			Line     int  `json:"line"`
+		} `json:"breakpoints"`
+	}
+	decodeJSON(t, resp.Body, &breakpoints)
+	if len(breakpoints.Breakpoints) != 1 || !breakpoints.Breakpoints[0].Verified || breakpoints.Breakpoints[0].Line != 3 {
+		t.Errorf("ブレークポイントの返事がおかしいよ。got=%s", resp.Body)
+	}
+
+	c.request("configurationDone", nil)
+
+	var stopped struct {
+		Reason string `json:"reason"`
+	}
+	decodeJSON(t, c.waitEvent("stopped").Body, &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("breakpoint で止まってないよ。got=%q", stopped.Reason)
+	}
+
+	var stack struct {
+		StackFrames []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+			Line int    `json:"line"`
+		} `json:"stackFrames"`
+	}
+	decodeJSON(t, c.request("stackTrace", map[string]any{"threadId": 1}).Body, &stack)
+	if len(stack.StackFrames) != 2 || stack.StackFrames[0].Name != "add" || stack.StackFrames[0].Line != 3 || stack.StackFrames[1].Line != 5 {
+		t.Fatalf("スタックがおかしいよ。got=%+v", stack.StackFrames)
+	}
+
+	var scopes struct {
+		Scopes []struct {
+			Name               string `json:"name"`
+			VariablesReference int    `json:"variablesReference"`
+		} `json:"scopes"`
+	}
+	decodeJSON(t, c.request("scopes", map[string]any{"frameId": stack.StackFrames[0].ID}).Body, &scopes)
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "Locals" {
+		t.Fatalf("スコープがおかしいよ。got=%+v", scopes.Scopes)
+	}
+
+	var variables struct {
+		Variables []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"variables"`
+	}
+	decodeJSON(t, c.request("variables", map[string]any{"variablesReference": scopes.Scopes[0].VariablesReference}).Body, &variables)
+	if fmt.Sprint(variables.Variables) != "[{a 1} {b 2} {c 3}]" {
+		t.Errorf("ローカル変数がおかしいよ。got=%+v", variables.Variables)
+	}
+
+	var evaluated struct {
+		Result string `json:"result"`
+	}
+	decodeJSON(t, c.request("evaluate", map[string]any{"expression": "c * 2", "frameId": 1}).Body, &evaluated)
+	if evaluated.Result != "6" {
+		t.Errorf("評価の結果が 6 じゃないよ。got=%q", evaluated.Result)
+	}
+
+	// 2回目の呼び出しでもう一度止まるので、ブレークポイントを外してから続ける
+	c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": "script.mk"}, "breakpoints": []map[string]any{}})
+	c.request("continue", map[string]any{"threadId": 1})
+
+	var output struct {
+		Category string `json:"category"`
+		Output   string `json:"output"`
+	}
+	decodeJSON(t, c.waitEvent("output").Body, &output)
+	if output.Category != "stdout" || output.Output != "9\n" {
+		t.Errorf("出力がおかしいよ。got=%+v", output)
+	}
+
+	var exited struct {
+		ExitCode int `json:"exitCode"`
+	}
+	decodeJSON(t, c.waitEvent("exited").Body, &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("終了コードが 0 じゃないよ。got=%d", exited.ExitCode)
+	}
+	c.waitEvent("terminated")
+
+	c.request("disconnect", nil)
+	if err := <-done; err != nil {
+		t.Errorf("エラーで終わったよ: %s", err)
+	}
+}
+
+func TestDAPDisconnectWhileStopped(t *testing.T) {
+	c, done := startDAP(t, launchSource(script))
+
+	c.request("initialize", nil)
+	c.waitEvent("initialized")
+	c.request("launch", map[string]any{"program": "script.mk", "stopOnEntry": true})
+	c.request("configurationDone", nil)
+
+	var stopped struct {
+		Reason string `json:"reason"`
+	}
+	decodeJSON(t, c.waitEvent("stopped").Body, &stopped)
+	if stopped.Reason != "entry" {
+		t.Errorf("entry で止まってないよ。got=%q", stopped.Reason)
+	}
+
+	// 止まったままでも disconnect で終われる
+	c.request("disconnect", nil)
+	if err := <-done; err != nil {
+		t.Errorf("エラーで終わったよ: %s", err)
+	}
+}
+
+func TestDAPLaunchError(t *testing.T) {
+	c, _ := startDAP(t, launchSource("let = 1;"))
+
+	c.request("initialize", nil)
+	c.waitEvent("initialized")
+	resp := c.request("launch", map[string]any{"program": "broken.mk"})
+	if resp.Success {
+		t.Fatalf("パースエラーなのに launch が成功したよ")
+	}
+	if resp.Message == "" {
+		t.Errorf("エラーメッセージがないよ")
+	}
+
+	if resp := c.request("configurationDone", nil); resp.Success {
+		t.Errorf("launch してないのに configurationDone が成功したよ")
+	}
+}
@@ -0,0 +1,376 @@
+// Package debugger は Monkey のステップ実行デバッガ。
+// evaluator の評価のフック(object.EvalHooks)で文ごとに止まって、止まっている間のことはフロントエンドに任せる。
+// フロントエンドは端末で対話するもの(Console)と、エディタとしゃべる Debug Adapter Protocol(DAPServer)がある。
+package debugger
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/evaluator"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"gomonkey/token"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Action は止まったあとどう進むか
+type Action int
+
+const (
+	Continue Action = iota // 次のブレークポイントまで
+	StepIn                 // 次の文まで(関数の中にも入る)
+	StepOver               // 今の関数の次の文まで(呼んだ関数の中では止まらない)
+	StepOut                // 今の関数から戻ったところまで
+	Quit                   // 実行をやめる
+)
+
+// Reason はなぜ止まったか。DAP の stopped イベントの reason にそのまま使う
+type Reason string
+
+const (
+	ReasonEntry      Reason = "entry"
+	ReasonBreakpoint Reason = "breakpoint"
+	ReasonStep       Reason = "step"
+)
+
+// Frame は Monkey の呼び出しスタックの1段
+type Frame struct {
+	Name string              // 呼んだ関数の名前。トップレベルは "<main>"、名前のない関数は "<anonymous>"
+	Call *ast.CallExpression // この段を呼んだ式。トップレベルは nil
+	Pos  token.Position      // いま評価している文の位置
+	Env  *object.Environment // いま評価している文の環境
+}
+
+// Stop は止まったときの様子
+type Stop struct {
+	Reason Reason
+	Pos    token.Position
+	Node   ast.Statement
+	Frames []Frame // 内側(今止まっている関数)から順に
+}
+
+// Variable は変数1個。Value は1行で表示できるように縮めてある
+type Variable struct {
+	Name  string
+	Value string
+}
+
+// Debugger は object.EvalHooks を実装していて、止まるたびに pause を呼ぶ。
+// pause が返ってくるまで評価は止まったままになる。
+type Debugger struct {
+	pause func(*Stop) Action
+
+	mu          sync.Mutex // breakpoints を守る(DAP だと評価中にも書き換えられる)
+	breakpoints map[int]bool
+
+	action    Action
+	stopDepth int // StepOver / StepOut を始めたときのスタックの深さ
+	frames    []*Frame
+	globals   *object.Environment
+	started   bool // 最初の文まで来たか
+	suspended bool // print の評価中とか、止まっちゃいけないとき
+	quitting  int32
+
+	// StopOnEntry なら最初の文で止まる(デフォルト)。false なら最初のブレークポイントまで走る
+	StopOnEntry bool
+}
+
+// quitSignal は Quit のとき評価を途中で抜けるための panic。Run で recover する
+type quitSignal struct{}
+
+// New はデバッガを作る。pause は止まるたびに(評価している goroutine で)呼ばれる
+func New(pause func(*Stop) Action) *Debugger {
+	return &Debugger{
+		pause:       pause,
+		breakpoints: make(map[int]bool),
+		StopOnEntry: true,
+	}
+}
+
+// SetBreakpoint は line 行目にブレークポイントを置く
+func (d *Debugger) SetBreakpoint(line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.breakpoints[line] = true
+}
+
+// ClearBreakpoint は line 行目のブレークポイントを外す。なかったら false
+func (d *Debugger) ClearBreakpoint(line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.breakpoints[line] {
+		return false
+	}
+	delete(d.breakpoints, line)
+
+	return true
+}
+
+// ClearBreakpoints はブレークポイントを全部外す
+func (d *Debugger) ClearBreakpoints() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.breakpoints = make(map[int]bool)
+}
+
+// Breakpoints はブレークポイントのある行を小さい順に返す
+func (d *Debugger) Breakpoints() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lines := make([]int, 0, len(d.breakpoints))
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	return lines
+}
+
+func (d *Debugger) hasBreakpoint(line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.breakpoints[line]
+}
+
+// RequestQuit は実行中の評価を次の文で止めて終わらせる。止まっている(pause の中の)ときは pause から Quit を返すこと。
+// ほかの goroutine から呼んでいい。
+func (d *Debugger) RequestQuit() {
+	atomic.StoreInt32(&d.quitting, 1)
+}
+
+// Run は program を env で評価する。途中で Quit したら quit が true になって、result は nil。
+func (d *Debugger) Run(program *ast.Program, env *object.Environment) (result object.Object, quit bool) {
+	d.globals = env
+	d.frames = []*Frame{{Name: "<main>", Env: env}}
+	d.action = Continue
+	d.started = false
+
+	env.SetHooks(d)
+	defer env.SetHooks(nil)
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(quitSignal); !ok {
+				panic(r)
+			}
+			result, quit = nil, true
+		}
+	}()
+
+	return evaluator.Eval(program, env), false
+}
+
+func (d *Debugger) BeforeEval(node ast.Node, env *object.Environment) {
+	if d.suspended {
+		return
+	}
+	if atomic.LoadInt32(&d.quitting) != 0 {
+		panic(quitSignal{})
+	}
+
+	stmt, pos, ok := statementPos(node)
+	if !ok {
+		return
+	}
+
+	frame := d.frames[len(d.frames)-1]
+	previousLine := frame.Pos.Line
+	frame.Pos = pos
+	frame.Env = env
+
+	reason, stop := d.shouldStop(pos, previousLine)
+	if !stop {
+		return
+	}
+
+	action := d.pause(&Stop{Reason: reason, Pos: pos, Node: stmt, Frames: d.Frames()})
+	if action == Quit {
+		panic(quitSignal{})
+	}
+
+	d.action = action
+	d.stopDepth = len(d.frames)
+}
+
+func (d *Debugger) shouldStop(pos token.Position, previousLine int) (Reason, bool) {
+	if !d.started {
+		d.started = true
+		if d.StopOnEntry {
+			return ReasonEntry, true
+		}
+	}
+
+	depth := len(d.frames)
+
+	switch {
+	case d.action == StepIn:
+		return ReasonStep, true
+	case d.action == StepOver && depth <= d.stopDepth:
+		return ReasonStep, true
+	case d.action == StepOut && depth < d.stopDepth:
+		return ReasonStep, true
+	}
+
+	// 1行に文がいくつもあっても(`if (x) { y }` とか)、同じ段で同じ行にいる間は1回しか止まらない
+	if pos.Line != previousLine && d.hasBreakpoint(pos.Line) {
+		return ReasonBreakpoint, true
+	}
+
+	return "", false
+}
+
+func (d *Debugger) AfterEval(node ast.Node, env *object.Environment, result object.Object) {}
+
+// EnterFunction はユーザー定義関数のときだけスタックを積む。組み込み関数の中では止まりようがないので
+func (d *Debugger) EnterFunction(call *ast.CallExpression, fn object.Object, args []object.Object) {
+	if d.suspended {
+		return
+	}
+	if _, ok := fn.(*object.Function); !ok {
+		return
+	}
+
+	d.frames = append(d.frames, &Frame{Name: functionName(call), Call: call})
+}
+
+func (d *Debugger) ExitFunction(call *ast.CallExpression, fn object.Object, result object.Object) {
+	if d.suspended {
+		return
+	}
+	if _, ok := fn.(*object.Function); !ok {
+		return
+	}
+
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+// Frames は今の呼び出しスタックを内側から順に返す(コピーなので、後で評価が進んでも変わらない)
+func (d *Debugger) Frames() []Frame {
+	frames := make([]Frame, len(d.frames))
+	for i, frame := range d.frames {
+		frames[len(d.frames)-1-i] = *frame
+	}
+
+	return frames
+}
+
+// Locals は frame の中から見える変数のうち、グローバルでないものを内側から順に返す。
+// object.Environment を外側に向かってたどって、内側の同じ名前で隠れているものは飛ばす。
+func (d *Debugger) Locals(frame Frame) []Variable {
+	var vars []Variable
+	seen := make(map[string]bool)
+
+	for env := frame.Env; env != nil && env != d.globals; env = env.Outer() {
+		for _, name := range env.Names() {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			value, _ := env.Get(name)
+			vars = append(vars, Variable{Name: name, Value: Summary(value)})
+		}
+	}
+
+	return vars
+}
+
+// Globals はトップレベルの変数を返す
+func (d *Debugger) Globals() []Variable {
+	if d.globals == nil {
+		return nil
+	}
+
+	var vars []Variable
+	for _, name := range d.globals.Names() {
+		value, _ := d.globals.Get(name)
+		vars = append(vars, Variable{Name: name, Value: Summary(value)})
+	}
+
+	return vars
+}
+
+// Evaluate は止まっているところの環境 env で式を評価する。評価している間はどこにも止まらない。
+// 代入(let)もできちゃうので、変数を書き換えて続きを試すのにも使える。
+func (d *Debugger) Evaluate(input string, env *object.Environment) (object.Object, error) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), "; "))
+	}
+
+	d.suspended = true
+	defer func() { d.suspended = false }()
+
+	result := evaluator.Eval(program, env)
+	if result == nil {
+		return evaluator.NULL, nil
+	}
+
+	return result, nil
+}
+
+// Summary は値を1行で表示できる形にする。関数は本体まで出すと長いので引数だけ
+func Summary(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "nil"
+	case *object.Function:
+		return "fn(" + parameterList(obj.Parameters) + ") { ... }"
+	case *object.Macro:
+		return "macro(" + parameterList(obj.Parameters) + ") { ... }"
+	case *object.String:
+		return `"` + obj.Value + `"`
+	}
+
+	return strings.ReplaceAll(obj.Inspect(), "\n", " ")
+}
+
+func parameterList(parameters []*ast.Identifier) string {
+	names := make([]string, len(parameters))
+	for i, param := range parameters {
+		names[i] = param.Value
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func functionName(call *ast.CallExpression) string {
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		return ident.Value
+	}
+
+	return "<anonymous>"
+}
+
+// statementPos は止まる単位になる文とその位置を返す。ブロックは中の文で止まるので数えない
+func statementPos(node ast.Node) (ast.Statement, token.Position, bool) {
+	var pos token.Position
+
+	switch stmt := node.(type) {
+	case *ast.LetStatement:
+		pos = stmt.Token.Pos
+	case *ast.ReturnStatement:
+		pos = stmt.Token.Pos
+	case *ast.ExpressionStatement:
+		pos = stmt.Token.Pos
+	default:
+		return nil, pos, false
+	}
+
+	// マクロ展開で作られた文とか、位置がわからないものでは止まらない
+	if !pos.IsValid() {
+		return nil, pos, false
+	}
+
+	return node.(ast.Statement), pos, true
+}
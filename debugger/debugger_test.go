@@ -0,0 +1,175 @@
+package debugger_test
+
+import (
+	"gomonkey/debugger"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"reflect"
+	"testing"
+)
+
+const script = `let add = fn(a, b) {
+	let c = a + b;
+	c
+};
+let x = add(1, 2);
+let y = add(x, 3);
+x + y;
+`
+
+// runScript は actions の順に進めて、止まった行を記録する。actions が尽きたら Continue
+func runScript(t *testing.T, input string, breakpoints []int, actions ...debugger.Action) ([]int, object.Object) {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("パースエラーだよ: %v", p.Errors())
+	}
+
+	var lines []int
+	d := debugger.New(func(stop *debugger.Stop) debugger.Action {
+		lines = append(lines, stop.Pos.Line)
+		if len(actions) == 0 {
+			return debugger.Continue
+		}
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	})
+	for _, line := range breakpoints {
+		d.SetBreakpoint(line)
+	}
+
+	result, _ := d.Run(program, object.NewEnvironment())
+
+	return lines, result
+}
+
+func TestStepping(t *testing.T) {
+	tests := []struct {
+		name        string
+		breakpoints []int
+		actions     []debugger.Action
+		expected    []int
+	}{
+		{"最初の文で止まる", nil, nil, []int{1}},
+		{"step は関数の中に入る", nil, []debugger.Action{debugger.StepIn, debugger.StepIn, debugger.StepIn, debugger.StepIn}, []int{1, 5, 2, 3, 6}},
+		{"next は関数の中に入らない", nil, []debugger.Action{debugger.StepOver, debugger.StepOver, debugger.StepOver}, []int{1, 5, 6, 7}},
+		{"out は呼んだところまで戻る", []int{2}, []debugger.Action{debugger.Continue, debugger.StepOut}, []int{1, 2, 6, 2}},
+		{"ブレークポイントは呼ぶたびに止まる", []int{3}, nil, []int{1, 3, 3}},
+	}
+
+	for _, tt := range tests {
+		lines, result := runScript(t, script, tt.breakpoints, tt.actions...)
+
+		if !reflect.DeepEqual(lines, tt.expected) {
+			t.Errorf("%s: 止まった行が %v じゃないよ。got=%v", tt.name, tt.expected, lines)
+		}
+
+		if result.Inspect() != "9" {
+			t.Errorf("%s: 最後まで評価されてないよ。got=%s", tt.name, result.Inspect())
+		}
+	}
+}
+
+func TestBreakpointOncePerLine(t *testing.T) {
+	// 1行に文がいくつあっても1回だけ止まる
+	lines, _ := runScript(t, "let x = 1;\nif (x > 0) { let y = 2; y }\nx;", []int{2}, debugger.Continue)
+
+	if !reflect.DeepEqual(lines, []int{1, 2}) {
+		t.Errorf("止まった行がおかしいよ。got=%v", lines)
+	}
+}
+
+func TestQuit(t *testing.T) {
+	lines, result := runScript(t, script, nil, debugger.StepOver, debugger.Quit)
+
+	if !reflect.DeepEqual(lines, []int{1, 5}) {
+		t.Errorf("止まった行がおかしいよ。got=%v", lines)
+	}
+
+	if result != nil {
+		t.Errorf("quit したら結果は nil のはずだよ。got=%s", result.Inspect())
+	}
+}
+
+func TestStopState(t *testing.T) {
+	p := parser.New(lexer.New(script))
+	program := p.ParseProgram()
+
+	var (
+		d      *debugger.Debugger
+		frames []debugger.Frame
+		locals []debugger.Variable
+		value  string
+	)
+	d = debugger.New(func(stop *debugger.Stop) debugger.Action {
+		if stop.Reason != debugger.ReasonBreakpoint {
+			return debugger.Continue
+		}
+
+		frames = stop.Frames
+		locals = d.Locals(stop.Frames[0])
+
+		// 評価中の関数を呼んでもどこにも止まらないし、スタックもずれない
+		result, err := d.Evaluate("add(a, b) * 10", stop.Frames[0].Env)
+		if err != nil {
+			t.Fatalf("評価できないよ: %s", err)
+		}
+		value = result.Inspect()
+
+		return debugger.Quit
+	})
+	d.SetBreakpoint(3)
+
+	d.Run(program, object.NewEnvironment())
+
+	var names []string
+	for _, frame := range frames {
+		names = append(names, frame.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"add", "<main>"}) {
+		t.Errorf("スタックがおかしいよ。got=%v", names)
+	}
+
+	if frames[1].Pos.Line != 5 {
+		t.Errorf("呼んだ側の行が 5 じゃないよ。got=%d", frames[1].Pos.Line)
+	}
+
+	expected := []debugger.Variable{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "c", Value: "3"}}
+	if !reflect.DeepEqual(locals, expected) {
+		t.Errorf("ローカル変数がおかしいよ。got=%v", locals)
+	}
+
+	if value != "30" {
+		t.Errorf("評価の結果が 30 じゃないよ。got=%s", value)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	p := parser.New(lexer.New(`fn(x, y) { x + y }`))
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	d := debugger.New(func(*debugger.Stop) debugger.Action { return debugger.Continue })
+	d.StopOnEntry = false
+
+	fn, _ := d.Run(program, env)
+
+	tests := []struct {
+		obj      object.Object
+		expected string
+	}{
+		{fn, "fn(x, y) { ... }"},
+		{&object.String{Value: "hi"}, `"hi"`},
+		{&object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}, "[1]"},
+		{nil, "nil"},
+	}
+
+	for _, tt := range tests {
+		if got := debugger.Summary(tt.obj); got != tt.expected {
+			t.Errorf("%q じゃないよ。got=%q", tt.expected, got)
+		}
+	}
+}
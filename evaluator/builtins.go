@@ -1,127 +1,78 @@
 package evaluator
 
-import (
-	"fmt"
-	"gomonkey/object"
-)
-
-var builtins = map[string]*object.Builtin{
-	"len": {
-		Fn: func(args ...object.Object) object.Object {
-			// 配列とかハッシュマップに対してのlenはまたあとでな！
-			// わざわざビルトイン関数の実装の中で引数の数チェックをするのは分かる。
-			// なぜなら、len関数は引数が1個です」というドキュメント的な作用があるから
-			if len(args) != 1 {
-				return newError("argument error: wrong number of arguments (given %d, expected %d)", len(args), 1)
-			}
+import "gomonkey/object"
 
+// registerCoreBuiltins は名前空間なしの組み込み関数を登録する。
+// 引数の数と型は Signature で宣言しておけば Registry がチェックしてくれるので、Fn の中ではチェックしない。
+// (昔はそれぞれの Fn の頭で len(args) を見ていた。len関数は引数が1個です」というドキュメント的な作用はSignatureが引き継いだ)
+func registerCoreBuiltins(r *Registry) {
+	// 配列とかハッシュマップに対してのlenはまたあとでな！
+	r.Register("len", Signature{Params: []object.Type{OneOf(object.StringObj, object.ArrayObj)}},
+		func(args ...object.Object) object.Object {
 			switch arg := args[0].(type) {
 			case *object.String:
 				return &object.Integer{Value: int64(len(arg.Value))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
 			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"first": {
-		Fn: func(args ...object.Object) object.Object {
-			// 引数は1個でないとだめ
-			if len(args) != 1 {
-				return newError("argument error: wrong number of arguments (given %d, expected %d)", len(args), 1)
+				return &object.Integer{Value: int64(len(arg.(*object.Array).Elements))}
 			}
+		})
 
-			// 引数のデータ型が配列じゃないとだめ
-			switch arg := args[0].(type) {
-			case *object.Array:
-				// MEMO: 要素数が0なら、どうするか？ → myArray[0]と同じ挙動にするなら NULL を返す
-				if len(arg.Elements) == 0 {
-					return NULL
-				}
-				return arg.Elements[0]
-			default:
-				return newError("argument to `first` not supported, got %s", arg.Type())
-			}
-		},
-	},
-	"last": {
-		Fn: func(args ...object.Object) object.Object {
-			// 引数は1個でないとだめ
-			if len(args) != 1 {
-				return newError("argument error: wrong number of arguments (given %d, expected %d)", len(args), 1)
+	r.Register("first", Signature{Params: []object.Type{object.ArrayObj}},
+		func(args ...object.Object) object.Object {
+			arg := args[0].(*object.Array)
+			// MEMO: 要素数が0なら、どうするか？ → myArray[0]と同じ挙動にするなら NULL を返す
+			if len(arg.Elements) == 0 {
+				return NULL
 			}
+			return arg.Elements[0]
+		})
 
-			// 引数のデータ型が配列じゃないとだめ
-			switch arg := args[0].(type) {
-			case *object.Array:
-				// MEMO: 要素数が0なら、どうするか？ NULL にしました
-				if len(arg.Elements) == 0 {
-					return NULL
-				}
-				return arg.Elements[len(arg.Elements)-1]
-			default:
-				return newError("argument to `last` not supported, got %s", arg.Type())
+	r.Register("last", Signature{Params: []object.Type{object.ArrayObj}},
+		func(args ...object.Object) object.Object {
+			arg := args[0].(*object.Array)
+			// MEMO: 要素数が0なら、どうするか？ NULL にしました
+			if len(arg.Elements) == 0 {
+				return NULL
 			}
-		},
-	},
-	"rest": {
-		Fn: func(args ...object.Object) object.Object {
-			// 引数は1個でないとだめ
-			if len(args) != 1 {
-				return newError("argument error: wrong number of arguments (given %d, expected %d)", len(args), 1)
-			}
-
-			// 引数のデータ型が配列じゃないとだめ
-			switch arg := args[0].(type) {
-			case *object.Array:
-				// MEMO: 要素数が0の場合の rest は [] という設計もある。
-				length := len(arg.Elements)
-				if length == 0 {
-					return NULL
-				}
-
-				rest := make([]object.Object, length-1)
-				copy(rest, arg.Elements[1:length])
+			return arg.Elements[len(arg.Elements)-1]
+		})
 
-				return &object.Array{Elements: rest}
-			default:
-				return newError("argument to `rest` not supported, got %s", arg.Type())
-			}
-		},
-	},
-	"push": {
-		Fn: func(args ...object.Object) object.Object {
-			// 引数は2個でないとダメ
-			if len(args) != 2 {
-				return newError("argument error: wrong number of arguments (given %d, expected %d)", len(args), 2)
+	r.Register("rest", Signature{Params: []object.Type{object.ArrayObj}},
+		func(args ...object.Object) object.Object {
+			arg := args[0].(*object.Array)
+			// MEMO: 要素数が0の場合の rest は [] という設計もある。
+			length := len(arg.Elements)
+			if length == 0 {
+				return NULL
 			}
 
-			arg1 := args[0]
-			arg2 := args[1]
+			rest := make([]object.Object, length-1)
+			copy(rest, arg.Elements[1:length])
 
-			// 第1引数のデータ型が配列じゃないとだめ
-			if arg1.Type() != object.ArrayObj {
-				return newError("first argument to `push` not supported, got %s", arg1.Type())
-			}
+			return &object.Array{Elements: rest}
+		})
 
-			arrayOrg := arg1.(*object.Array)
-			newElements := append(arrayOrg.Elements, arg2)
+	r.Register("push", Signature{Params: []object.Type{object.ArrayObj, AnyType}},
+		func(args ...object.Object) object.Object {
+			arrayOrg := args[0].(*object.Array)
+			newElements := append(arrayOrg.Elements, args[1])
 			// make()で確保したほうが伸長しなくなるっぽいのでメモリ的に有利っぽい。
-			// そのときにappendじゃなくて、arr[length] = arg2 みたいな代入になって
+			// そのときにarr[length] = arg2 みたいな代入になって
 			// append感がちょっと減るじゃん？。
 			// それが嫌だなーっておもったので、append関数にしたんだと思います(後付)
 
 			return &object.Array{Elements: newElements}
-		},
-	},
-	"puts": {
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+		})
+
+	// gensym() か gensym("prefix") の2通り
+	r.Register("gensym", Signature{Params: []object.Type{object.StringObj}, Optional: 1},
+		func(args ...object.Object) object.Object {
+			prefix := "g"
+			if len(args) == 1 {
+				prefix = args[0].(*object.String).Value
 			}
 
-			return NULL
-		},
-	},
+			// unquote(gensym()) でASTに埋め込めるように Quote で包んで返す
+			return &object.Quote{Node: newIdentifier(gensym(prefix))}
+		})
 }
@@ -0,0 +1,210 @@
+package evaluator
+
+import (
+	"fmt"
+	"gomonkey/object"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// テストを書くための組み込み関数。失敗したらエラーを返すので、そこで評価が止まってテストが失敗になる。
+// 通ったら NULL(assert_error だけはエラーメッセージ)を返す。
+func registerAssertBuiltins(r *Registry) {
+	// assert(cond) / assert(cond, "メッセージ")。cond が偽っぽかったら失敗
+	r.Register("assert", Signature{Params: []object.Type{AnyType, object.StringObj}, Optional: 1},
+		func(args ...object.Object) object.Object {
+			if isTruthy(args[0]) {
+				return NULL
+			}
+			return newError("%s", assertionHeader("assert", args[1:]))
+		})
+
+	// assert_eq(got, want) / assert_eq(got, want, "メッセージ")。配列とハッシュは中身まで比べる
+	r.Register("assert_eq", Signature{Params: []object.Type{AnyType, AnyType, object.StringObj}, Optional: 1},
+		func(args ...object.Object) object.Object {
+			got, want := args[0], args[1]
+
+			diff := firstDifference(got, want, "")
+			if diff == nil {
+				return NULL
+			}
+
+			var b strings.Builder
+			b.WriteString(assertionHeader("assert_eq", args[2:]))
+			g, w := inspectPair(got, want)
+			fmt.Fprintf(&b, "\n\tgot:  %s\n\twant: %s", g, w)
+			// 配列とかハッシュの中で違っていたら、どこが違うのかも出す
+			if diff.path != "" {
+				g, w := inspectPair(diff.got, diff.want)
+				fmt.Fprintf(&b, "\n\tdiff: at %s: got %s, want %s", diff.path, g, w)
+			}
+			return newError("%s", b.String())
+		})
+
+	// assert_error(fn() { ... }) / assert_error(fn() { ... }, "含まれるはずの文字列")。
+	// 引数で直接エラーを渡すと、assert_error を呼ぶ前に評価が止まってしまうので、関数にくるんで渡す。
+	// 通ったらエラーメッセージを文字列で返すので、もっと細かく調べたければそれを使う。
+	r.Register("assert_error", Signature{Params: []object.Type{object.FunctionObj, object.StringObj}, Optional: 1},
+		func(args ...object.Object) object.Object {
+			fn := args[0].(*object.Function)
+			if len(fn.Parameters) != 0 {
+				return newError("assert_error: function must take no arguments, got %d", len(fn.Parameters))
+			}
+
+			// ユーザー定義関数の中の入出力は、関数の環境の IO を使うので、ここで環境はいらない
+			result := applyFunction(fn, nil, nil)
+			errObj, ok := result.(*object.Error)
+			if !ok {
+				return newError("assert_error failed: expected an error\n\tgot:  %s", result.Inspect())
+			}
+
+			if len(args) == 2 {
+				substr := args[1].(*object.String).Value
+				if !strings.Contains(errObj.Message, substr) {
+					return newError("assert_error failed: error does not contain %q\n\tgot:  %s", substr, errObj.Message)
+				}
+			}
+
+			return &object.String{Value: errObj.Message}
+		})
+}
+
+// assertionHeader は "assert_eq failed" か、メッセージがあれば "assert_eq failed: メッセージ"
+func assertionHeader(name string, message []object.Object) string {
+	if len(message) == 0 {
+		return name + " failed"
+	}
+
+	return name + " failed: " + message[0].(*object.String).Value
+}
+
+// difference は assert_eq で最初に違っていたところ。path は `[1]["name"]` みたいな形で、一番外側なら ""
+type difference struct {
+	path      string
+	got, want object.Object // どっちかにしかなかったら、ないほうは nil
+}
+
+// firstDifference は got と want を中身まで比べて、最初に違っていたところを返す。同じなら nil。
+// ハッシュのキーは Inspect の順に見るので、何回やっても同じところを返す。
+func firstDifference(got, want object.Object, path string) *difference {
+	diff := &difference{path: path, got: got, want: want}
+
+	switch g := got.(type) {
+	case *object.Integer, *object.BigInteger:
+		x, y := toBigInt(g), toBigInt(want)
+		if y != nil && x.Cmp(y) == 0 {
+			return nil
+		}
+
+	case *object.String:
+		if w, ok := want.(*object.String); ok && g.Value == w.Value {
+			return nil
+		}
+
+	case *object.Boolean:
+		if w, ok := want.(*object.Boolean); ok && g.Value == w.Value {
+			return nil
+		}
+
+	case *object.Null:
+		if _, ok := want.(*object.Null); ok {
+			return nil
+		}
+
+	case *object.Array:
+		w, ok := want.(*object.Array)
+		if !ok {
+			return diff
+		}
+		for i := 0; i < len(g.Elements) || i < len(w.Elements); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(w.Elements):
+				return &difference{path: elemPath, got: g.Elements[i]}
+			case i >= len(g.Elements):
+				return &difference{path: elemPath, want: w.Elements[i]}
+			}
+			if d := firstDifference(g.Elements[i], w.Elements[i], elemPath); d != nil {
+				return d
+			}
+		}
+		return nil
+
+	case *object.Hash:
+		w, ok := want.(*object.Hash)
+		if !ok {
+			return diff
+		}
+		for _, key := range sortedHashKeys(g, w) {
+			keyPath := fmt.Sprintf("%s[%s]", path, keyInspect(key))
+			hashKey := key.(object.Hashable).HashKey()
+			x, inGot := g.Pairs[hashKey]
+			y, inWant := w.Pairs[hashKey]
+			switch {
+			case !inWant:
+				return &difference{path: keyPath, got: x.Value}
+			case !inGot:
+				return &difference{path: keyPath, want: y.Value}
+			}
+			if d := firstDifference(x.Value, y.Value, keyPath); d != nil {
+				return d
+			}
+		}
+		return nil
+
+	default:
+		// 関数とかは同じものかどうかだけ
+		if got == want {
+			return nil
+		}
+	}
+
+	return diff
+}
+
+// sortedHashKeys は2つのハッシュのキーを全部、Inspect の順に並べて返す
+func sortedHashKeys(a, b *object.Hash) []object.Object {
+	seen := make(map[object.HashKey]bool)
+	var keys []object.Object
+	for _, h := range []*object.Hash{a, b} {
+		for hashKey, pair := range h.Pairs {
+			if !seen[hashKey] {
+				seen[hashKey] = true
+				keys = append(keys, pair.Key)
+			}
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Inspect() < keys[j].Inspect() })
+
+	return keys
+}
+
+// inspectPair は got と want を Inspect する。文字列の "1" と数の 1 みたいに見た目が同じになるときは、型も付ける
+func inspectPair(got, want object.Object) (string, string) {
+	g, w := inspectOrMissing(got), inspectOrMissing(want)
+	if g == w && got != nil && want != nil && typeOf(got) != typeOf(want) {
+		g += " (" + string(typeOf(got)) + ")"
+		w += " (" + string(typeOf(want)) + ")"
+	}
+
+	return g, w
+}
+
+func inspectOrMissing(obj object.Object) string {
+	if obj == nil {
+		return "(missing)"
+	}
+
+	return obj.Inspect()
+}
+
+// keyInspect はハッシュのキーを path に書く形にする。文字列は "" で囲む
+func keyInspect(key object.Object) string {
+	if str, ok := key.(*object.String); ok {
+		return strconv.Quote(str.Value)
+	}
+
+	return key.Inspect()
+}
@@ -0,0 +1,50 @@
+package evaluator_test
+
+import "testing"
+
+func TestAssertBuiltins(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`assert(1 < 2)`, "NULL"},
+		{`assert(false)`, "assert failed"},
+		{`assert(null, "must be set")`, "assert failed: must be set"},
+		{`assert(true, 1)`, "second argument to `assert` not supported, got INTEGER"},
+
+		{`assert_eq(1 + 1, 2)`, "NULL"},
+		{`assert_eq(9223372036854775807 + 1, 9223372036854775808)`, "NULL"},
+		{`assert_eq([1, [2, "a"]], [1, [2, "a"]])`, "NULL"},
+		{`assert_eq({"a": 1, "b": [true]}, {"b": [true], "a": 1})`, "NULL"},
+		{`assert_eq(len, len)`, "NULL"},
+		{`assert_eq(1, 2)`, "assert_eq failed\n\tgot:  1\n\twant: 2"},
+		{`assert_eq("1", 1, "types")`, "assert_eq failed: types\n\tgot:  1 (STRING)\n\twant: 1 (INTEGER)"},
+		{`assert_eq([1, [2, 3]], [1, [2, 4]])`, "assert_eq failed\n\tgot:  [1, [2, 3]]\n\twant: [1, [2, 4]]\n\tdiff: at [1][1]: got 3, want 4"},
+		{`assert_eq([1], [1, 2])`, "assert_eq failed\n\tgot:  [1]\n\twant: [1, 2]\n\tdiff: at [1]: got (missing), want 2"},
+		{`assert_eq({"a": 1}, {"a": 2})`, "assert_eq failed\n\tgot:  {a: 1}\n\twant: {a: 2}\n\tdiff: at [\"a\"]: got 1, want 2"},
+		{`assert_eq({"a": 1}, {})`, "assert_eq failed\n\tgot:  {a: 1}\n\twant: {}\n\tdiff: at [\"a\"]: got 1, want (missing)"},
+		{`assert_eq([1, "2"], [1, 2])`, "assert_eq failed\n\tgot:  [1, 2]\n\twant: [1, 2]\n\tdiff: at [1]: got 2 (STRING), want 2 (INTEGER)"},
+		{`assert_eq(fn() { 1 }, fn() { 1 })`, "assert_eq failed\n\tgot:  fn() {\n1\n}\n\twant: fn() {\n1\n}"},
+
+		{`assert_error(fn() { 1 + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`assert_error(fn() { 1 + true }, "mismatch")`, "type mismatch: INTEGER + BOOLEAN"},
+		{`assert_error(fn() { 1 + true }, "unknown")`, "assert_error failed: error does not contain \"unknown\"\n\tgot:  type mismatch: INTEGER + BOOLEAN"},
+		{`assert_error(fn() { 1 })`, "assert_error failed: expected an error\n\tgot:  1"},
+		{`assert_error(fn(x) { x })`, "assert_error: function must take no arguments, got 1"},
+		{`assert_error(len)`, "first argument to `assert_error` not supported, got BUILTIN"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			got := inspectResult(testEval(tt.input))
+			if got != tt.expected {
+				t.Errorf("%q じゃないよ。got=%q", tt.expected, got)
+			}
+		})
+	}
+}
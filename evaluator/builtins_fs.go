@@ -0,0 +1,73 @@
+package evaluator
+
+import (
+	"gomonkey/object"
+	"os"
+	"sort"
+)
+
+// fs モジュール。CapabilityFS を Grant したときだけ登録される。
+// 失敗したら Go のエラーメッセージをそのまま Monkey のエラーにする。
+func registerFSModule(r *Registry) {
+	r.Register("fs.read_file", Signature{Params: []object.Type{object.StringObj}},
+		func(args ...object.Object) object.Object {
+			content, err := os.ReadFile(args[0].(*object.String).Value)
+			if err != nil {
+				return newError("fs.read_file: %s", err)
+			}
+			return &object.String{Value: string(content)}
+		})
+
+	r.Register("fs.write_file", Signature{Params: []object.Type{object.StringObj, object.StringObj}},
+		func(args ...object.Object) object.Object {
+			if err := os.WriteFile(args[0].(*object.String).Value, []byte(args[1].(*object.String).Value), 0o644); err != nil {
+				return newError("fs.write_file: %s", err)
+			}
+			return NULL
+		})
+
+	r.Register("fs.exists", Signature{Params: []object.Type{object.StringObj}},
+		func(args ...object.Object) object.Object {
+			_, err := os.Stat(args[0].(*object.String).Value)
+			return nativeBoolToBooleanObject(err == nil)
+		})
+
+	// list_dir はファイル名だけの配列を名前順で返す
+	r.Register("fs.list_dir", Signature{Params: []object.Type{object.StringObj}},
+		func(args ...object.Object) object.Object {
+			entries, err := os.ReadDir(args[0].(*object.String).Value)
+			if err != nil {
+				return newError("fs.list_dir: %s", err)
+			}
+
+			names := make([]string, len(entries))
+			for i, entry := range entries {
+				names[i] = entry.Name()
+			}
+			sort.Strings(names)
+
+			elements := make([]object.Object, len(names))
+			for i, name := range names {
+				elements[i] = &object.String{Value: name}
+			}
+			return &object.Array{Elements: elements}
+		})
+
+	// mkdir は途中のディレクトリもまとめて作る(mkdir -p)
+	r.Register("fs.mkdir", Signature{Params: []object.Type{object.StringObj}},
+		func(args ...object.Object) object.Object {
+			if err := os.MkdirAll(args[0].(*object.String).Value, 0o755); err != nil {
+				return newError("fs.mkdir: %s", err)
+			}
+			return NULL
+		})
+
+	// remove はファイルか空のディレクトリを消す。中身ごと消す rm -rf はうっかりが怖いので用意しない
+	r.Register("fs.remove", Signature{Params: []object.Type{object.StringObj}},
+		func(args ...object.Object) object.Object {
+			if err := os.Remove(args[0].(*object.String).Value); err != nil {
+				return newError("fs.remove: %s", err)
+			}
+			return NULL
+		})
+}
@@ -0,0 +1,64 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"gomonkey/object"
+	"io"
+	"strings"
+)
+
+// 入出力の組み込み関数。fmt.Println でプロセスの stdout に直接書くんじゃなくて、環境の IO を使う。
+// 文字列リテラルにエスケープ(\n とか)がないので、改行ありとなしの両方を用意している。
+func registerIOBuiltins(r *Registry) {
+	// puts は引数を1個ずつ改行付きで書く
+	r.RegisterIO("puts", Signature{Variadic: AnyType},
+		func(io *object.IO, args ...object.Object) object.Object {
+			return writeLines(io.Stdout, args)
+		})
+
+	// print は改行なしで、引数をくっつけて書く。print("name? ") みたいなプロンプト用
+	r.RegisterIO("print", Signature{Variadic: AnyType},
+		func(io *object.IO, args ...object.Object) object.Object {
+			var b strings.Builder
+			for _, arg := range args {
+				b.WriteString(arg.Inspect())
+			}
+			if _, err := fmt.Fprint(io.Stdout, b.String()); err != nil {
+				return newError("print: %s", err)
+			}
+			return NULL
+		})
+
+	// eprint は puts の stderr 版
+	r.RegisterIO("eprint", Signature{Variadic: AnyType},
+		func(io *object.IO, args ...object.Object) object.Object {
+			return writeLines(io.Stderr, args)
+		})
+
+	// read_line は1行読んで、改行を取った文字列を返す。もう読むものがなければ NULL。
+	r.RegisterIO("read_line", Signature{},
+		func(stdio *object.IO, args ...object.Object) object.Object {
+			line, err := stdio.Stdin.ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return newError("read_line: %s", err)
+			}
+			if err != nil && line == "" {
+				return NULL
+			}
+
+			line = strings.TrimSuffix(line, "\n")
+			line = strings.TrimSuffix(line, "\r")
+			return &object.String{Value: line}
+		})
+}
+
+func writeLines(w io.Writer, args []object.Object) object.Object {
+	for _, arg := range args {
+		if _, err := fmt.Fprintln(w, arg.Inspect()); err != nil {
+			return newError("%s", err)
+		}
+	}
+
+	return NULL
+}
@@ -0,0 +1,59 @@
+package evaluator_test
+
+import (
+	"bytes"
+	"gomonkey/evaluator"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestIOBuiltins(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input          string
+		stdin          string
+		expected       string
+		expectedStdout string
+		expectedStderr string
+	}{
+		{`puts(1, "a", [true])`, "", "NULL", "1\na\n[true]\n", ""},
+		{`print("name? ", 1, 2)`, "", "NULL", "name? 12", ""},
+		{`eprint("oops", 1)`, "", "NULL", "", "oops\n1\n"},
+		{`read_line()`, "hello\nworld\n", "hello", "", ""},
+		{`let a = read_line(); let b = read_line(); a + b`, "hello\r\nworld", "helloworld", "", ""},
+		{`read_line()`, "", "NULL", "", ""},
+		{`let f = fn(x) { puts(x) }; f(42)`, "", "NULL", "42\n", ""},
+		{`read_line(1)`, "", "argument error: wrong number of arguments (given 1, expected 0)", "", ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout, stderr bytes.Buffer
+			env := object.NewEnvironment()
+			env.SetIO(object.NewIO(strings.NewReader(tt.stdin), &stdout, &stderr))
+
+			evaluated := evaluator.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+
+			got := evaluated.Inspect()
+			if errObj, ok := evaluated.(*object.Error); ok {
+				got = errObj.Message
+			}
+			if got != tt.expected {
+				t.Errorf("%q じゃないよ。got=%q", tt.expected, got)
+			}
+			if stdout.String() != tt.expectedStdout {
+				t.Errorf("stdout が %q じゃないよ。got=%q", tt.expectedStdout, stdout.String())
+			}
+			if stderr.String() != tt.expectedStderr {
+				t.Errorf("stderr が %q じゃないよ。got=%q", tt.expectedStderr, stderr.String())
+			}
+		})
+	}
+}
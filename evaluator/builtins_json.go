@@ -0,0 +1,171 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gomonkey/object"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// JSON と Monkey のオブジェクトの変換。
+// Monkey には小数がないので、JSON の数値は整数だけ。大きすぎる整数は BigInteger になる。
+func registerJSONBuiltins(r *Registry) {
+	r.Register("json_parse", Signature{Params: []object.Type{object.StringObj}},
+		func(args ...object.Object) object.Object {
+			obj, err := parseJSON(args[0].(*object.String).Value)
+			if err != nil {
+				return newError("json_parse: %s", err)
+			}
+			return obj
+		})
+
+	// json_stringify(value) は1行で、json_stringify(value, 2) や json_stringify(value, "  ") なら字下げして書く。
+	// ハッシュのキーはいつも名前順に並べる(Hash.Inspect と違って、何回やっても同じ文字列になる)
+	r.Register("json_stringify", Signature{Params: []object.Type{AnyType, OneOf(object.IntegerObj, object.StringObj)}, Optional: 1},
+		func(args ...object.Object) object.Object {
+			indent := ""
+			if len(args) == 2 {
+				switch arg := args[1].(type) {
+				case *object.String:
+					indent = arg.Value
+				case *object.Integer:
+					if arg.Value < 0 || arg.Value > 10 {
+						return newError("json_stringify: indent must be between 0 and 10, got %d", arg.Value)
+					}
+					indent = strings.Repeat(" ", int(arg.Value))
+				default:
+					return newError("json_stringify: indent out of range, got %s", arg.Inspect())
+				}
+			}
+
+			text, err := stringifyJSON(args[0], indent)
+			if err != nil {
+				return newError("json_stringify: %s", err)
+			}
+			return &object.String{Value: text}
+		})
+}
+
+func parseJSON(text string) (object.Object, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	// 数値を float64 にされると大きい整数が丸まっちゃうので、文字列のまま受け取る
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	// `1 2` みたいに、後ろに余計なものがあったらエラーにする
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+
+	return jsonValueToObject(value)
+}
+
+func jsonValueToObject(value any) (object.Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		return nativeBoolToBooleanObject(value), nil
+	case string:
+		return &object.String{Value: value}, nil
+	case json.Number:
+		integer, ok := new(big.Int).SetString(value.String(), 10)
+		if !ok {
+			return nil, fmt.Errorf("non-integer number %s is not supported", value)
+		}
+		return newIntegerObject(integer), nil
+	case []any:
+		elements := make([]object.Object, len(value))
+		for i, element := range value {
+			obj, err := jsonValueToObject(element)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = obj
+		}
+		return &object.Array{Elements: elements}, nil
+	case map[string]any:
+		pairs := make(map[object.HashKey]object.HashPair, len(value))
+		for key, element := range value {
+			obj, err := jsonValueToObject(element)
+			if err != nil {
+				return nil, err
+			}
+			keyObj := &object.String{Value: key}
+			pairs[keyObj.HashKey()] = object.HashPair{Key: keyObj, Value: obj}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	default:
+		return nil, fmt.Errorf("unexpected JSON value %T", value)
+	}
+}
+
+func stringifyJSON(obj object.Object, indent string) (string, error) {
+	value, err := objectToJSONValue(obj)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// "<" とかを < にされると読みにくいので、HTML 用のエスケープはしない
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+
+	// Encode は最後に改行を付けるので取る
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// objectToJSONValue は encoding/json に渡せる値にする。
+// ハッシュは map[string]any にしておけば、encoding/json がキーを名前順に並べてくれる。
+func objectToJSONValue(obj object.Object) (any, error) {
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.BigInteger:
+		return json.Number(obj.Value.String()), nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Array:
+		elements := make([]any, len(obj.Elements))
+		for i, element := range obj.Elements {
+			value, err := objectToJSONValue(element)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = value
+		}
+		return elements, nil
+	case *object.Hash:
+		pairs := make(map[string]any, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return nil, fmt.Errorf("hash key must be STRING, got %s", typeOf(pair.Key))
+			}
+			value, err := objectToJSONValue(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			pairs[key.Value] = value
+		}
+		return pairs, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to JSON", typeOf(obj))
+	}
+}
@@ -0,0 +1,89 @@
+package evaluator_test
+
+import (
+	"gomonkey/evaluator"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"testing"
+)
+
+func TestJSONBuiltins(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("123")`, "123"},
+		{`json_parse("-5")`, "-5"},
+		{`json_parse("123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{`json_parse("true")`, "true"},
+		{`json_parse("null")`, "NULL"},
+		{`json_parse("[1, [2], []]")`, "[1, [2], []]"},
+		{`json_parse("1.5")`, "json_parse: non-integer number 1.5 is not supported"},
+		{`json_parse("[1,")`, "json_parse: unexpected EOF"},
+		{`json_parse("1 2")`, "json_parse: unexpected data after top-level value"},
+		{`json_parse(1)`, "argument to `json_parse` not supported, got INTEGER"},
+
+		{`json_stringify(1)`, "1"},
+		{`json_stringify("a<b")`, `"a<b"`},
+		{`json_stringify(null)`, "null"},
+		{`json_stringify([1, true, "x", null])`, `[1,true,"x",null]`},
+		// キーは何回やっても名前順
+		{`json_stringify({"b": 2, "a": 1, "c": {"z": [], "y": {}}})`, `{"a":1,"b":2,"c":{"y":{},"z":[]}}`},
+		{`json_stringify({"b": [1], "a": 1}, 2)`, "{\n  \"a\": 1,\n  \"b\": [\n    1\n  ]\n}"},
+		{`json_stringify([1], "--")`, "[\n--1\n]"},
+		{`json_stringify(9223372036854775807 + 1)`, "9223372036854775808"},
+		{`json_stringify(fn(x) { x })`, "json_stringify: cannot convert FUNCTION to JSON"},
+		{`json_stringify([len])`, "json_stringify: cannot convert BUILTIN to JSON"},
+		{`json_stringify({1: "a"})`, "json_stringify: hash key must be STRING, got INTEGER"},
+		{`json_stringify(1, -1)`, "json_stringify: indent must be between 0 and 10, got -1"},
+		{`json_stringify(1, true)`, "second argument to `json_stringify` not supported, got BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			got := inspectResult(testEval(tt.input))
+			if got != tt.expected {
+				t.Errorf("%q じゃないよ。got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// Monkey の文字列リテラルには \" が書けないので、" の入った JSON は Go 側で変数 text に入れておく
+func TestJSONParseObject(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		text     string
+		input    string
+		expected string
+	}{
+		{`{"a": [1, 2]}`, `json_parse(text)["a"]`, "[1, 2]"},
+		{`{"b": {"c": "x"}}`, `json_parse(text)["b"]["c"]`, "x"},
+		{`{"k": [1, {"n": null}], "e": "<&>"}`, `json_stringify(json_parse(text))`, `{"e":"<&>","k":[1,{"n":null}]}`},
+		{`{"a": 1, "a": 2}`, `json_parse(text)["a"]`, "2"},
+		{`{"a": 1.5}`, `json_parse(text)`, "json_parse: non-integer number 1.5 is not supported"},
+		{`{"a" 1}`, `json_parse(text)`, "json_parse: invalid character '1' after object key"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.text, func(t *testing.T) {
+			t.Parallel()
+
+			env := object.NewEnvironment()
+			env.Set("text", &object.String{Value: tt.text})
+
+			got := inspectResult(evaluator.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env))
+			if got != tt.expected {
+				t.Errorf("%q じゃないよ。got=%q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package evaluator
+
+import (
+	"gomonkey/object"
+	"math/big"
+)
+
+// math モジュール。Monkey には整数しかないので、全部整数で計算する(sqrt も切り捨て)。
+// BigInteger も INTEGER なので、math/big で計算して newIntegerObject で戻せば両方いける。
+func registerMathModule(r *Registry) {
+	r.Register("math.abs", Signature{Params: []object.Type{object.IntegerObj}},
+		func(args ...object.Object) object.Object {
+			return newIntegerObject(new(big.Int).Abs(toBigInt(args[0])))
+		})
+
+	r.Register("math.max", Signature{Params: []object.Type{object.IntegerObj}, Variadic: object.IntegerObj},
+		func(args ...object.Object) object.Object {
+			return pickInteger(args, 1)
+		})
+
+	r.Register("math.min", Signature{Params: []object.Type{object.IntegerObj}, Variadic: object.IntegerObj},
+		func(args ...object.Object) object.Object {
+			return pickInteger(args, -1)
+		})
+
+	r.Register("math.pow", Signature{Params: []object.Type{object.IntegerObj, object.IntegerObj}},
+		func(args ...object.Object) object.Object {
+			exponent := toBigInt(args[1])
+			if exponent.Sign() < 0 {
+				return newError("math.pow: negative exponent %s", exponent)
+			}
+			base := toBigInt(args[0])
+			if powTooLarge(base, exponent) {
+				return newError("math.pow: result too large (more than %d bits)", maxPowBits)
+			}
+			return newIntegerObject(new(big.Int).Exp(base, exponent, nil))
+		})
+
+	r.Register("math.sqrt", Signature{Params: []object.Type{object.IntegerObj}},
+		func(args ...object.Object) object.Object {
+			value := toBigInt(args[0])
+			if value.Sign() < 0 {
+				return newError("math.sqrt: negative argument %s", value)
+			}
+			return newIntegerObject(new(big.Int).Sqrt(value))
+		})
+}
+
+// maxPowBits は math.pow の結果の大きさの上限(ビット数)。
+// 上限がないと math.pow(2, 100000000000) みたいなので計算が終わらなくなって、インタプリタごと固まっちゃう
+const maxPowBits = 1 << 20
+
+// powTooLarge は base の exponent 乗が maxPowBits ビットより大きくなるか。
+// |base| >= 2 なら結果は少なくとも (base のビット数 - 1) * exponent ビットあるので、それで判断する。0, 1, -1 は何乗しても小さい
+func powTooLarge(base, exponent *big.Int) bool {
+	bits := new(big.Int).Abs(base).BitLen() - 1
+	if bits < 1 {
+		return false
+	}
+
+	minBits := new(big.Int).Mul(big.NewInt(int64(bits)), exponent)
+	return minBits.Cmp(big.NewInt(maxPowBits)) > 0
+}
+
+// pickInteger は sign が 1 なら一番大きい整数、-1 なら一番小さい整数を返す
+func pickInteger(args []object.Object, sign int) object.Object {
+	picked := args[0]
+	for _, arg := range args[1:] {
+		if toBigInt(arg).Cmp(toBigInt(picked)) == sign {
+			picked = arg
+		}
+	}
+
+	return picked
+}
@@ -0,0 +1,61 @@
+package evaluator
+
+import (
+	"gomonkey/object"
+	"os"
+)
+
+// os モジュール。CapabilityOS を Grant したときだけ登録される。
+// 引数と終了コードは本物のプロセスのじゃなくて、Grant に渡した Process のものを読み書きする。
+func registerOSModule(r *Registry, process *Process) {
+	// getenv は設定されていなければ NULL
+	r.Register("os.getenv", Signature{Params: []object.Type{object.StringObj}},
+		func(args ...object.Object) object.Object {
+			value, ok := os.LookupEnv(args[0].(*object.String).Value)
+			if !ok {
+				return NULL
+			}
+			return &object.String{Value: value}
+		})
+
+	r.Register("os.setenv", Signature{Params: []object.Type{object.StringObj, object.StringObj}},
+		func(args ...object.Object) object.Object {
+			if err := os.Setenv(args[0].(*object.String).Value, args[1].(*object.String).Value); err != nil {
+				return newError("os.setenv: %s", err)
+			}
+			return NULL
+		})
+
+	r.Register("os.args", Signature{},
+		func(args ...object.Object) object.Object {
+			elements := make([]object.Object, len(process.Args))
+			for i, arg := range process.Args {
+				elements[i] = &object.String{Value: arg}
+			}
+			return &object.Array{Elements: elements}
+		})
+
+	// exit_code(n) は終了コードを n にする。exit_code() なら今の終了コードを返す
+	r.Register("os.exit_code", Signature{Params: []object.Type{object.IntegerObj}, Optional: 1},
+		func(args ...object.Object) object.Object {
+			if len(args) == 0 {
+				return &object.Integer{Value: int64(process.ExitCode)}
+			}
+
+			code, ok := args[0].(*object.Integer)
+			if !ok || code.Value < 0 || code.Value > 255 {
+				return newError("os.exit_code: exit code must be between 0 and 255, got %s", args[0].Inspect())
+			}
+			process.ExitCode = int(code.Value)
+			return NULL
+		})
+
+	r.Register("os.cwd", Signature{},
+		func(args ...object.Object) object.Object {
+			dir, err := os.Getwd()
+			if err != nil {
+				return newError("os.cwd: %s", err)
+			}
+			return &object.String{Value: dir}
+		})
+}
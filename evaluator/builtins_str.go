@@ -0,0 +1,55 @@
+package evaluator
+
+import (
+	"gomonkey/object"
+	"strings"
+)
+
+// str モジュール。中身はほぼ Go の strings パッケージそのまま。
+func registerStrModule(r *Registry) {
+	r.Register("str.split", Signature{Params: []object.Type{object.StringObj, object.StringObj}},
+		func(args ...object.Object) object.Object {
+			parts := strings.Split(args[0].(*object.String).Value, args[1].(*object.String).Value)
+
+			elements := make([]object.Object, len(parts))
+			for i, part := range parts {
+				elements[i] = &object.String{Value: part}
+			}
+			return &object.Array{Elements: elements}
+		})
+
+	r.Register("str.join", Signature{Params: []object.Type{object.ArrayObj, object.StringObj}},
+		func(args ...object.Object) object.Object {
+			elements := args[0].(*object.Array).Elements
+
+			parts := make([]string, len(elements))
+			for i, element := range elements {
+				str, ok := element.(*object.String)
+				if !ok {
+					return newError("str.join: array element %d must be STRING, got %s", i, typeOf(element))
+				}
+				parts[i] = str.Value
+			}
+			return &object.String{Value: strings.Join(parts, args[1].(*object.String).Value)}
+		})
+
+	r.Register("str.upper", Signature{Params: []object.Type{object.StringObj}},
+		func(args ...object.Object) object.Object {
+			return &object.String{Value: strings.ToUpper(args[0].(*object.String).Value)}
+		})
+
+	r.Register("str.lower", Signature{Params: []object.Type{object.StringObj}},
+		func(args ...object.Object) object.Object {
+			return &object.String{Value: strings.ToLower(args[0].(*object.String).Value)}
+		})
+
+	r.Register("str.trim", Signature{Params: []object.Type{object.StringObj}},
+		func(args ...object.Object) object.Object {
+			return &object.String{Value: strings.TrimSpace(args[0].(*object.String).Value)}
+		})
+
+	r.Register("str.contains", Signature{Params: []object.Type{object.StringObj, object.StringObj}},
+		func(args ...object.Object) object.Object {
+			return nativeBoolToBooleanObject(strings.Contains(args[0].(*object.String).Value, args[1].(*object.String).Value))
+		})
+}
@@ -0,0 +1,40 @@
+package evaluator
+
+import (
+	"gomonkey/object"
+	"math"
+	"time"
+)
+
+// time モジュール。CapabilityTime を Grant したときだけ登録される。
+// Monkey には整数しかないので、時刻は Unix エポックからのミリ秒、長さもミリ秒で扱う。
+func registerTimeModule(r *Registry) {
+	r.Register("time.now", Signature{},
+		func(args ...object.Object) object.Object {
+			return &object.Integer{Value: time.Now().UnixMilli()}
+		})
+
+	r.Register("time.sleep", Signature{Params: []object.Type{object.IntegerObj}},
+		func(args ...object.Object) object.Object {
+			ms, ok := args[0].(*object.Integer)
+			if !ok || ms.Value < 0 {
+				return newError("time.sleep: duration must be a non-negative number of milliseconds, got %s", args[0].Inspect())
+			}
+			// time.Duration はナノ秒の int64 なので、大きすぎるとかけ算であふれて負の数になり、すぐ戻ってきちゃう
+			if ms.Value > math.MaxInt64/int64(time.Millisecond) {
+				return newError("time.sleep: duration too large, got %s", args[0].Inspect())
+			}
+			time.Sleep(time.Duration(ms.Value) * time.Millisecond)
+			return NULL
+		})
+
+	// format(ms, layout) の layout は Go の time パッケージと同じ書き方("2006-01-02 15:04:05" とか)。UTC で書く
+	r.Register("time.format", Signature{Params: []object.Type{object.IntegerObj, object.StringObj}},
+		func(args ...object.Object) object.Object {
+			ms, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("time.format: time out of range, got %s", args[0].Inspect())
+			}
+			return &object.String{Value: time.UnixMilli(ms.Value).UTC().Format(args[1].(*object.String).Value)}
+		})
+}
@@ -0,0 +1,92 @@
+package evaluator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Capability は、信用できないスクリプトには渡したくない権限。
+// DefaultRegistry() には fs / os / time のモジュールは入っていないので、ホスト側が Grant したときだけ使える。
+type Capability string
+
+const (
+	CapabilityFS   Capability = "fs"   // fs.read_file とか。ファイルの読み書き
+	CapabilityOS   Capability = "os"   // os.getenv とか。環境変数・引数・終了コード・カレントディレクトリ
+	CapabilityTime Capability = "time" // time.now とか。時計と sleep
+)
+
+// Capabilities は Grant で使える権限の一覧
+var Capabilities = []Capability{CapabilityFS, CapabilityOS, CapabilityTime}
+
+// ParseCapabilities は "fs,time" みたいなカンマ区切りを Capability のリストにする。CLI の -allow 用。
+// 空文字列なら空のリスト。"all" ならぜんぶ。
+func ParseCapabilities(s string) ([]Capability, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if s == "all" {
+		return Capabilities, nil
+	}
+
+	var caps []Capability
+	for _, name := range strings.Split(s, ",") {
+		capability := Capability(strings.TrimSpace(name))
+		if !isKnownCapability(capability) {
+			return nil, fmt.Errorf("unknown capability %q (available: %s)", capability, capabilityNames())
+		}
+		caps = append(caps, capability)
+	}
+
+	return caps, nil
+}
+
+func isKnownCapability(capability Capability) bool {
+	for _, c := range Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
+}
+
+func capabilityNames() string {
+	names := make([]string, len(Capabilities))
+	for i, c := range Capabilities {
+		names[i] = string(c)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// Process は os モジュールから見えるプロセスの情報。スクリプトの引数を渡して、終わったあとに ExitCode を見る。
+// os.exit_code(n) は評価を止めずに ExitCode を書き換えるだけなので、実際にプロセスを終わらせるかはホスト側が決める。
+type Process struct {
+	Args     []string
+	ExitCode int
+}
+
+// Grant は capabilities のモジュールを登録する。os を渡すときは process も要る(nil なら引数なしの Process を作る)。
+// 同じ Registry を使う環境は全部その権限を持つので、信用できないスクリプト用の Registry には Grant しないこと。
+func (r *Registry) Grant(process *Process, capabilities ...Capability) *Process {
+	if process == nil {
+		process = &Process{}
+	}
+
+	for _, capability := range capabilities {
+		switch capability {
+		case CapabilityFS:
+			registerFSModule(r)
+		case CapabilityOS:
+			registerOSModule(r, process)
+		case CapabilityTime:
+			registerTimeModule(r)
+		default:
+			panic(fmt.Sprintf("evaluator: unknown capability %q", capability))
+		}
+	}
+
+	return process
+}
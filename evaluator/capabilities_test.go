@@ -0,0 +1,175 @@
+package evaluator_test
+
+import (
+	"fmt"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func inspectResult(obj object.Object) string {
+	if errObj, ok := obj.(*object.Error); ok {
+		return errObj.Message
+	}
+
+	return obj.Inspect()
+}
+
+func TestCapabilitiesAreNotGrantedByDefault(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fs.read_file("x")`, "identifier not found: fs.read_file"},
+		{`os.cwd()`, "identifier not found: os.cwd"},
+		{`time.now()`, "identifier not found: time.now"},
+	}
+
+	for _, tt := range tests {
+		for _, registry := range []*evaluator.Registry{evaluator.DefaultRegistry(), evaluator.RestrictedRegistry()} {
+			got := inspectResult(testEvalWithRegistry(tt.input, registry))
+			if got != tt.expected {
+				t.Errorf("%s: %q じゃないよ。got=%q", tt.input, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestFSModule(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	registry := evaluator.DefaultRegistry()
+	registry.Grant(nil, evaluator.CapabilityFS)
+
+	// 文字列リテラルにエスケープはないけど、一時ディレクトリのパスには " は入らないのでそのまま埋め込む
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{fmt.Sprintf(`fs.exists("%s/sub")`, dir), "false"},
+		{fmt.Sprintf(`fs.mkdir("%s/sub/deep")`, dir), "NULL"},
+		{fmt.Sprintf(`fs.write_file("%s/sub/b.txt", "bee")`, dir), "NULL"},
+		{fmt.Sprintf(`fs.write_file("%s/sub/a.txt", "hello")`, dir), "NULL"},
+		{fmt.Sprintf(`fs.read_file("%s/sub/a.txt")`, dir), "hello"},
+		{fmt.Sprintf(`fs.list_dir("%s/sub")`, dir), "[a.txt, b.txt, deep]"},
+		{fmt.Sprintf(`fs.remove("%s/sub/b.txt")`, dir), "NULL"},
+		{fmt.Sprintf(`fs.exists("%s/sub/b.txt")`, dir), "false"},
+		{fmt.Sprintf(`fs.read_file("%s/nope")`, dir), fmt.Sprintf("fs.read_file: open %s/nope: no such file or directory", dir)},
+		{`fs.read_file(1)`, "argument to `fs.read_file` not supported, got INTEGER"},
+	}
+
+	// 順番に意味があるので並列にしない
+	for _, tt := range tests {
+		got := inspectResult(testEvalWithRegistry(tt.input, registry))
+		if got != tt.expected {
+			t.Errorf("%s: %q じゃないよ。got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "sub", "a.txt"))
+	if err != nil || string(content) != "hello" {
+		t.Errorf("ファイルが書かれてないよ。content=%q, err=%v", content, err)
+	}
+}
+
+func TestOSModule(t *testing.T) {
+	t.Setenv("GOMONKEY_TEST_VAR", "banana")
+
+	registry := evaluator.DefaultRegistry()
+	process := registry.Grant(&evaluator.Process{Args: []string{"a", "b"}}, evaluator.CapabilityOS)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`os.getenv("GOMONKEY_TEST_VAR")`, "banana"},
+		{`os.getenv("GOMONKEY_TEST_UNSET_VAR")`, "NULL"},
+		{`os.setenv("GOMONKEY_TEST_VAR", "apple"); os.getenv("GOMONKEY_TEST_VAR")`, "apple"},
+		{`os.args()`, "[a, b]"},
+		{`os.cwd()`, cwd},
+		{`os.exit_code()`, "0"},
+		{`os.exit_code(3); os.exit_code()`, "3"},
+		{`os.exit_code(256)`, "os.exit_code: exit code must be between 0 and 255, got 256"},
+	}
+
+	for _, tt := range tests {
+		got := inspectResult(testEvalWithRegistry(tt.input, registry))
+		if got != tt.expected {
+			t.Errorf("%s: %q じゃないよ。got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	if process.ExitCode != 3 {
+		t.Errorf("Process.ExitCode が 3 じゃないよ。got=%d", process.ExitCode)
+	}
+}
+
+func TestTimeModule(t *testing.T) {
+	t.Parallel()
+
+	registry := evaluator.DefaultRegistry()
+	registry.Grant(nil, evaluator.CapabilityTime)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`time.format(0, "2006-01-02 15:04:05")`, "1970-01-01 00:00:00"},
+		{`time.format(1700000000123, "2006-01-02T15:04:05.000")`, "2023-11-14T22:13:20.123"},
+		{`let start = time.now(); time.sleep(5); time.now() - start > 4`, "true"},
+		{`time.now() > 1700000000000`, "true"},
+		{`time.sleep(-1)`, "time.sleep: duration must be a non-negative number of milliseconds, got -1"},
+		{`time.sleep(9223372036855)`, "time.sleep: duration too large, got 9223372036855"},
+		{`time.sleep(9223372036854775807)`, "time.sleep: duration too large, got 9223372036854775807"},
+	}
+
+	for _, tt := range tests {
+		got := inspectResult(testEvalWithRegistry(tt.input, registry))
+		if got != tt.expected {
+			t.Errorf("%s: %q じゃないよ。got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input       string
+		expected    []evaluator.Capability
+		expectedErr string
+	}{
+		{"", nil, ""},
+		{"fs", []evaluator.Capability{evaluator.CapabilityFS}, ""},
+		{"time, os", []evaluator.Capability{evaluator.CapabilityTime, evaluator.CapabilityOS}, ""},
+		{"all", evaluator.Capabilities, ""},
+		{"fs,net", nil, `unknown capability "net" (available: fs, os, time)`},
+	}
+
+	for _, tt := range tests {
+		got, err := evaluator.ParseCapabilities(tt.input)
+		if tt.expectedErr != "" {
+			if err == nil || err.Error() != tt.expectedErr {
+				t.Errorf("%q: エラー %q になってないよ。got=%v", tt.input, tt.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: エラーになっちゃった: %s", tt.input, err)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: %v じゃないよ。got=%v", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"gomonkey/ast"
 	"gomonkey/object"
+	"math"
+	"math/big"
 )
 
 var (
@@ -13,6 +15,20 @@ var (
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	// フックがなければ(ふつうに実行するときは)そのまま評価する
+	hooks := env.Hooks()
+	if hooks == nil {
+		return eval(node, env)
+	}
+
+	hooks.BeforeEval(node, env)
+	result := eval(node, env)
+	hooks.AfterEval(node, env, result)
+
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch n := node.(type) {
 	// 複数の文
 	case *ast.Program:
@@ -47,16 +63,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.ReturnValue{Value: val}
 	// 式
 	case *ast.CallExpression:
-		// quote()の呼び出しだったらソッコーでQUOTEする(何も評価しない！)
-		if n.Function.TokenLiteral() == "quote" {
-			return quote(n.Arguments[0], env)
-		}
-
 		function := Eval(n.Function, env)
 		if isError(function) {
 			return function // Evalした地点でErrorだったらもうErrorオブジェクトなので、newErrorは不要だよ！
 		}
 
+		// マクロ展開フェーズで展開されなかったマクロ(関数から返ってきたマクロとか)は、ここでその場で展開する。
+		// 実引数を評価しちゃダメなので、evalExpressionsより前で分岐する。
+		if macroObj, ok := function.(*object.Macro); ok {
+			return applyMacro(macroObj, n, env)
+		}
+
 		// 「引数のリスト」だけど「複数の式」って捉えるほうがかっちょいいね
 		args := evalExpressions(n.Arguments, env) // OBJECTのスライス
 
@@ -72,11 +89,29 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		// 環境を渡さない！！！ あんまわかってないけど！
-		return applyFunction(function, args)
+		// ユーザー定義関数には環境を渡さない！！！ あんまわかってないけど！
+		// (組み込み関数は、入出力とか macroexpand のマクロ探しに呼び出したところの環境を使うので、そっちにだけ渡す)
+		hooks := env.Hooks()
+		if hooks == nil {
+			return applyFunction(function, args, env)
+		}
+
+		hooks.EnterFunction(n, function, args)
+		result := applyFunction(function, args, env)
+		hooks.ExitFunction(n, function, result)
+
+		return result
 		// 疑問
 		// return applyFunction(function, args, env) // この「現在の環境」を渡すとどういう問題になる？？？
 
+	case *ast.QuoteExpression:
+		// quote()だったらソッコーでQUOTEする(何も評価しない！)
+		return quote(n.Expression, env)
+
+	case *ast.UnquoteExpression:
+		// unquote は quote の中でだけ意味がある。quote の中のやつは quote() が先に処理している。
+		return newError("%s called outside of quote", n.TokenLiteral())
+
 	case *ast.FunctionLiteral:
 		return &object.Function{
 			Parameters: n.Parameters,
@@ -84,6 +119,15 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			Env:        env, // Functionオブジェクト自身が環境を持っていた！
 		}
 
+	case *ast.MacroLiteral:
+		// トップレベルやブロック直下の `let m = macro(...)` はマクロ展開フェーズで消えているので、
+		// ここに来るのは関数から返すマクロとか。
+		return &object.Macro{
+			Parameters: n.Parameters,
+			Body:       n.Body,
+			Env:        env,
+		}
+
 	case *ast.IfExpression:
 		return evalIfExpression(n, env)
 
@@ -142,10 +186,19 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 
 		return evalIndexExpression(left, index)
+
+	case *ast.SliceExpression:
+		return evalSliceExpression(n, env)
+
 	case *ast.IntegerLiteral:
+		if n.BigValue != nil {
+			return newIntegerObject(n.BigValue)
+		}
 		return &object.Integer{Value: n.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: n.Value}
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(n.Value)
 	}
@@ -185,6 +238,8 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ArrayObj && index.Type() == object.IntegerObj:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.StringObj && index.Type() == object.IntegerObj:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HashObj:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -212,18 +267,140 @@ func evalHashIndexExpression(left object.Object, index object.Object) object.Obj
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
 
-	max := int64(len(arrayObject.Elements) - 1)
+	// 多倍長整数の添字はどうやっても範囲外
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return NULL
+	}
 
-	if idx < 0 || idx > max {
+	idx, ok := normalizeIndex(integer.Value, len(arrayObject.Elements))
+	if !ok {
 		return NULL
 	}
 
 	return arrayObject.Elements[idx]
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	value := str.(*object.String).Value
+
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return NULL
+	}
+
+	// len()と揃えてバイト単位で数える
+	idx, ok := normalizeIndex(integer.Value, len(value))
+	if !ok {
+		return NULL
+	}
+
+	return &object.String{Value: value[idx : idx+1]}
+}
+
+// normalizeIndex は 負の添字 を 後ろからの位置 に読み替える。
+// arr[-1] は arr[len(arr)-1] ってこと。範囲外なら false を返す。
+func normalizeIndex(idx int64, length int) (int64, bool) {
+	if idx < 0 {
+		idx = idx + int64(length)
+	}
+
+	if idx < 0 || idx >= int64(length) {
+		return idx, false
+	}
+
+	return idx, true
+}
+
+func evalSliceExpression(n *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(n.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = len(left.Value)
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	// 省略されたら先頭から末尾まで
+	start, errObj := evalSliceBound(n.Start, env, 0)
+	if errObj != nil {
+		return errObj
+	}
+
+	end, errObj := evalSliceBound(n.End, env, int64(length))
+	if errObj != nil {
+		return errObj
+	}
+
+	// 負の値は後ろからの位置に読み替える
+	from, to := start, end
+	if from < 0 {
+		from = from + int64(length)
+	}
+	if to < 0 {
+		to = to + int64(length)
+	}
+
+	// Pythonみたいに黙って丸めたりはしない。おかしい範囲はエラーにしちゃう。
+	if from < 0 || to > int64(length) || from > to {
+		return newError("index error: slice bounds out of range [%s:%s] with length %d",
+			sliceBoundString(n.Start, start), sliceBoundString(n.End, end), length)
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		// 元の配列を共有しないようにコピーする(restと同じ方針)
+		elements := make([]object.Object, to-from)
+		copy(elements, left.Elements[from:to])
+
+		return &object.Array{Elements: elements}
+	default:
+		return &object.String{Value: left.(*object.String).Value[from:to]}
+	}
+}
+
+// evalSliceBound はスライスの開始/終了位置を評価する。省略されている(nilの)ときは defaultValue を返す。
+func evalSliceBound(node ast.Expression, env *object.Environment, defaultValue int64) (int64, *object.Error) {
+	if node == nil {
+		return defaultValue, nil
+	}
+
+	evaluated := Eval(node, env)
+	if isError(evaluated) {
+		return 0, evaluated.(*object.Error)
+	}
+
+	if bigInteger, ok := evaluated.(*object.BigInteger); ok {
+		return 0, newError("index error: slice index %s out of range", bigInteger.Inspect())
+	}
+
+	integer, ok := evaluated.(*object.Integer)
+	if !ok {
+		return 0, newError("index error: slice indices must be INTEGER, got %s", evaluated.Type())
+	}
+
+	return integer.Value, nil
+}
+
+func sliceBoundString(node ast.Expression, value int64) string {
+	if node == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%d", value)
+}
+
+// applyFunction は関数を呼ぶ。env は呼び出したところの環境で、組み込み関数にだけ渡す。ユーザー定義関数は作ったところの環境で評価する。
+// env は nil でもいい(そのときの IO は nil)。
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function: // ユーザー定義関数ってことだね？
@@ -239,6 +416,16 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 		return unwrapReturnValue(evaluated)
 
 	case *object.Builtin:
+		switch {
+		case fn.EnvFn != nil:
+			return fn.EnvFn(env, args...)
+		case fn.IOFn != nil:
+			var io *object.IO
+			if env != nil {
+				io = env.IO()
+			}
+			return fn.IOFn(io, args...)
+		}
 		return fn.Fn(args...)
 	default:
 		return newError("not a function: %s", fn.Type())
@@ -361,18 +548,48 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 }
 
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	leftInteger, leftOk := left.(*object.Integer)
+	rightInteger, rightOk := right.(*object.Integer)
+
+	// どっちかが多倍長整数なら、最初から多倍長で計算する
+	if !leftOk || !rightOk {
+		return evalBigIntegerInfixExpression(operator, left, right)
+	}
+
+	leftValue := leftInteger.Value
+	rightValue := rightInteger.Value
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftValue + rightValue}
+		if v, ok := addInt64(leftValue, rightValue); ok {
+			return &object.Integer{Value: v}
+		}
+		return evalBigIntegerInfixExpression(operator, left, right)
 	case "-":
-		return &object.Integer{Value: leftValue - rightValue}
+		if v, ok := subInt64(leftValue, rightValue); ok {
+			return &object.Integer{Value: v}
+		}
+		return evalBigIntegerInfixExpression(operator, left, right)
 	case "*":
-		return &object.Integer{Value: leftValue * rightValue}
+		if v, ok := mulInt64(leftValue, rightValue); ok {
+			return &object.Integer{Value: v}
+		}
+		return evalBigIntegerInfixExpression(operator, left, right)
 	case "/":
+		// Goのランタイムごとpanicさせるわけにはいかないので、ちゃんとERRORにする
+		if rightValue == 0 {
+			return newDivisionByZeroError(operator, left)
+		}
+		// MinInt64 / -1 だけは溢れる
+		if leftValue == math.MinInt64 && rightValue == -1 {
+			return evalBigIntegerInfixExpression(operator, left, right)
+		}
 		return &object.Integer{Value: leftValue / rightValue}
+	case "%":
+		if rightValue == 0 {
+			return newDivisionByZeroError(operator, left)
+		}
+		return &object.Integer{Value: leftValue % rightValue}
 	// Boolean
 	case "<":
 		return nativeBoolToBooleanObject(leftValue < rightValue)
@@ -405,8 +622,13 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 		return newError("unknown operator: -%s", right.Type())
 	}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	integer, ok := right.(*object.Integer)
+	// -MinInt64 は int64 に収まらないので多倍長にする
+	if !ok || integer.Value == math.MinInt64 {
+		return newIntegerObject(new(big.Int).Neg(toBigInt(right)))
+	}
+
+	return &object.Integer{Value: -integer.Value}
 
 	// 書き換えると壊れるよ！
 	// a = 1
@@ -484,7 +706,8 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return v
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	// 組み込み関数は環境に持たせた Registry から探す(持たせていなければ標準の組み込み関数)
+	if builtin, ok := lookupBuiltin(node.Value, env); ok {
 		return builtin
 	}
 
@@ -1,6 +1,7 @@
 package evaluator_test
 
 import (
+	"fmt"
 	"gomonkey/evaluator"
 	"gomonkey/lexer"
 	"gomonkey/object"
@@ -38,6 +39,18 @@ func TestIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+
+		// 剰余
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"1 + 10 % 4 * 2", 5},
+
+		// 一度溢れても、int64に収まるところまで戻ってくればIntegerに戻る
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+		{"9223372036854775808 - 1", 9223372036854775807},
+		{"-9223372036854775808", -9223372036854775808},
+		{"(9223372036854775807 * 4) / 4", 9223372036854775807},
+		{"123456789012345678901234567890 % 1000", 890},
 	}
 
 	for _, tt := range tests {
@@ -52,6 +65,64 @@ func TestIntegerExpression(t *testing.T) {
 
 }
 
+func TestBigIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 溢れたら多倍長整数になる
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"9223372036854775807 * 2", "18446744073709551614"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+
+		// int64 に収まらないリテラル
+		{"123456789012345678901234567890", "123456789012345678901234567890"},
+		{"-123456789012345678901234567890 / 10", "-12345678901234567890123456789"},
+
+		// 関数の中で階乗しても壊れない
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(25)", "15511210043330985984000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+
+			bigInteger, ok := evaluated.(*object.BigInteger)
+			if !ok {
+				t.Fatalf("obj is not *object.BigInteger. got=%[1]T %[1]v", evaluated)
+			}
+
+			if bigInteger.Value.String() != tt.expected {
+				t.Errorf("bigInteger.Value not %s, got %s", tt.expected, bigInteger.Value.String())
+			}
+		})
+	}
+}
+
+func TestBigIntegerComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"9223372036854775808 > 9223372036854775807", true},
+		{"9223372036854775808 < 1", false},
+		{"9223372036854775808 == 9223372036854775807 + 1", true},
+		{"9223372036854775808 != 9223372036854775808", false},
+
+		// ハッシュのキーにもなる
+		{`{9223372036854775808: true}[9223372036854775807 + 1]`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			testBooleanObject(t, evaluated, tt.expected)
+		})
+	}
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	integerObj, ok := obj.(*object.Integer)
 	if !ok {
@@ -314,6 +385,12 @@ func TestErrorHandling(t *testing.T) {
 
 		//
 		{`{"name": "Monkey"}[fn(x) { x }];`, "unhashable type: FUNCTION"},
+
+		// ゼロ除算はGoのランタイムごとpanicしないでERRORになる
+		{"1 / 0", "division by zero: 1 / 0"},
+		{"let a = 5; a % (3 - 3)", "division by zero: 5 % 0"},
+		{"9223372036854775808 / 0", "division by zero: 9223372036854775808 / 0"},
+		{"9223372036854775808 % 0", "division by zero: 9223372036854775808 % 0"},
 	}
 
 	for _, tt := range tests {
@@ -661,7 +738,11 @@ func TestArrayIndexExpressions(t *testing.T) {
 
 		// off-by-one error
 		{"[1, 2, 3][3]", nil},
-		{"[1, 2, 3][-1]", nil},
+		{"[1, 2, 3][-4]", nil},
+
+		// 負の添字は後ろから数える
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
 	}
 
 	for _, tt := range tests {
@@ -679,6 +760,109 @@ func TestArrayIndexExpressions(t *testing.T) {
 
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`"abc"[0]`, "a"},
+		{`"abc"[2]`, "c"},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-4]`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+
+			expected, ok := tt.expected.(string)
+			if !ok {
+				testNullObject(t, evaluated)
+				return
+			}
+
+			strObj, ok := evaluated.(*object.String)
+			if !ok {
+				t.Fatalf("*object.Stringじゃないよ.got=%[1]T(%+[1]v)", evaluated)
+			}
+
+			if strObj.Value != expected {
+				t.Errorf("want %q, got %q", expected, strObj.Value)
+			}
+		})
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		// 配列
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][1:1]", []int{}},
+		{"[][:]", []int{}},
+		{"let a = [1, 2, 3]; let i = 1; a[i:i + 1]", []int{2}},
+
+		// 元の配列を破壊しない
+		{"let a = [1, 2, 3]; let b = a[0:2]; push(b, 9); a;", []int{1, 2, 3}},
+
+		// 文字列
+		{`"Hello, world!"[0:5]`, "Hello"},
+		{`"Hello, world!"[7:]`, "world!"},
+		{`"Hello, world!"[-6:-1]`, "world"},
+		{`"abc"[:0]`, ""},
+
+		// index error: 範囲がおかしい
+		{"[1, 2, 3][1:5]", "index error: slice bounds out of range [1:5] with length 3"},
+		{"[1, 2, 3][2:1]", "index error: slice bounds out of range [2:1] with length 3"},
+		{"[1, 2, 3][-4:]", "index error: slice bounds out of range [-4:] with length 3"},
+		{`"abc"[:4]`, "index error: slice bounds out of range [:4] with length 3"},
+		{`[1, 2, 3]["a":]`, "index error: slice indices must be INTEGER, got STRING"},
+		{`[1, 2, 3][:true]`, "index error: slice indices must be INTEGER, got BOOLEAN"},
+
+		// スライスできないもの
+		{`{"a": 1}[0:1]`, "slice operator not supported: HASH"},
+		{`1[0:1]`, "slice operator not supported: INTEGER"},
+
+		// エラーはそのまま伝わる
+		{`[1, 2, 3][1 + true:]`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case []int:
+				testArrayEqual(t, evaluated, expected)
+			case string:
+				if errObj, ok := evaluated.(*object.Error); ok {
+					if errObj.Message != expected {
+						t.Errorf("エラーオブジェクトのMessageがちがうよ！ want=%s, got=%s", expected, errObj.Message)
+					}
+					return
+				}
+
+				strObj, ok := evaluated.(*object.String)
+				if !ok {
+					t.Fatalf("*object.Stringじゃないよ.got=%[1]T(%+[1]v)", evaluated)
+				}
+
+				if strObj.Value != expected {
+					t.Errorf("want %q, got %q", expected, strObj.Value)
+				}
+			}
+		})
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `let two = "two";
 	{
@@ -805,6 +989,19 @@ func TestQuoteUnquote(t *testing.T) {
 		{`quote(unquote(true))`, `true`},
 		{`quote(unquote(true == false))`, `false`},
 
+		// 文字列、配列、ハッシュ、null、関数も埋め込める
+		{`quote(unquote("hello") + "!")`, `(hello + !)`},
+		{`quote(unquote([1, "two", [true]]))`, `[1, two, [true]]`},
+		{`quote(unquote({"a": 1, 2: [3]}))`, `{2: [3], a: 1}`},
+		{`quote(unquote(null))`, `null`},
+		{`quote(unquote(puts("")))`, `null`},
+		{`let add = fn(a, b) { a + b }; quote(unquote(add)(1, 2))`, `fn(a, b) { (a + b) }(1, 2)`},
+
+		// unquote_splicing は配列を引数や要素としてばらして埋め込む
+		{`let xs = [2, 3]; quote(f(1, unquote_splicing(xs), 4))`, `f(1, 2, 3, 4)`},
+		{`quote([0, unquote_splicing([1 + 1, "x"])])`, `[0, 2, x]`},
+		{`quote(f(unquote_splicing([])))`, `f()`},
+
 		// A.4.2.2 quoteの中のunquoteの中のquote
 		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
 		{`let quotedInfixExpression = quote(4 + 4);
@@ -831,3 +1028,68 @@ func TestQuoteUnquote(t *testing.T) {
 	}
 
 }
+
+func TestUnquotedValuesEvaluateToTheSameValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello"`, `hello`},
+		{`[1, "two", [true, null]]`, `[1, two, [true, NULL]]`},
+		{`{"a": [1]}`, `{a: [1]}`},
+		{`fn(x) { x * 2 }(21)`, `42`},
+		{`null`, `NULL`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			// 値を unquote でASTに戻して、もう一回評価しても同じ値になる
+			input := fmt.Sprintf(`
+			let roundTrip = macro(x) { quote(unquote(unquote(x))) };
+			roundTrip(%s)`, tt.input)
+
+			evaluated := testEvalWithMacros(input)
+			if evaluated == nil {
+				t.Fatalf("評価結果が nil だよ")
+			}
+
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("want=%q, got=%q", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}
+
+func TestQuoteUnquoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 昔は nil が埋め込まれてあとで落ちていた
+		{`quote(unquote(len))`, "unquote error: cannot convert BUILTIN to AST node"},
+		{`quote(1 + unquote([1, len]))`, "unquote error: cannot convert ARRAY to AST node"},
+		{`quote(f(unquote_splicing(1)))`, "unquote error: argument to `unquote_splicing` must be ARRAY, got INTEGER"},
+		{`quote(f(unquote_splicing([len])))`, "unquote error: cannot convert BUILTIN to AST node"},
+		{`quote(1 + unquote_splicing([1]))`, "unquote error: unquote_splicing must be a call argument or an array element: unquote_splicing([1])"},
+		{`unquote(1)`, "unquote called outside of quote"},
+		{`unquote_splicing([1])`, "unquote_splicing called outside of quote"},
+		{`quote(1 + unquote(foo))`, "identifier not found: foo"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Fatalf("*object.Error じゃないよ。got=%[1]T(%+[1]v)", evaluated)
+			}
+
+			if errObj.Message != tt.expected {
+				t.Errorf("エラーメッセージがちがうよ。got=%q, want=%q", errObj.Message, tt.expected)
+			}
+		})
+	}
+}
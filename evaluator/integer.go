@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"gomonkey/object"
+	"math"
+	"math/big"
+)
+
+// int64 で計算してみて、溢れたら math/big で計算し直す作戦。
+// 結果が int64 に収まるなら必ず *object.Integer に戻す(BigIntegerのルールはobject.goを見てね)。
+
+func evalBigIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := toBigInt(left)
+	rightValue := toBigInt(right)
+
+	switch operator {
+	case "+":
+		return newIntegerObject(new(big.Int).Add(leftValue, rightValue))
+	case "-":
+		return newIntegerObject(new(big.Int).Sub(leftValue, rightValue))
+	case "*":
+		return newIntegerObject(new(big.Int).Mul(leftValue, rightValue))
+	case "/":
+		if rightValue.Sign() == 0 {
+			return newDivisionByZeroError(operator, left)
+		}
+		// Quo は Go の / と同じく0方向への切り捨て(Divはユークリッド除算なので違う！)
+		return newIntegerObject(new(big.Int).Quo(leftValue, rightValue))
+	case "%":
+		if rightValue.Sign() == 0 {
+			return newDivisionByZeroError(operator, left)
+		}
+		// Rem も Go の % と同じ符号のルール
+		return newIntegerObject(new(big.Int).Rem(leftValue, rightValue))
+	case "<":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) > 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func newDivisionByZeroError(operator string, left object.Object) *object.Error {
+	return newError("division by zero: %s %s 0", left.Inspect(), operator)
+}
+
+// newIntegerObject は int64 に収まるなら Integer、収まらないなら BigInteger を返す
+func newIntegerObject(value *big.Int) object.Object {
+	if value.IsInt64() {
+		return &object.Integer{Value: value.Int64()}
+	}
+
+	return &object.BigInteger{Value: value}
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value)
+	case *object.BigInteger:
+		return obj.Value
+	default:
+		return nil
+	}
+}
+
+// 以下、溢れたら false を返す int64 の演算たち
+
+func addInt64(a, b int64) (int64, bool) {
+	c := a + b
+	// 同じ符号同士を足したのに符号が変わったら溢れている
+	if (a > 0 && b > 0 && c < 0) || (a < 0 && b < 0 && c >= 0) {
+		return 0, false
+	}
+
+	return c, true
+}
+
+func subInt64(a, b int64) (int64, bool) {
+	c := a - b
+	if (a >= 0 && b < 0 && c < 0) || (a < 0 && b > 0 && c >= 0) {
+		return 0, false
+	}
+
+	return c, true
+}
+
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+
+	// MinInt64 * -1 は割り算での検算が効かないので先に弾く
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+
+	c := a * b
+	if c/b != a {
+		return 0, false
+	}
+
+	return c, true
+}
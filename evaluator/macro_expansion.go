@@ -1,15 +1,23 @@
 package evaluator
 
 import (
+	"fmt"
 	"gomonkey/ast"
 	"gomonkey/object"
 	"gomonkey/token"
+	"io"
 )
 
 func DefineMacros(program *ast.Program, env *object.Environment) {
+	program.Statements = defineMacros(program.Statements, env)
+}
+
+// defineMacros は文のリストからマクロ定義を見つけて env に登録し、マクロ定義を取り除いた文のリストを返す。
+// トップレベル(Program)でもブロックの中でも同じことをするので切り出した。
+func defineMacros(statements []ast.Statement, env *object.Environment) []ast.Statement {
 	var macroDefinitionIndexes []int
 
-	for idx, stmt := range program.Statements {
+	for idx, stmt := range statements {
 		if isMacroDefinition(stmt) {
 			// 1) 環境にマクロ定義を登録する
 			addMacro(stmt, env)
@@ -23,9 +31,10 @@ func DefineMacros(program *ast.Program, env *object.Environment) {
 	// memo: スライスを使った中抜きアルゴリズム
 	for i := len(macroDefinitionIndexes) - 1; i >= 0; i = i - 1 {
 		definitionIndex := macroDefinitionIndexes[i]
-		program.Statements = append(program.Statements[:definitionIndex], program.Statements[definitionIndex+1:]...)
+		statements = append(statements[:definitionIndex], statements[definitionIndex+1:]...)
 	}
 
+	return statements
 }
 
 func isMacroDefinition(stmt ast.Statement) bool {
@@ -56,39 +65,359 @@ func addMacro(stmt ast.Statement, env *object.Environment) {
 	env.Set(letStmt.Name.Value, macroObj)
 }
 
-func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
-	modifier := func(node ast.Node) ast.Node {
-		// CallExprでない時点で「マクロ呼び出し」なわけがない
-		callExpr, ok := node.(*ast.CallExpression)
-		if !ok {
-			return node // 「このノードは変更しないよ」ってこと
+// maxMacroExpandSteps はマクロ展開を繰り返す上限。マクロが自分自身に展開され続けるときの保険。
+const maxMacroExpandSteps = 100
+
+// maxMacroExpansions は1回の展開(ExpandMacros とか macroexpand とか)でマクロ呼び出しを展開する回数の上限。
+// quote(m(unquote(x)) + m(unquote(x))) みたいに周回ごとに呼び出しが倍になるマクロは、周回の上限に届く前に止まらなくなるので。
+const maxMacroExpansions = 10000
+
+// maxMacroExpandNodes は1回の展開でマクロが作っていいノード数の合計の上限。
+// quote(m(unquote(x) + unquote(x))) みたいに、呼び出しは増えないけど展開結果が倍々で大きくなるマクロ用。
+const maxMacroExpandNodes = 1 << 20
+
+// ExpandMacros はマクロ呼び出しを展開する。
+// 展開結果の中にまたマクロ呼び出し(やマクロ定義)があるかもしれないので、何も変わらなくなるまで繰り返す。
+// ブロックの中で定義されたマクロはそのブロックの中だけで使える。
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	return expandMacrosUntilFixpoint(program, env, nil)
+}
+
+// ExpandMacrosWithTrace は ExpandMacros と同じことをしつつ、
+// マクロ呼び出しのたびに「呼び出し」「quoteされた実引数」「展開結果」を trace に書き出す。デバッグ用。
+func ExpandMacrosWithTrace(program ast.Node, env *object.Environment, trace io.Writer) (ast.Node, error) {
+	return expandMacrosUntilFixpoint(program, env, trace)
+}
+
+func expandMacrosUntilFixpoint(node ast.Node, env *object.Environment, trace io.Writer) (ast.Node, error) {
+	// 展開した回数とノード数は周回をまたいで数えたいので、同じ macroExpander を使い回す
+	e := &macroExpander{trace: trace}
+
+	for i := 0; i < maxMacroExpandSteps; i++ {
+		expanded, changed, err := e.expandOnce(node, env)
+		if err != nil {
+			return nil, err
+		}
+
+		node = expanded
+
+		if !changed {
+			return node, nil
+		}
+	}
+
+	return nil, fmt.Errorf("macro expansion did not finish after %d steps", maxMacroExpandSteps)
+}
+
+// expandMacrosOnce はマクロ呼び出しを1段だけ展開する(展開結果の中のマクロ呼び出しはそのまま)。
+// マクロ呼び出しを展開したり、マクロ定義を見つけたりしたら changed が true になる。
+func expandMacrosOnce(node ast.Node, env *object.Environment, trace io.Writer) (ast.Node, bool, error) {
+	e := &macroExpander{trace: trace}
+
+	return e.expandOnce(node, env)
+}
+
+// macroExpander はASTを上から辿りながらマクロを展開する。
+// ast.Modify だと「今どのブロックの中にいるか」がわからないので、ブロックごとのマクロの環境を持ち回るために自前で辿っている。
+type macroExpander struct {
+	trace      io.Writer
+	changed    bool
+	err        error // 最初に起きたエラーだけ覚えておく
+	expansions int   // 展開したマクロ呼び出しの数
+	nodes      int   // 展開結果のノード数の合計
+}
+
+func (e *macroExpander) expandOnce(node ast.Node, env *object.Environment) (ast.Node, bool, error) {
+	// ユーザーが書いた __tmp_1 みたいな名前と、展開で付け替えた名前がかぶらないようにする
+	reserveGensymNames(node)
+
+	e.changed = false
+	expanded := e.expand(node, env)
+
+	return expanded, e.changed, e.err
+}
+
+func (e *macroExpander) expand(node ast.Node, env *object.Environment) ast.Node {
+	if e.err != nil {
+		return node
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		node.Statements = e.expandStatements(node.Statements, env)
+
+	case *ast.BlockStatement:
+		// ブロックの中で定義されたマクロは、そのブロックの中だけで使える
+		scope := object.NewEnclosedEnvironment(env)
+		node.Statements = e.expandStatements(node.Statements, scope)
+
+	case *ast.ExpressionStatement:
+		node.Expression = e.expandExpression(node.Expression, env)
+
+	case *ast.LetStatement:
+		node.Value = e.expandExpression(node.Value, env)
+
+	case *ast.ReturnStatement:
+		node.ReturnValue = e.expandExpression(node.ReturnValue, env)
+
+	case ast.Expression:
+		// macroexpand(quote(...)) だと式がいきなり来る
+		return e.expandExpression(node, env)
+	}
+
+	return node
+}
+
+func (e *macroExpander) expandStatements(statements []ast.Statement, env *object.Environment) []ast.Statement {
+	before := len(statements)
+	statements = defineMacros(statements, env)
+	if len(statements) != before {
+		e.changed = true
+	}
+
+	for i, stmt := range statements {
+		statements[i], _ = e.expand(stmt, env).(ast.Statement)
+	}
+
+	return statements
+}
+
+func (e *macroExpander) expandBlock(block *ast.BlockStatement, env *object.Environment) *ast.BlockStatement {
+	if block == nil {
+		return nil
+	}
+
+	return e.expand(block, env).(*ast.BlockStatement)
+}
+
+func (e *macroExpander) expandExpressions(expressions []ast.Expression, env *object.Environment) {
+	for i := range expressions {
+		expressions[i] = e.expandExpression(expressions[i], env)
+	}
+}
+
+func (e *macroExpander) expandExpression(expr ast.Expression, env *object.Environment) ast.Expression {
+	if expr == nil || e.err != nil {
+		return expr
+	}
+
+	switch expr := expr.(type) {
+	case *ast.PrefixExpression:
+		expr.Right = e.expandExpression(expr.Right, env)
+
+	case *ast.InfixExpression:
+		expr.Left = e.expandExpression(expr.Left, env)
+		expr.Right = e.expandExpression(expr.Right, env)
+
+	case *ast.IndexExpression:
+		expr.Left = e.expandExpression(expr.Left, env)
+		expr.Index = e.expandExpression(expr.Index, env)
+
+	case *ast.SliceExpression:
+		expr.Left = e.expandExpression(expr.Left, env)
+		expr.Start = e.expandExpression(expr.Start, env)
+		expr.End = e.expandExpression(expr.End, env)
+
+	case *ast.IfExpression:
+		expr.Condition = e.expandExpression(expr.Condition, env)
+		expr.Consequence = e.expandBlock(expr.Consequence, env)
+		expr.Alternative = e.expandBlock(expr.Alternative, env)
+
+	case *ast.FunctionLiteral:
+		expr.Body = e.expandBlock(expr.Body, env)
+
+	case *ast.MacroLiteral:
+		expr.Body = e.expandBlock(expr.Body, env)
+
+	case *ast.ArrayLiteral:
+		e.expandExpressions(expr.Elements, env)
+
+	case *ast.HashLiteral:
+		pairs := make(map[ast.Expression]ast.Expression)
+		for key, value := range expr.Pairs {
+			pairs[e.expandExpression(key, env)] = e.expandExpression(value, env)
 		}
+		expr.Pairs = pairs
+
+	case *ast.CallExpression:
+		return e.expandCall(expr, env)
+
+	case *ast.QuoteExpression:
+		// quote() の中身は「評価しないAST」なので、マクロ展開もしない
+	}
+
+	return expr
+}
+
+func (e *macroExpander) expandCall(callExpr *ast.CallExpression, env *object.Environment) ast.Expression {
+	// マクロ呼び出し なのかをチェック
+	macroObj, ok := isMacroCall(callExpr, env)
+	if !ok {
+		callExpr.Function = e.expandExpression(callExpr.Function, env)
+		e.expandExpressions(callExpr.Arguments, env)
+		return callExpr
+	}
+
+	if e.expansions >= maxMacroExpansions {
+		e.err = fmt.Errorf("macro expansion did not finish after %d macro calls", maxMacroExpansions)
+		return callExpr
+	}
+	e.expansions++
+
+	expanded, err := expandMacroCall(callExpr, macroObj)
+	if err != nil {
+		e.err = err
+		return callExpr
+	}
+
+	e.nodes += countNodes(expanded)
+	if e.nodes > maxMacroExpandNodes {
+		e.err = fmt.Errorf("macro expansion produced more than %d nodes", maxMacroExpandNodes)
+		return callExpr
+	}
+
+	e.changed = true
+
+	if e.trace != nil {
+		traceMacroCall(e.trace, callExpr, macroObj, quoteArgs(callExpr), expanded)
+	}
+
+	expr, ok := expanded.(ast.Expression)
+	if !ok {
+		e.err = fmt.Errorf("macro %s must expand to an expression, got %s", callExpr.Function.String(), expanded.String())
+		return callExpr
+	}
+
+	return expr
+}
+
+// expandMacroCall はマクロ呼び出しを1つ展開した結果のASTを返す。
+// 展開結果の中のマクロ呼び出しはそのまま(次の周回で展開される)。
+func expandMacroCall(callExpr *ast.CallExpression, macroObj *object.Macro) (ast.Node, error) {
+	if len(callExpr.Arguments) != len(macroObj.Parameters) {
+		return nil, fmt.Errorf("argument error: wrong number of arguments to macro %s (given %d, expected %d)",
+			callExpr.Function.String(), len(callExpr.Arguments), len(macroObj.Parameters))
+	}
+
+	// 実行時に展開するとき(applyMacro)は expandMacrosOnce を通らないので、ここでも gensym の名前を予約しておく
+	reserveGensymNames(callExpr)
+	reserveGensymNames(macroObj.Body)
+
+	// 実引数 を "評価しないまま" にしたいので、それぞれを *object.Quote で包む
+	quotedArgs := quoteArgs(callExpr)
+
+	// マクロ展開時の環境を作る
+	// quotedArgs たちが登録された環境をつくります
+	macroEnv := extendMarcoEnv(macroObj, quotedArgs)
 
-		// マクロ呼び出し なのかをチェック
-		macroObj, ok := isMacroCall(callExpr, env)
-		if !ok {
-			return node
+	// マクロオブジェクトの評価
+	evaluated := Eval(macroObj.Body, macroEnv)
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, fmt.Errorf("macro %s: %s", callExpr.Function.String(), errObj.Message)
+	}
+
+	// マクロ呼び出しの結果は Quoteオブジェクト(ASTノードを内包している) じゃないとダメなルールです！
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		return nil, fmt.Errorf("macro %s must return QUOTE, got %s", callExpr.Function.String(), typeOf(evaluated))
+	}
+
+	// マクロ本体が持ち込んだ束縛の名前を付け替えて、呼び出し側の変数とぶつからないようにする
+	hygienized, err := hygienize(quote.Node, quotedArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	// unquote で埋め込んだ実引数は呼び出し側のノードそのもの(hygienize がポインタで見分けるため)なので、
+	// 最後に丸ごと複製して、同じ実引数を2回埋め込んだときや呼び出し側のASTとノードを共有しないようにする
+	return ast.Clone(hygienized), nil
+}
+
+func countNodes(node ast.Node) int {
+	count := 0
+	ast.Inspect(node, func(node ast.Node) bool {
+		if node != nil {
+			count++
 		}
+		return true
+	})
 
-		// 実引数 を "評価しないまま" にしたいので、それぞれを *object.Quote で包む
-		quotedArgs := quoteArgs(callExpr)
+	return count
+}
 
-		// マクロ展開時の環境を作る
-		// quotedArgs たちが登録された環境をつくります
-		macroEnv := extendMarcoEnv(macroObj, quotedArgs)
+func typeOf(obj object.Object) object.Type {
+	if obj == nil {
+		return "nil"
+	}
 
-		// マクロオブジェクトの評価
-		evaluated := Eval(macroObj.Body, macroEnv)
+	return obj.Type()
+}
+
+func traceMacroCall(trace io.Writer, callExpr *ast.CallExpression, macroObj *object.Macro, quotedArgs []*object.Quote, expanded ast.Node) {
+	// callExpr.String() だと展開済みの実引数が混ざるので、名前と実引数を自前で並べる
+	_, _ = fmt.Fprintf(trace, "macro call: %s\n", callExpr.Function.String())
 
-		quote, ok := evaluated.(*object.Quote)
-		if !ok {
-			panic("マクロ呼び出しの結果は Quoteオブジェクト(ASTノードを内包している) じゃないとダメなルールです！ これはルールです。")
+	for i, param := range macroObj.Parameters {
+		if i < len(quotedArgs) {
+			_, _ = fmt.Fprintf(trace, "\t%s = %s\n", param.Value, quotedArgs[i].Inspect())
 		}
+	}
+
+	_, _ = fmt.Fprintf(trace, "\t=> %s\n", expanded.String())
+}
+
+// registerMacroBuiltins は macroexpand(quote(...)) と macroexpand_1(quote(...)) を登録する。
+// マクロを探すのに呼び出したところの環境が要るので、RegisterEnv で登録する。
+//
+//	macroexpand_1: マクロ呼び出しを1段だけ展開する
+//	macroexpand:   マクロ呼び出しがなくなるまで展開する
+func registerMacroBuiltins(r *Registry) {
+	r.RegisterEnv("macroexpand", Signature{Params: []object.Type{object.QuoteObj}},
+		func(env *object.Environment, args ...object.Object) object.Object {
+			return macroExpand(env, args[0].(*object.Quote), false)
+		},
+	)
+
+	r.RegisterEnv("macroexpand_1", Signature{Params: []object.Type{object.QuoteObj}},
+		func(env *object.Environment, args ...object.Object) object.Object {
+			return macroExpand(env, args[0].(*object.Quote), true)
+		},
+	)
+}
+
+func macroExpand(env *object.Environment, quote *object.Quote, once bool) object.Object {
+	// assert_error から呼ばれたときとかは環境がないので、マクロのない環境で展開する(何も変わらない)
+	if env == nil {
+		env = object.NewEnvironment()
+	}
+
+	var node ast.Node
+	var err error
+
+	// 展開はノードをその場で書き換えるので、引数の Quote が変わらないように複製してから展開する
+	if once {
+		node, _, err = expandMacrosOnce(ast.Clone(quote.Node), env, nil)
+	} else {
+		node, err = expandMacrosUntilFixpoint(ast.Clone(quote.Node), env, nil)
+	}
+
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	return &object.Quote{Node: node}
+}
 
-		return quote.Node
+// applyMacro は実行時にマクロが呼び出されたとき(関数から返ってきたマクロとか)の評価。
+// その場で展開して、展開結果を呼び出し側の環境で評価する。
+func applyMacro(macroObj *object.Macro, callExpr *ast.CallExpression, env *object.Environment) object.Object {
+	expanded, err := expandMacroCall(callExpr, macroObj)
+	if err != nil {
+		return newError("%s", err)
 	}
 
-	return ast.Modify(program, modifier)
+	return Eval(expanded, env)
 }
 
 func extendMarcoEnv(macroObj *object.Macro, quotedArgs []*object.Quote) *object.Environment {
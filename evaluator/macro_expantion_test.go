@@ -1,11 +1,16 @@
 package evaluator_test
 
 import (
+	"fmt"
 	"gomonkey/ast"
 	"gomonkey/evaluator"
+	"gomonkey/format"
 	"gomonkey/lexer"
 	"gomonkey/object"
 	"gomonkey/parser"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -121,7 +126,10 @@ func TestExpandMacros(t *testing.T) {
 			env := object.NewEnvironment()
 			evaluator.DefineMacros(program, env)
 
-			expandedMacros := evaluator.ExpandMacros(program, env)
+			expandedMacros, err := evaluator.ExpandMacros(program, env)
+			if err != nil {
+				t.Fatalf("マクロ展開でエラーになったよ: %s", err)
+			}
 
 			if expandedMacros.String() != expected.String() {
 				t.Errorf("not equal, want=%q, got=%q", expected.String(), expandedMacros.String())
@@ -129,3 +137,789 @@ func TestExpandMacros(t *testing.T) {
 		})
 	}
 }
+
+func testEvalWithMacros(input string) object.Object {
+	// REPLと同じ流れ: パース → マクロ定義 → マクロ展開 → 評価
+	program := testParseProgram(input)
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	return evaluator.Eval(expanded, object.NewEnvironment())
+}
+
+func TestMacroHygiene(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// マクロの中の let tmp が、呼び出し側の tmp を捕まえちゃわない
+		{
+			`
+			let addOne = macro(expr) { quote(fn() { let tmp = 1; unquote(expr) + tmp }()) };
+			let tmp = 100;
+			addOne(tmp);
+			`,
+			101,
+		},
+		// 関数の仮引数も同じ
+		{
+			`
+			let addOne = macro(expr) { quote(fn(x) { unquote(expr) + x }(1)) };
+			let x = 100;
+			addOne(x);
+			`,
+			101,
+		},
+		// 呼び出し側の関数の中の束縛はそのまま(呼び出し側のコードには手を出さない)
+		{
+			`
+			let twice = macro(expr) { quote(fn() { let tmp = unquote(expr); tmp + tmp }()) };
+			twice(fn(tmp) { tmp * 10 }(2));
+			`,
+			40,
+		},
+		// マクロが持ち込んだ束縛同士はちゃんと繋がっている
+		{
+			`
+			let swapSub = macro(a, b) { quote(fn() { let tmp = unquote(a); let a = unquote(b); a - tmp }()) };
+			let tmp = 1;
+			let a = 5;
+			swapSub(tmp, a);
+			`,
+			4,
+		},
+		// 付け替えるのは束縛が効いている範囲だけ。fn の外の x は呼び出し側の x のまま
+		{
+			`
+			let m = macro(a) { quote(fn(x) { x + unquote(a) }(1) + x) };
+			let x = 100;
+			m(2);
+			`,
+			103,
+		},
+		// let より前の同じ名前も呼び出し側の名前のまま
+		{
+			`
+			let m = macro(a) { quote(fn() { let y = tmp + unquote(a); let tmp = 1; y + tmp }()) };
+			let tmp = 100;
+			m(10);
+			`,
+			111,
+		},
+		// if のブロックは新しい環境を作らないので、ブロックの中の let はその後ろでも見える
+		{
+			`
+			let m = macro(a) { quote(fn() { if (true) { let t = 1; }; t + unquote(a) }()) };
+			let t = 100;
+			m(t);
+			`,
+			101,
+		},
+		// let の右辺の関数の中からは、束縛中の名前が見える(再帰できる)
+		{
+			`
+			let sum = macro(n) { quote(fn() { let f = fn(i) { if (i < 1) { 0 } else { i + f(i - 1) } }; f(unquote(n)) }()) };
+			let f = 100;
+			sum(3);
+			`,
+			6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEvalWithMacros(tt.input)
+
+			integer, ok := evaluated.(*object.Integer)
+			if !ok {
+				t.Fatalf("*object.Integer じゃないよ. got=%[1]T(%+[1]v)", evaluated)
+			}
+
+			if integer.Value != tt.expected {
+				t.Errorf("want=%d, got=%d", tt.expected, integer.Value)
+			}
+		})
+	}
+}
+
+// ユーザーが gensym と同じ形の名前(__tmp_1 とか)を書いていても、付け替えた名前とかぶらない
+func TestMacroHygieneReservedNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// 呼び出し側の __tmp_N を捕まえちゃわない
+		{
+			`
+			let m = macro(a) { quote(fn() { let tmp = 1; tmp + unquote(a) }()) };
+			let __tmp_%[1]d = 100;
+			m(__tmp_%[1]d);
+			`,
+			101,
+		},
+		// 呼び出し側の __tmp_N を上書きしない
+		{
+			`
+			let m = macro(a) { quote(if (true) { let tmp = unquote(a); tmp }) };
+			let __tmp_%[1]d = 100;
+			m(1);
+			__tmp_%[1]d;
+			`,
+			100,
+		},
+	}
+
+	for _, tt := range tests {
+		// 次に gensym が作るはずの番号の名前を、わざとユーザーのコードで使う
+		quote, ok := testEval(`gensym("tmp")`).(*object.Quote)
+		if !ok {
+			t.Fatalf("gensym が *object.Quote を返してないよ")
+		}
+		name := quote.Node.String()
+		n, err := strconv.Atoi(name[strings.LastIndex(name, "_")+1:])
+		if err != nil {
+			t.Fatalf("gensym の名前に番号が付いてないよ。got=%q", name)
+		}
+
+		input := fmt.Sprintf(tt.input, n+1)
+		testIntegerObject(t, testEvalWithMacros(input), tt.expected)
+	}
+}
+
+func TestMacroHygieneRenamesIntroducedBindings(t *testing.T) {
+	input := `
+	let m = macro(expr) { quote(fn() { let tmp = unquote(expr); tmp }()) };
+	m(tmp);
+	`
+	program := testParseProgram(input)
+
+	env := object.NewEnvironment()
+	evaluator.DefineMacros(program, env)
+	expanded, err := evaluator.ExpandMacros(program, env)
+	if err != nil {
+		t.Fatalf("マクロ展開でエラーになったよ: %s", err)
+	}
+
+	// マクロの tmp だけが __tmp_N になって、呼び出し側の tmp はそのまま
+	re := regexp.MustCompile(`^fn\(\) \{ let (__tmp_\d+) = tmp;(__tmp_\d+) \}\(\)$`)
+	m := re.FindStringSubmatch(expanded.String())
+	if m == nil {
+		t.Fatalf("名前が付け替えられてないよ。got=%q", expanded.String())
+	}
+
+	if m[1] != m[2] {
+		t.Errorf("束縛と参照で名前がずれてるよ。got=%q", expanded.String())
+	}
+}
+
+// 付け替えた名前(let の名前と仮引数)も識別子として読めるので、展開したプログラムを整形してパースし直せる
+func TestMacroHygieneExpansionReparses(t *testing.T) {
+	input := `
+	let swapSub = macro(a, b) { quote(fn(x) { let tmp = unquote(a); let a = unquote(b) + x; a - tmp }(0)) };
+	let tmp = 1;
+	let a = 5;
+	swapSub(tmp, a);
+	`
+	program := testParseProgram(input)
+
+	env := object.NewEnvironment()
+	evaluator.DefineMacros(program, env)
+	expanded, err := evaluator.ExpandMacros(program, env)
+	if err != nil {
+		t.Fatalf("マクロ展開でエラーになったよ: %s", err)
+	}
+
+	source := format.Program(expanded.(*ast.Program))
+	if !strings.Contains(source, "let __tmp_") || !strings.Contains(source, "fn(__x_") {
+		t.Fatalf("名前が付け替えられてないよ。got=%q", source)
+	}
+
+	p := parser.New(lexer.New(source))
+	reparsed := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("展開したプログラムがパースし直せないよ: %v\n%s", p.Errors(), source)
+	}
+
+	if reparsed.String() != expanded.String() {
+		t.Errorf("パースし直したら別のプログラムになったよ。want=%q, got=%q", expanded.String(), reparsed.String())
+	}
+
+	testIntegerObject(t, testEval(source), 4)
+}
+
+func TestGensym(t *testing.T) {
+	seen := make(map[string]bool)
+
+	for _, input := range []string{`gensym()`, `gensym()`, `gensym("tmp")`, `gensym("tmp")`} {
+		evaluated := testEval(input)
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("*object.Quote じゃないよ. got=%[1]T(%+[1]v)", evaluated)
+		}
+
+		ident, ok := quote.Node.(*ast.Identifier)
+		if !ok {
+			t.Fatalf("*ast.Identifier じゃないよ. got=%T", quote.Node)
+		}
+
+		if !regexp.MustCompile(`^__(g|tmp)_\d+$`).MatchString(ident.Value) {
+			t.Errorf("名前の形がおかしいよ。got=%q", ident.Value)
+		}
+
+		if seen[ident.Value] {
+			t.Errorf("同じ名前が2回でてきたよ！ got=%q", ident.Value)
+		}
+		seen[ident.Value] = true
+	}
+}
+
+func TestGensymInsideQuote(t *testing.T) {
+	evaluated := testEval(`let name = gensym("v"); quote(unquote(name) + 1)`)
+
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		t.Fatalf("*object.Quote じゃないよ. got=%[1]T(%+[1]v)", evaluated)
+	}
+
+	if !regexp.MustCompile(`^\(__v_\d+ \+ 1\)$`).MatchString(quote.Node.String()) {
+		t.Errorf("gensymした識別子が埋め込まれてないよ。got=%q", quote.Node.String())
+	}
+}
+
+func TestGensymErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`gensym(1)`, "argument to `gensym` not supported, got INTEGER"},
+		{`gensym("a", "b")`, "argument error: wrong number of arguments (given 2, expected 1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Fatalf("Errorオブジェクトじゃないよ！ got=%[1]T(%+[1]v)", evaluated)
+			}
+
+			if errObj.Message != tt.expected {
+				t.Errorf("want=%s, got=%s", tt.expected, errObj.Message)
+			}
+		})
+	}
+}
+
+func TestMacroExpand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 1段だけ展開: 展開結果の中の double はそのまま残る
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let doublePlusOne = macro(x) { quote(double(unquote(x)) + 1) };
+			macroexpand_1(quote(doublePlusOne(a)));
+			`,
+			`(double(a) + 1)`,
+		},
+		// 全部展開: マクロ呼び出しがなくなるまで
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let doublePlusOne = macro(x) { quote(double(unquote(x)) + 1) };
+			macroexpand(quote(doublePlusOne(a)));
+			`,
+			`((a * 2) + 1)`,
+		},
+		// マクロ呼び出しじゃなければそのまま
+		{
+			`macroexpand(quote(1 + 2))`,
+			`(1 + 2)`,
+		},
+		// 入れ子になったマクロ呼び出しも展開される
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			macroexpand_1(quote(puts(double(1))));
+			`,
+			`puts((1 * 2))`,
+		},
+		// ふつうの組み込み関数なので、値として変数に入れて呼べる
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let expand = macroexpand_1;
+			expand(quote(double(3)));
+			`,
+			`(3 * 2)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			// マクロ定義だけして展開はしない(展開するのは macroexpand の仕事)
+			program := testParseProgram(tt.input)
+			env := object.NewEnvironment()
+			evaluator.DefineMacros(program, env)
+
+			evaluated := evaluator.Eval(program, env)
+
+			quote, ok := evaluated.(*object.Quote)
+			if !ok {
+				t.Fatalf("*object.Quote じゃないよ. got=%[1]T(%+[1]v)", evaluated)
+			}
+
+			if quote.Node.String() != tt.expected {
+				t.Errorf("want=%q, got=%q", tt.expected, quote.Node.String())
+			}
+		})
+	}
+}
+
+// macroexpand は組み込み関数なので、同じ名前で let したらそっちが使われる
+func TestMacroExpandShadowing(t *testing.T) {
+	evaluated := testEval(`let macroexpand = fn(x) { x * 2 }; macroexpand(21)`)
+
+	testIntegerObject(t, evaluated, 42)
+}
+
+func TestMacroExpandErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`macroexpand(1)`, "argument to `macroexpand` not supported, got INTEGER"},
+		{`macroexpand_1("foo")`, "argument to `macroexpand_1` not supported, got STRING"},
+		{`macroexpand()`, "argument error: wrong number of arguments (given 0, expected 1)"},
+		{`macroexpand(quote(1), quote(2))`, "argument error: wrong number of arguments (given 2, expected 1)"},
+		{`macroexpand(1 + true)`, "type mismatch: INTEGER + BOOLEAN"},
+		{
+			// 自分自身に展開され続けるマクロ
+			`let forever = macro() { quote(forever()) }; macroexpand(quote(forever()))`,
+			"macro expansion did not finish after 100 steps",
+		},
+		{
+			`let m = macro(x) { quote(m(unquote(x)) + m(unquote(x))) }; macroexpand(quote(m(1)))`,
+			"macro expansion did not finish after 10000 macro calls",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program := testParseProgram(tt.input)
+			env := object.NewEnvironment()
+			evaluator.DefineMacros(program, env)
+
+			evaluated := evaluator.Eval(program, env)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Fatalf("Errorオブジェクトじゃないよ！ got=%[1]T(%+[1]v)", evaluated)
+			}
+
+			if errObj.Message != tt.expected {
+				t.Errorf("want=%s, got=%s", tt.expected, errObj.Message)
+			}
+		})
+	}
+}
+
+func TestExpandMacrosWithTrace(t *testing.T) {
+	input := `
+	let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+	reverse(2 + 2, 10 - 5);
+	`
+	program := testParseProgram(input)
+	env := object.NewEnvironment()
+	evaluator.DefineMacros(program, env)
+
+	var trace strings.Builder
+	if _, err := evaluator.ExpandMacrosWithTrace(program, env, &trace); err != nil {
+		t.Fatalf("マクロ展開でエラーになったよ: %s", err)
+	}
+
+	expected := "macro call: reverse\n" +
+		"\ta = QUOTE((2 + 2))\n" +
+		"\tb = QUOTE((10 - 5))\n" +
+		"\t=> ((10 - 5) - (2 + 2))\n"
+
+	if trace.String() != expected {
+		t.Errorf("want=%q, got=%q", expected, trace.String())
+	}
+}
+
+func TestMacrosDefinedAnywhere(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// 関数の中で定義したマクロ
+		{
+			`
+			let f = fn(x) {
+				let double = macro(a) { quote(unquote(a) * 2) };
+				double(x);
+			};
+			f(21);
+			`,
+			42,
+		},
+		// if のブロックの中で定義したマクロ
+		{
+			`if (true) { let one = macro() { quote(1) }; one() + one() }`,
+			2,
+		},
+		// ブロックの外のマクロはブロックの中からも使える
+		{
+			`
+			let inc = macro(x) { quote(unquote(x) + 1) };
+			let f = fn(x) { if (true) { inc(x) } };
+			f(9);
+			`,
+			10,
+		},
+		// ブロックの中で定義したマクロは外側の同名のマクロより優先される
+		{
+			`
+			let answer = macro() { quote(1) };
+			let f = fn() { let answer = macro() { quote(42) }; answer() };
+			f() + answer();
+			`,
+			43,
+		},
+		// マクロの展開結果にマクロ呼び出しがある → 何も変わらなくなるまで展開する
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let doublePlusOne = macro(x) { quote(double(unquote(x)) + 1) };
+			doublePlusOne(5);
+			`,
+			11,
+		},
+		// マクロを定義するマクロ
+		{
+			`
+			let defineOne = macro() { quote(fn() { let one = macro() { quote(1) }; one() + one() }()) };
+			defineOne();
+			`,
+			2,
+		},
+		// 関数から返ってきたマクロは実行時にその場で展開される
+		{
+			`
+			let makeInc = fn() { macro(x) { quote(unquote(x) + 1) } };
+			let inc = makeInc();
+			inc(41);
+			`,
+			42,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEvalWithMacros(tt.input)
+
+			integer, ok := evaluated.(*object.Integer)
+			if !ok {
+				t.Fatalf("*object.Integer じゃないよ. got=%[1]T(%+[1]v)", evaluated)
+			}
+
+			if integer.Value != tt.expected {
+				t.Errorf("want=%d, got=%d", tt.expected, integer.Value)
+			}
+		})
+	}
+}
+
+func TestMacroDefinedInBlockIsScoped(t *testing.T) {
+	input := `
+	if (true) { let one = macro() { quote(1) }; one() };
+	one();
+	`
+	evaluated := testEvalWithMacros(input)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("Errorオブジェクトじゃないよ！ got=%[1]T(%+[1]v)", evaluated)
+	}
+
+	// ブロックの外ではマクロとして展開されないので、ただの未定義の識別子
+	if errObj.Message != "identifier not found: one" {
+		t.Errorf("got=%s", errObj.Message)
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let forever = macro() { quote(forever()) }; forever();`,
+			"macro expansion did not finish after 100 steps",
+		},
+		{
+			// 周回ごとに呼び出しが倍になるマクロ
+			`let m = macro(x) { quote(m(unquote(x)) + m(unquote(x))) }; m(1);`,
+			"macro expansion did not finish after 10000 macro calls",
+		},
+		{
+			// 呼び出しは増えないけど、展開結果が倍々で大きくなるマクロ
+			`let m = macro(x) { quote(m(unquote(x) + unquote(x))) }; m(1);`,
+			"macro expansion produced more than 1048576 nodes",
+		},
+		{
+			`let bad = macro() { 1 }; bad();`,
+			"macro bad must return QUOTE, got INTEGER",
+		},
+		{
+			`let bad = macro() { 1 + true }; bad();`,
+			"macro bad: type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			`let two = macro(a, b) { quote(unquote(a) + unquote(b)) }; two(1);`,
+			"argument error: wrong number of arguments to macro two (given 1, expected 2)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program := testParseProgram(tt.input)
+			env := object.NewEnvironment()
+			evaluator.DefineMacros(program, env)
+
+			_, err := evaluator.ExpandMacros(program, env)
+			if err == nil {
+				t.Fatalf("エラーにならないよ")
+			}
+
+			if err.Error() != tt.expected {
+				t.Errorf("want=%s, got=%s", tt.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestRepeatedMacroCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// 同じマクロを2回呼んでも、2回目が1回目の実引数で展開されたりしない
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			double(1) + double(10);
+			`,
+			22,
+		},
+		// マクロの中から同じマクロを2回呼ぶ
+		{
+			`
+			let inc = macro(x) { quote(unquote(x) + 1) };
+			let twice = macro(x) { quote(inc(inc(unquote(x)))) };
+			twice(1) + twice(5);
+			`,
+			10,
+		},
+		// 同じ実引数を2回埋め込む
+		{
+			`
+			let square = macro(x) { quote(unquote(x) * unquote(x)) };
+			let inc = macro(x) { quote(unquote(x) + 1) };
+			square(inc(2)) + square(inc(3));
+			`,
+			25,
+		},
+		// 関数から返ってきたマクロを何回も呼ぶ(実行時に展開される)
+		{
+			`
+			let makeAdder = fn() { macro(x) { quote(unquote(x) + 100) } };
+			let add100 = makeAdder();
+			add100(1) + add100(2);
+			`,
+			203,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEvalWithMacros(tt.input)
+
+			integer, ok := evaluated.(*object.Integer)
+			if !ok {
+				t.Fatalf("*object.Integer じゃないよ。got=%[1]T(%+[1]v)", evaluated)
+			}
+
+			if integer.Value != tt.expected {
+				t.Errorf("want=%d, got=%d", tt.expected, integer.Value)
+			}
+		})
+	}
+}
+
+func TestMacroExpansionDoesNotShareNodes(t *testing.T) {
+	program := testParseProgram(`
+	let square = macro(x) { quote(unquote(x) * unquote(x)) };
+	square(a + b);
+	square(a + b);
+	`)
+	callSite := make(map[ast.Node]bool)
+	ast.Inspect(program, func(node ast.Node) bool {
+		callSite[node] = true
+		return true
+	})
+
+	env := object.NewEnvironment()
+	evaluator.DefineMacros(program, env)
+	expanded, err := evaluator.ExpandMacros(program, env)
+	if err != nil {
+		t.Fatalf("展開でエラーになっちゃだめだよ。err=%s", err)
+	}
+
+	if expanded.String() != "((a + b) * (a + b))((a + b) * (a + b))" {
+		t.Fatalf("展開結果がおかしいよ。got=%q", expanded.String())
+	}
+
+	// 展開結果の中の式ノードは、全部新しく作られたもので、1回ずつしか出てこない
+	seen := make(map[ast.Node]bool)
+	ast.Inspect(expanded, func(node ast.Node) bool {
+		if _, ok := node.(ast.Expression); !ok || node == nil {
+			return true
+		}
+		if _, ok := node.(*ast.ExpressionStatement); ok {
+			return true
+		}
+
+		if seen[node] {
+			t.Errorf("同じノードが2回出てきたよ。%q", node.String())
+		}
+		if callSite[node] {
+			t.Errorf("呼び出し側のノードと共有されてるよ。%q", node.String())
+		}
+		seen[node] = true
+
+		return true
+	})
+}
+
+func TestQuoteIsNotModifiedByMacroExpand(t *testing.T) {
+	input := `
+	let double = macro(x) { quote(unquote(x) * 2) };
+	let q = quote(double(1));
+	let expanded = macroexpand(q);
+	q;
+	`
+
+	program := testParseProgram(input)
+	env := object.NewEnvironment()
+	evaluator.DefineMacros(program, env)
+
+	evaluated := evaluator.Eval(program, env)
+
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		t.Fatalf("*object.Quote じゃないよ. got=%[1]T(%+[1]v)", evaluated)
+	}
+
+	// macroexpand に渡した q は展開前のまま
+	if quote.Node.String() != "double(1)" {
+		t.Errorf("q が書き換わっちゃったよ。got=%q", quote.Node.String())
+	}
+}
+
+func TestMacroWithUnquoteSplicing(t *testing.T) {
+	input := `
+	let add = fn(a, b, c) { a + b + c };
+	let callWith = macro(f, args) { quote(unquote(f)(unquote_splicing(args))) };
+	callWith(add, [1, 2 * 5, 100]);
+	`
+
+	evaluated := testEvalWithMacros(input)
+
+	integer, ok := evaluated.(*object.Integer)
+	if !ok {
+		t.Fatalf("*object.Integer じゃないよ。got=%[1]T(%+[1]v)", evaluated)
+	}
+
+	if integer.Value != 111 {
+		t.Errorf("want=%d, got=%d", 111, integer.Value)
+	}
+}
+
+func TestQuasiQuoteMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			"let double = macro(x) { `(~x * 2) }; double(5 + 1)",
+			12,
+		},
+		{
+			"let unless = macro(cond, cons, alt) { `(if (!~cond) { ~cons } else { ~alt }) }; unless(1 > 2, 10, 20)",
+			10,
+		},
+		{
+			"let sum = fn(a, b, c) { a + b + c }; let apply = macro(f, args) { `(~f(~@args)) }; apply(sum, [1, 2, 3])",
+			6,
+		},
+		{
+			// quote(...) と混ぜて書いてもいい
+			"let inc = macro(x) { quote(~x + 1) }; let twice = macro(x) { `(inc(inc(~x))) }; twice(1) + twice(5)",
+			10,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEvalWithMacros(tt.input)
+
+			integer, ok := evaluated.(*object.Integer)
+			if !ok {
+				t.Fatalf("*object.Integer じゃないよ。got=%[1]T(%+[1]v)", evaluated)
+			}
+
+			if integer.Value != tt.expected {
+				t.Errorf("want=%d, got=%d", tt.expected, integer.Value)
+			}
+		})
+	}
+}
+
+func TestQuasiQuoteOutsideMacro(t *testing.T) {
+	evaluated := testEvalWithMacros("let x = 3; `(~x + ~@[1])")
+
+	// ~@ は引数か配列の要素のところでしか使えない
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("*object.Error じゃないよ。got=%[1]T(%+[1]v)", evaluated)
+	}
+
+	expected := "unquote error: unquote_splicing must be a call argument or an array element: unquote_splicing([1])"
+	if errObj.Message != expected {
+		t.Errorf("want=%q, got=%q", expected, errObj.Message)
+	}
+
+	evaluated = testEvalWithMacros("let x = 3; `(~x + ~(x * 2))")
+
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		t.Fatalf("*object.Quote じゃないよ。got=%[1]T(%+[1]v)", evaluated)
+	}
+
+	if quote.Node.String() != "(3 + 6)" {
+		t.Errorf("want=%q, got=%q", "(3 + 6)", quote.Node.String())
+	}
+}
@@ -0,0 +1,207 @@
+package evaluator
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/object"
+	"gomonkey/token"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// gensymCounter は gensym で作る名前の通し番号。
+var gensymCounter uint64
+
+// gensym が作る名前は "__tmp_1" みたいに gensymPrefix で始まって "_番号" で終わる。
+// これはふつうの識別子なのでユーザーも書けちゃう。なので、マクロを展開する前に reserveGensymNames で
+// プログラムの中の同じ形の名前を見て、gensym がその番号を使わないようにしている。
+const gensymPrefix = "__"
+
+// gensym は "__tmp_1" みたいな名前を作る。番号は呼ぶたびに増えるし、reserveGensymNames で見た名前の番号も使わない。
+func gensym(prefix string) string {
+	n := atomic.AddUint64(&gensymCounter, 1)
+
+	return fmt.Sprintf("%s%s_%d", gensymPrefix, prefix, n)
+}
+
+// reserveGensymNames は node の中に gensym が作るのと同じ形の名前があったら、
+// gensymCounter をその番号まで進めて、gensym がもうその名前を作らないようにする
+func reserveGensymNames(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			if n, ok := gensymNumber(ident.Value); ok {
+				reserveGensymNumber(n)
+			}
+		}
+		return true
+	})
+}
+
+// gensymNumber は name が "__tmp_1" みたいな形なら、その番号を返す
+func gensymNumber(name string) (uint64, bool) {
+	if !strings.HasPrefix(name, gensymPrefix) {
+		return 0, false
+	}
+
+	idx := strings.LastIndex(name, "_")
+	n, err := strconv.ParseUint(name[idx+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
+
+func reserveGensymNumber(n uint64) {
+	for {
+		current := atomic.LoadUint64(&gensymCounter)
+		if current >= n || atomic.CompareAndSwapUint64(&gensymCounter, current, n) {
+			return
+		}
+	}
+}
+
+func newIdentifier(name string) *ast.Identifier {
+	return &ast.Identifier{
+		Token: token.Token{Type: token.IDENT, Literal: name},
+		Value: name,
+	}
+}
+
+// hygienize はマクロ展開の結果のうち「マクロ本体が持ち込んだ束縛」の名前を付け替える。
+//
+//	let swap = macro(a, b) { quote(fn() { let tmp = unquote(a); ... }()) };
+//
+// みたいなマクロの tmp が、呼び出し側の tmp を上書きしたり、捕まえちゃったりしないようにするため。
+// 付け替えるのは束縛そのものと、その束縛を指している識別子だけ。束縛の外にある同じ名前(呼び出し側の変数とか)はそのまま。
+// 実引数として渡ってきたノード(呼び出し側のコード)には手を出さない。
+func hygienize(expanded ast.Node, quotedArgs []*object.Quote) (ast.Node, error) {
+	// 呼び出し側から来たノードを覚えておく。unquoteで埋め込まれたノードはポインタが同じなのでこれで見分けられる。
+	fromCallSite := make(map[ast.Node]bool)
+	for _, arg := range quotedArgs {
+		ast.Inspect(arg.Node, func(node ast.Node) bool {
+			if node != nil {
+				fromCallSite[node] = true
+			}
+			return true
+		})
+	}
+
+	// マクロ本体が持ち込んだ束縛(let文と関数の仮引数)を、スコープを見ながら集める
+	h := &hygieneVisitor{
+		scope:        &hygieneScope{names: make(map[string]string)},
+		fromCallSite: fromCallSite,
+		renames:      make(map[*ast.Identifier]string),
+	}
+	ast.Walk(h, expanded)
+
+	if len(h.renames) == 0 {
+		return expanded, nil
+	}
+
+	// 集めた識別子だけを付け替える。let文の名前や仮引数も Identifier として回ってくる。
+	return ast.Modify(expanded, func(node ast.Node) ast.Node {
+		if ident, ok := node.(*ast.Identifier); ok {
+			if renamed, ok := h.renames[ident]; ok {
+				return newIdentifier(renamed)
+			}
+		}
+
+		return node
+	})
+}
+
+// hygieneScope は1個の関数(か、展開結果のいちばん外側)の中で、マクロが持ち込んだ名前 → 付け替えた名前。
+// Monkey では if のブロックは新しい環境を作らないので、ブロックごとじゃなくて関数ごとに持つ。
+type hygieneScope struct {
+	names  map[string]string
+	parent *hygieneScope
+}
+
+func (s *hygieneScope) lookup(name string) (string, bool) {
+	for ; s != nil; s = s.parent {
+		if renamed, ok := s.names[name]; ok {
+			return renamed, true
+		}
+	}
+
+	return "", false
+}
+
+// hygieneVisitor は展開結果を行きがけ順に辿って、付け替える識別子を renames に集める。
+// ブロックの中の文は順番に辿るので、let で束縛した名前はその後ろの文からだけ見える。
+type hygieneVisitor struct {
+	scope        *hygieneScope
+	fromCallSite map[ast.Node]bool
+	renames      map[*ast.Identifier]string
+
+	// pending は let の右辺を辿っている間だけ使う。右辺の中の関数は呼ばれるころには let が済んでいるので、
+	// 関数の中からは束縛中の名前が見える(let f = fn() { f() } の f)
+	pending *hygieneScope
+}
+
+func (h *hygieneVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil || h.fromCallSite[node] {
+		// 呼び出し側のコードの中の名前は呼び出し側のものなので、中には入らない
+		return nil
+	}
+
+	switch node := node.(type) {
+	case *ast.Identifier:
+		if renamed, ok := h.scope.lookup(node.Value); ok {
+			h.renames[node] = renamed
+		}
+		return nil
+
+	case *ast.LetStatement:
+		// 同じ関数の中で同じ名前をもう一回 let したら、同じ環境の同じ変数を書き換えるので同じ名前にする
+		renamed, ok := h.scope.names[node.Name.Value]
+		if !ok {
+			renamed = gensym(node.Name.Value)
+		}
+		h.renames[node.Name] = renamed
+
+		if node.Value != nil {
+			pending := &hygieneScope{names: map[string]string{node.Name.Value: renamed}, parent: h.enclosing()}
+			ast.Walk(&hygieneVisitor{scope: h.scope, fromCallSite: h.fromCallSite, renames: h.renames, pending: pending}, node.Value)
+		}
+		h.scope.names[node.Name.Value] = renamed
+		return nil
+
+	case *ast.FunctionLiteral:
+		h.walkFunction(node.Parameters, node.Body)
+		return nil
+
+	case *ast.MacroLiteral:
+		h.walkFunction(node.Parameters, node.Body)
+		return nil
+	}
+
+	return h
+}
+
+// enclosing は関数の中から見える外側のスコープ
+func (h *hygieneVisitor) enclosing() *hygieneScope {
+	if h.pending != nil {
+		return h.pending
+	}
+
+	return h.scope
+}
+
+func (h *hygieneVisitor) walkFunction(parameters []*ast.Identifier, body *ast.BlockStatement) {
+	scope := &hygieneScope{names: make(map[string]string), parent: h.enclosing()}
+	for _, param := range parameters {
+		renamed, ok := scope.names[param.Value]
+		if !ok {
+			renamed = gensym(param.Value)
+			scope.names[param.Value] = renamed
+		}
+		h.renames[param] = renamed
+	}
+
+	if body != nil {
+		ast.Walk(&hygieneVisitor{scope: scope, fromCallSite: h.fromCallSite, renames: h.renames}, body)
+	}
+}
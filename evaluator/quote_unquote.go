@@ -8,43 +8,173 @@ import (
 )
 
 func quote(node ast.Node, env *object.Environment) object.Object {
-	node = evalUnquoteCalls(node, env)
+	// evalUnquoteCalls はノードをその場で書き換えるので、複製してから書き換える。
+	// そのまま書き換えると、マクロ本体の quote(...) が1回目の呼び出しの実引数で埋まったままになっちゃう。
+	node, errObj := evalUnquoteCalls(ast.Clone(node), env)
+	if errObj != nil {
+		return errObj
+	}
 
 	return &object.Quote{Node: node}
 }
 
-func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
+// evalUnquoteCalls は unquote の中身を評価して埋め込む。unquote_splicing は配列の要素をばらして埋め込む。
+// unquote の中身がエラーになったり、ASTに戻せない値(組み込み関数とか)だったりしたら *object.Error を返す。
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var evalErr *object.Error
+	setErr := func(errObj *object.Error) {
+		if evalErr == nil {
+			evalErr = errObj
+		}
+	}
+
 	// to俺: ast.Modifyをまず呼びだしているからな！
 	// 第2引数の 関数 はその後やで！
-	return ast.Modify(quoted, func(node ast.Node) ast.Node {
-		if !isUnquoteCall(node) {
-			return node
-		}
+	modified, err := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.UnquoteExpression:
+			if node.Splicing() {
+				// unquote_splicing は1つのノードを複数のノードにするので、親(呼び出し式か配列リテラル)のところで展開する
+				return node
+			}
+
+			converted, errObj := evalUnquote(node, env)
+			if errObj != nil {
+				setErr(errObj)
+				return node
+			}
+			return converted
 
-		// CallExpressionが確定しているのでエラーチェックいらないでしょ？ と思うのでそうしてます。
-		callExpr := node.(*ast.CallExpression)
+		case *ast.CallExpression:
+			arguments, errObj := evalUnquoteSplicing(node.Arguments, env)
+			if errObj != nil {
+				setErr(errObj)
+				return node
+			}
+			node.Arguments = arguments
 
-		if len(callExpr.Arguments) != 1 {
-			// 他のとこでチェックかもしれんが、とりあえずここでチェックしておく。やや些末なので別にいいでしょって思ってる。
-			return node
+		case *ast.ArrayLiteral:
+			elements, errObj := evalUnquoteSplicing(node.Elements, env)
+			if errObj != nil {
+				setErr(errObj)
+				return node
+			}
+			node.Elements = elements
 		}
 
-		evaluated := Eval(callExpr.Arguments[0], env)
+		return node
+	})
 
-		return convertObjectToASTNode(evaluated)
+	if evalErr != nil {
+		return nil, evalErr
+	}
 
+	if err != nil {
+		return nil, newError("unquote error: %s", err)
+	}
+
+	// 引数でも配列の要素でもないところに unquote_splicing があったら、展開しようがない
+	var misplaced *ast.UnquoteExpression
+	ast.Inspect(modified, func(node ast.Node) bool {
+		if unquote, ok := node.(*ast.UnquoteExpression); ok && unquote.Splicing() && misplaced == nil {
+			misplaced = unquote
+		}
+		return misplaced == nil
 	})
+	if misplaced != nil {
+		return nil, newError("unquote error: unquote_splicing must be a call argument or an array element: %s", misplaced.String())
+	}
+
+	return modified, nil
+}
+
+func evalUnquote(unquote *ast.UnquoteExpression, env *object.Environment) (ast.Expression, *object.Error) {
+	evaluated := Eval(unquote.Expression, env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, errObj
+	}
+
+	return convertObjectToExpression(evaluated)
+}
+
+// evalUnquoteSplicing は式のリストの中の unquote_splicing(xs) を、xs の要素に置き換える
+func evalUnquoteSplicing(expressions []ast.Expression, env *object.Environment) ([]ast.Expression, *object.Error) {
+	if !hasUnquoteSplicing(expressions) {
+		return expressions, nil
+	}
+
+	spliced := []ast.Expression{}
+	for _, expr := range expressions {
+		unquote, ok := expr.(*ast.UnquoteExpression)
+		if !ok || !unquote.Splicing() {
+			spliced = append(spliced, expr)
+			continue
+		}
+
+		elements, errObj := evalSplicedElements(unquote, env)
+		if errObj != nil {
+			return nil, errObj
+		}
+		spliced = append(spliced, elements...)
+	}
+
+	return spliced, nil
+}
+
+func hasUnquoteSplicing(expressions []ast.Expression) bool {
+	for _, expr := range expressions {
+		if unquote, ok := expr.(*ast.UnquoteExpression); ok && unquote.Splicing() {
+			return true
+		}
+	}
+
+	return false
 }
 
-func isUnquoteCall(node ast.Node) bool {
-	callExpr, ok := node.(*ast.CallExpression)
+func evalSplicedElements(unquote *ast.UnquoteExpression, env *object.Environment) ([]ast.Expression, *object.Error) {
+	evaluated := Eval(unquote.Expression, env)
+
+	switch evaluated := evaluated.(type) {
+	case *object.Error:
+		return nil, evaluated
+
+	case *object.Array:
+		var elements []ast.Expression
+		for _, element := range evaluated.Elements {
+			converted, errObj := convertObjectToExpression(element)
+			if errObj != nil {
+				return nil, errObj
+			}
+			elements = append(elements, converted)
+		}
+		return elements, nil
+
+	case *object.Quote:
+		// マクロの引数に書いた配列リテラル(m([a, b]) とか)は、評価されないまま Quote で渡ってくる
+		if array, ok := evaluated.Node.(*ast.ArrayLiteral); ok {
+			return array.Elements, nil
+		}
+	}
+
+	return nil, newError("unquote error: argument to `unquote_splicing` must be ARRAY, got %s", typeOf(evaluated))
+}
+
+func convertObjectToExpression(obj object.Object) (ast.Expression, *object.Error) {
+	node := convertObjectToASTNode(obj)
+
+	expr, ok := node.(ast.Expression)
 	if !ok {
-		return false
+		if quote, isQuote := obj.(*object.Quote); isQuote && quote.Node != nil {
+			// 文は式のところに埋め込めない
+			return nil, newError("unquote error: cannot embed %T as an expression", quote.Node)
+		}
+		return nil, newError("unquote error: cannot convert %s to AST node", typeOf(obj))
 	}
 
-	return callExpr.Function.TokenLiteral() == "unquote"
+	return expr, nil
 }
 
+// convertObjectToASTNode は評価した値をASTに戻す。戻せない値(組み込み関数とか)なら nil。
 func convertObjectToASTNode(obj object.Object) ast.Node {
 	switch obj := obj.(type) {
 	case *object.Integer:
@@ -56,6 +186,15 @@ func convertObjectToASTNode(obj object.Object) ast.Node {
 			Token: t,
 			Value: obj.Value,
 		}
+	case *object.BigInteger:
+		t := token.Token{
+			Type:    token.INT,
+			Literal: obj.Value.String(),
+		}
+		return &ast.IntegerLiteral{
+			Token:    t,
+			BigValue: obj.Value,
+		}
 	case *object.Boolean:
 		var t token.Token
 
@@ -66,9 +205,63 @@ func convertObjectToASTNode(obj object.Object) ast.Node {
 		}
 
 		return &ast.Boolean{Token: t, Value: obj.Value}
+	case *object.String:
+		return &ast.StringLiteral{
+			Token: token.Token{Type: token.STRING, Literal: obj.Value},
+			Value: obj.Value,
+		}
+	case *object.Null:
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null"}}
+	case *object.Array:
+		array := &ast.ArrayLiteral{
+			Token:    token.Token{Type: token.LBRACKET, Literal: "["},
+			Elements: []ast.Expression{},
+		}
+		for _, element := range obj.Elements {
+			converted, ok := convertObjectToASTNode(element).(ast.Expression)
+			if !ok {
+				return nil
+			}
+			array.Elements = append(array.Elements, converted)
+		}
+		return array
+	case *object.Hash:
+		hash := &ast.HashLiteral{
+			Token: token.Token{Type: token.LBRACE, Literal: "{"},
+			Pairs: make(map[ast.Expression]ast.Expression),
+		}
+		for _, pair := range obj.Pairs {
+			key, ok := convertObjectToASTNode(pair.Key).(ast.Expression)
+			if !ok {
+				return nil
+			}
+			value, ok := convertObjectToASTNode(pair.Value).(ast.Expression)
+			if !ok {
+				return nil
+			}
+			hash.Pairs[key] = value
+		}
+		return hash
+	case *object.Function:
+		// 関数リテラルに戻す。クロージャが捕まえていた環境は持っていけないので、
+		// 埋め込んだ先で自由変数が同じ名前の別の値を指すことはある。
+		return &ast.FunctionLiteral{
+			Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+			Parameters: cloneIdentifiers(obj.Parameters),
+			Body:       ast.Clone(obj.Body).(*ast.BlockStatement),
+		}
 	case *object.Quote:
 		return obj.Node
 	default:
 		return nil
 	}
 }
+
+func cloneIdentifiers(identifiers []*ast.Identifier) []*ast.Identifier {
+	cloned := []*ast.Identifier{}
+	for _, ident := range identifiers {
+		cloned = append(cloned, ast.Clone(ident).(*ast.Identifier))
+	}
+
+	return cloned
+}
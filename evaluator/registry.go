@@ -0,0 +1,270 @@
+package evaluator
+
+import (
+	"fmt"
+	"gomonkey/object"
+	"sort"
+	"strings"
+)
+
+// AnyType は「どの型の引数でもOK」という宣言に使う型
+const AnyType object.Type = "ANY"
+
+// OneOf は「このうちどれかの型ならOK」という宣言を作る。len の STRING か ARRAY みたいなやつ。
+func OneOf(types ...object.Type) object.Type {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+
+	return object.Type(strings.Join(names, "|"))
+}
+
+// Signature はビルトイン関数の引数の宣言。
+// Register した関数は、呼ばれる前に引数の数と型がこれでチェックされるので、Fn の中でチェックしなくていい。
+type Signature struct {
+	Params   []object.Type // 引数の型を前から順に。AnyType ならなんでもいい
+	Optional int           // Params の後ろから何個を省略できるか。gensym() と gensym("prefix") みたいなやつ
+	Variadic object.Type   // 空じゃなければ、Params の後ろにこの型の引数をいくつでも渡せる(puts みたいなやつ)
+}
+
+func (s Signature) check(name string, args []object.Object) *object.Error {
+	minArgs := len(s.Params) - s.Optional
+	maxArgs := len(s.Params)
+
+	if len(args) < minArgs {
+		return newError("argument error: wrong number of arguments (given %d, expected %d)", len(args), minArgs)
+	}
+	if s.Variadic == "" && len(args) > maxArgs {
+		return newError("argument error: wrong number of arguments (given %d, expected %d)", len(args), maxArgs)
+	}
+
+	for i, arg := range args {
+		expected := s.Variadic
+		if i < len(s.Params) {
+			expected = s.Params[i]
+		}
+
+		if !typeMatches(expected, arg) {
+			return newError("%s to `%s` not supported, got %s", s.argumentName(i), name, typeOf(arg))
+		}
+	}
+
+	return nil
+}
+
+// argumentName はエラーメッセージ用。引数が1個の関数なら "argument"、複数なら "first argument" みたいにする。
+func (s Signature) argumentName(i int) string {
+	if len(s.Params) == 1 && s.Variadic == "" {
+		return "argument"
+	}
+
+	ordinals := []string{"first", "second", "third", "fourth", "fifth"}
+	if i < len(ordinals) {
+		return ordinals[i] + " argument"
+	}
+
+	return fmt.Sprintf("argument %d", i+1)
+}
+
+func typeMatches(expected object.Type, arg object.Object) bool {
+	if expected == AnyType {
+		return true
+	}
+
+	for _, t := range strings.Split(string(expected), "|") {
+		if object.Type(t) == typeOf(arg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Registry は組み込み関数の一覧。evaluator は識別子が環境に見つからなかったらここを探す。
+// "math.sqrt" みたいにドットで区切った名前で登録すると、"math" モジュールの関数になる。
+//
+// 環境に Registry を持たせるには object.NewEnvironmentWithBuiltins を使う。
+// 持たせていない環境では DefaultRegistry() と同じ中身のものが使われる。
+type Registry struct {
+	builtins map[string]*object.Builtin
+}
+
+func NewRegistry() *Registry {
+	return &Registry{builtins: make(map[string]*object.Builtin)}
+}
+
+// Register は Go の関数を組み込み関数として登録する。同じ名前がもうあったら上書きする。
+// 名前が識別子として書けない形(空とか、数字始まりとか)なら panic する。登録するのはホスト側のコードなので、間違いはすぐ気づけたほうがいい。
+func (r *Registry) Register(name string, sig Signature, fn object.BuiltinFunction) {
+	if !isValidBuiltinName(name) {
+		panic(fmt.Sprintf("evaluator: invalid builtin name %q", name))
+	}
+
+	r.builtins[name] = &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if errObj := sig.check(name, args); errObj != nil {
+				return errObj
+			}
+			return fn(args...)
+		},
+	}
+}
+
+// RegisterIO は入出力を使う組み込み関数を登録する。fn には呼び出したところの環境の IO が渡る。
+// RestrictedRegistry では、RegisterIO で登録したものは全部消される。
+func (r *Registry) RegisterIO(name string, sig Signature, fn object.IOBuiltinFunction) {
+	if !isValidBuiltinName(name) {
+		panic(fmt.Sprintf("evaluator: invalid builtin name %q", name))
+	}
+
+	r.builtins[name] = &object.Builtin{
+		IOFn: func(io *object.IO, args ...object.Object) object.Object {
+			if errObj := sig.check(name, args); errObj != nil {
+				return errObj
+			}
+			return fn(io, args...)
+		},
+	}
+}
+
+// RegisterEnv は環境を見る組み込み関数を登録する。fn には呼び出したところの環境が渡る。
+// 関数の値として呼ばれたときも、呼び出したところの環境になる。環境なしで呼ばれたら(assert_error から呼ばれたとか) nil。
+func (r *Registry) RegisterEnv(name string, sig Signature, fn object.EnvBuiltinFunction) {
+	if !isValidBuiltinName(name) {
+		panic(fmt.Sprintf("evaluator: invalid builtin name %q", name))
+	}
+
+	r.builtins[name] = &object.Builtin{
+		EnvFn: func(env *object.Environment, args ...object.Object) object.Object {
+			if errObj := sig.check(name, args); errObj != nil {
+				return errObj
+			}
+			return fn(env, args...)
+		},
+	}
+}
+
+// Remove は name の組み込み関数を消す。なければ何もしない。
+func (r *Registry) Remove(name string) {
+	delete(r.builtins, name)
+}
+
+// RemoveModule は module に入っている組み込み関数("module.xxx")を全部消す
+func (r *Registry) RemoveModule(module string) {
+	for name := range r.builtins {
+		if strings.HasPrefix(name, module+".") {
+			delete(r.builtins, name)
+		}
+	}
+}
+
+func (r *Registry) Lookup(name string) (*object.Builtin, bool) {
+	builtin, ok := r.builtins[name]
+	return builtin, ok
+}
+
+// Names は登録されている名前をソートして返す
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.builtins))
+	for name := range r.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Modules は登録されているモジュール名("math" とか)をソートして返す
+func (r *Registry) Modules() []string {
+	seen := make(map[string]bool)
+	modules := []string{}
+	for name := range r.builtins {
+		i := strings.LastIndex(name, ".")
+		if i < 0 || seen[name[:i]] {
+			continue
+		}
+		seen[name[:i]] = true
+		modules = append(modules, name[:i])
+	}
+	sort.Strings(modules)
+
+	return modules
+}
+
+// Clone は中身をコピーした Registry を返す。コピーした側に Register や Remove をしても元のほうは変わらない。
+func (r *Registry) Clone() *Registry {
+	cloned := NewRegistry()
+	for name, builtin := range r.builtins {
+		cloned.builtins[name] = builtin
+	}
+
+	return cloned
+}
+
+func isValidBuiltinName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if part == "" || !isIdentStart(part[0]) {
+			return false
+		}
+		for i := 1; i < len(part); i++ {
+			if !isIdentStart(part[i]) && !('0' <= part[i] && part[i] <= '9') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func isIdentStart(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
+
+// DefaultRegistry は標準の組み込み関数が全部入った Registry を返す。
+// 毎回新しく作るので、返ってきたものに好きに Register や Remove をしていい。
+func DefaultRegistry() *Registry {
+	return defaultRegistry.Clone()
+}
+
+// RestrictedRegistry は DefaultRegistry から puts みたいな入出力の関数(RegisterIO で登録したもの)を抜いたもの。
+// 信用できないコードを評価するときに使う。
+func RestrictedRegistry() *Registry {
+	r := DefaultRegistry()
+	for name, builtin := range r.builtins {
+		if builtin.IOFn != nil {
+			delete(r.builtins, name)
+		}
+	}
+
+	return r
+}
+
+// defaultRegistry は環境に Registry が設定されていないときに使う。書き換えないこと！
+// macroexpand がマクロを展開する(= Eval を使う)ので、変数の初期化で作ると初期化が循環する。init で作る
+var defaultRegistry *Registry
+
+func init() {
+	defaultRegistry = newDefaultRegistry()
+}
+
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	registerCoreBuiltins(r)
+	registerIOBuiltins(r)
+	registerJSONBuiltins(r)
+	registerAssertBuiltins(r)
+	registerMacroBuiltins(r)
+	registerMathModule(r)
+	registerStrModule(r)
+
+	return r
+}
+
+func lookupBuiltin(name string, env *object.Environment) (*object.Builtin, bool) {
+	if builtins := env.Builtins(); builtins != nil {
+		return builtins.Lookup(name)
+	}
+
+	return defaultRegistry.Lookup(name)
+}
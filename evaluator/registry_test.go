@@ -0,0 +1,219 @@
+package evaluator_test
+
+import (
+	"gomonkey/evaluator"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"reflect"
+	"testing"
+)
+
+func testEvalWithRegistry(input string, registry *evaluator.Registry) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := object.NewEnvironmentWithBuiltins(registry)
+
+	return evaluator.Eval(program, env)
+}
+
+func TestModuleBuiltins(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`math.abs(-3)`, 3},
+		{`math.max(3, 9, 4)`, 9},
+		{`math.min(3, 9, 4)`, 3},
+		{`math.pow(2, 10)`, 1024},
+		{`math.sqrt(17)`, 4},
+		{`math.sqrt(math.pow(2, 100))`, "1125899906842624"},
+		{`str.split("a,b,c", ",")`, "[a, b, c]"},
+		{`str.join(["a", "b"], "-")`, "a-b"},
+		{`str.upper("abc")`, "ABC"},
+		{`str.lower("ABC")`, "abc"},
+		{`str.trim("  abc ")`, "abc"},
+		{`str.contains("monkey", "key")`, true},
+		{`math.pow(2, -1)`, "math.pow: negative exponent -1"},
+		// 大きすぎる結果は計算しないでエラーにする(計算が終わらなくなるので)
+		{`math.pow(2, 100000000000)`, "math.pow: result too large (more than 1048576 bits)"},
+		{`math.pow(-3, 99999999999999999999)`, "math.pow: result too large (more than 1048576 bits)"},
+		{`math.pow(2, 1048577)`, "math.pow: result too large (more than 1048576 bits)"},
+		{`math.pow(1, 100000000000)`, 1},
+		{`math.pow(-1, 100000000001)`, -1},
+		{`math.pow(0, 100000000000)`, 0},
+		{`math.sqrt(-1)`, "math.sqrt: negative argument -1"},
+		{`math.sqrt("9")`, "argument to `math.sqrt` not supported, got STRING"},
+		{`math.max()`, "argument error: wrong number of arguments (given 0, expected 1)"},
+		{`math.max(1, "2")`, "second argument to `math.max` not supported, got STRING"},
+		{`str.join([1], "")`, "str.join: array element 0 must be STRING, got INTEGER"},
+		{`math.nope(1)`, "identifier not found: math.nope"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			evaluated := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case bool:
+				testBooleanObject(t, evaluated, expected)
+			case string:
+				got := evaluated.Inspect()
+				if errObj, ok := evaluated.(*object.Error); ok {
+					got = errObj.Message
+				}
+				if got != expected {
+					t.Errorf("%q じゃないよ。got=%q", expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	t.Parallel()
+
+	registry := evaluator.DefaultRegistry()
+	registry.Register("host.add", evaluator.Signature{Params: []object.Type{object.IntegerObj, object.IntegerObj}},
+		func(args ...object.Object) object.Object {
+			return &object.Integer{Value: args[0].(*object.Integer).Value + args[1].(*object.Integer).Value}
+		})
+	registry.Register("host.describe", evaluator.Signature{
+		Params:   []object.Type{evaluator.OneOf(object.StringObj, object.ArrayObj), object.IntegerObj},
+		Optional: 1,
+	}, func(args ...object.Object) object.Object {
+		return &object.String{Value: args[0].Inspect()}
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`host.add(1, 2)`, "3"},
+		{`host.add(1)`, "argument error: wrong number of arguments (given 1, expected 2)"},
+		{`host.add(1, 2, 3)`, "argument error: wrong number of arguments (given 3, expected 2)"},
+		{`host.add(1, true)`, "second argument to `host.add` not supported, got BOOLEAN"},
+		{`host.describe("a")`, "a"},
+		{`host.describe([1], 2)`, "[1]"},
+		{`host.describe(1)`, "first argument to `host.describe` not supported, got INTEGER"},
+		{`host.describe()`, "argument error: wrong number of arguments (given 0, expected 1)"},
+		// ユーザー定義の変数のほうが優先される
+		{`let len = fn(x) { 42 }; len([])`, "42"},
+		{`len("abc")`, "3"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			evaluated := testEvalWithRegistry(tt.input, registry)
+
+			got := evaluated.Inspect()
+			if errObj, ok := evaluated.(*object.Error); ok {
+				got = errObj.Message
+			}
+			if got != tt.expected {
+				t.Errorf("%q じゃないよ。got=%q", tt.expected, got)
+			}
+		})
+	}
+
+	// DefaultRegistry は毎回新しく作るので、登録したものは他の Registry には見えない
+	if _, ok := evaluator.DefaultRegistry().Lookup("host.add"); ok {
+		t.Errorf("host.add が DefaultRegistry() に漏れてるよ")
+	}
+	if errObj, ok := testEval(`host.add(1, 2)`).(*object.Error); !ok || errObj.Message != "identifier not found: host.add" {
+		t.Errorf("host.add が標準の環境に漏れてるよ")
+	}
+}
+
+func TestRegistryRegisterInvalidName(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"", "1abc", "math.", ".sqrt", "a-b"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q を登録したのに panic しなかったよ", name)
+				}
+			}()
+
+			evaluator.NewRegistry().Register(name, evaluator.Signature{}, func(args ...object.Object) object.Object {
+				return evaluator.NULL
+			})
+		})
+	}
+}
+
+func TestRegistryRemove(t *testing.T) {
+	t.Parallel()
+
+	registry := evaluator.DefaultRegistry()
+	registry.Remove("len")
+	registry.RemoveModule("math")
+
+	if got := registry.Modules(); !reflect.DeepEqual(got, []string{"str"}) {
+		t.Errorf("モジュールは [str] だけのはず。got=%v", got)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len("a")`, "identifier not found: len"},
+		{`math.abs(1)`, "identifier not found: math.abs"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithRegistry(tt.input, registry)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: エラーになってないよ。got=%T (%s)", tt.input, evaluated, evaluated.Inspect())
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: %q じゃないよ。got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestRestrictedRegistry(t *testing.T) {
+	t.Parallel()
+
+	restricted := evaluator.RestrictedRegistry()
+
+	for _, name := range []string{"puts", "print", "eprint", "read_line"} {
+		if _, ok := restricted.Lookup(name); ok {
+			t.Errorf("RestrictedRegistry に %s が残ってるよ", name)
+		}
+	}
+	if _, ok := restricted.Lookup("len"); !ok {
+		t.Errorf("RestrictedRegistry から len まで消えてるよ")
+	}
+
+	// 関数の中(入れ子の環境)からも、外側の環境の Registry が使われる
+	evaluated := testEvalWithRegistry(`let f = fn() { puts("hi") }; f()`, restricted)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("puts が呼べちゃってるよ。got=%T (%s)", evaluated, evaluated.Inspect())
+	}
+	if errObj.Message != "identifier not found: puts" {
+		t.Errorf("違うエラーだよ。got=%q", errObj.Message)
+	}
+
+	// 制限した環境でも、大きすぎる math.pow で固まらない
+	evaluated = testEvalWithRegistry(`math.pow(2, 100000000000)`, restricted)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "math.pow: result too large (more than 1048576 bits)" {
+		t.Errorf("math.pow の上限のエラーにならないよ。got=%s", evaluated.Inspect())
+	}
+}
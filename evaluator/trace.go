@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/object"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// traceWidth より長いノードや値は、後ろを切って ... にする
+const traceWidth = 60
+
+// Tracer は評価したノードを1個ずつ、評価した結果といっしょに書き出す object.EvalHooks。
+// 環境に SetHooks すると、式がどう簡約されていくかのログになる。
+//
+//	env 0       1 => 1
+//	env 0         2 => 2
+//	env 0         3 => 3
+//	env 0       (2 * 3) => 6
+//	env 0     (1 + (2 * 3)) => 7
+//
+// 子のノードが先に終わるので、内側から順に出てくる。字下げは評価の入れ子の深さ。
+// "env N" は評価した環境が、最初に評価した環境から何段内側か。関数の中は、関数を作った環境の1段内側になるので、
+// クロージャがどの環境で評価されているのかがわかる。
+// Program と、ブロックと式文は中の式と同じ結果が並ぶだけなので書かない。let は値を返さないので結果なしで書く。
+type Tracer struct {
+	w         io.Writer
+	depth     int // 評価の入れ子の深さ
+	baseDepth int // 最初に評価した環境の深さ。-1 ならまだ何も評価していない
+}
+
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{w: w, baseDepth: -1}
+}
+
+func (t *Tracer) BeforeEval(node ast.Node, env *object.Environment) {
+	if t.baseDepth < 0 {
+		t.baseDepth = envDepth(env)
+	}
+	t.depth++
+}
+
+func (t *Tracer) AfterEval(node ast.Node, env *object.Environment, result object.Object) {
+	t.depth--
+
+	switch node.(type) {
+	case *ast.Program, *ast.BlockStatement, *ast.ExpressionStatement:
+		return
+	case *ast.LetStatement:
+		if result == nil {
+			t.printf(env, "%s", traceString(node.String()))
+			return
+		}
+	}
+
+	t.printf(env, "%s => %s", traceString(node.String()), traceString(inspect(result)))
+}
+
+// EnterFunction は関数を呼ぶところも書いておく。引数を評価し終わって、本体を評価する前
+func (t *Tracer) EnterFunction(call *ast.CallExpression, fn object.Object, args []object.Object) {
+	inspected := make([]string, len(args))
+	for i, arg := range args {
+		inspected[i] = inspect(arg)
+	}
+
+	t.printf(nil, "call %s(%s)", traceString(call.Function.String()), traceString(strings.Join(inspected, ", ")))
+}
+
+func (t *Tracer) ExitFunction(call *ast.CallExpression, fn object.Object, result object.Object) {}
+
+// printf は今の深さで1行書く。env が nil なら "env N" は空けておく
+func (t *Tracer) printf(env *object.Environment, format string, args ...interface{}) {
+	label := "     "
+	if env != nil {
+		label = fmt.Sprintf("env %d", envDepth(env)-t.baseDepth)
+	}
+
+	fmt.Fprintf(t.w, "%s %s%s\n", label, strings.Repeat("  ", t.depth), fmt.Sprintf(format, args...))
+}
+
+func envDepth(env *object.Environment) int {
+	depth := 0
+	for e := env.Outer(); e != nil; e = e.Outer() {
+		depth++
+	}
+
+	return depth
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+
+	return obj.Inspect()
+}
+
+// traceString は改行をつぶして1行にして、長ければ切る
+func traceString(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= traceWidth {
+		return s
+	}
+
+	return string([]rune(s)[:traceWidth-3]) + "..."
+}
@@ -0,0 +1,85 @@
+package evaluator_test
+
+import (
+	"gomonkey/evaluator"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"strings"
+	"testing"
+)
+
+func traceEval(input string) string {
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	var out strings.Builder
+	env := object.NewEnvironment()
+	env.SetHooks(evaluator.NewTracer(&out))
+	evaluator.Eval(program, env)
+
+	return out.String()
+}
+
+func TestTracer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"1 + 2 * 3",
+			`env 0       1 => 1
+env 0         2 => 2
+env 0         3 => 3
+env 0       (2 * 3) => 6
+env 0     (1 + (2 * 3)) => 7
+`,
+		},
+		{
+			// 内側の関数は、外側の関数を呼んだときの環境(env 1)の中で評価される
+			"let adder = fn(a) { fn(b) { a + b } };\nadder(1)(2);",
+			`env 0     fn(a) { fn(b) { (a + b) } } => fn(a) { fn(b) { (a + b) } }
+env 0   let adder = fn(a) { fn(b) { (a + b) } };
+env 0         adder => fn(a) { fn(b) { (a + b) } }
+env 0         1 => 1
+              call adder(1)
+env 1             fn(b) { (a + b) } => fn(b) { (a + b) }
+env 0       adder(1) => fn(b) { (a + b) }
+env 0       2 => 2
+            call adder(1)(2)
+env 2             a => 1
+env 2             b => 2
+env 2           (a + b) => 3
+env 0     adder(1)(2) => 3
+`,
+		},
+		{
+			"if (1 > 2) { 1 } else { 1 + true }",
+			`env 0         1 => 1
+env 0         2 => 2
+env 0       (1 > 2) => false
+env 0             1 => 1
+env 0             true => true
+env 0           (1 + true) => 💥 ERROR:type mismatch: INTEGER + BOOLEAN
+env 0     if(1 > 2) 1else (1 + true) => 💥 ERROR:type mismatch: INTEGER + BOOLEAN
+`,
+		},
+		{
+			// 長いものは切る
+			`"` + strings.Repeat("a", 70) + `"`,
+			"env 0     " + strings.Repeat("a", 57) + "... => " + strings.Repeat("a", 57) + "...\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			if got := traceEval(tt.input); got != tt.expected {
+				t.Errorf("トレースがおかしいよ。\nwant=\n%s\ngot=\n%s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+// Package format は Monkey のプログラムを決まった形に整形する。gofmt の Monkey 版。
+// ast.Node の String() は全部括弧で囲んで1行にしちゃうので、読む用にはこっちを使う。
+// Monkey にはコメントがないので、AST から書き直しても消えるものはない。
+package format
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/lexer"
+	"gomonkey/parser"
+	"sort"
+	"strings"
+)
+
+// Config は整形のしかた
+type Config struct {
+	Indent string // 1段の字下げ。空ならタブ
+}
+
+// Program はデフォルトの設定(タブで字下げ)で整形する
+func Program(program *ast.Program) string {
+	return Config{}.Program(program)
+}
+
+// Source は src をパースして整形する。パースエラーがあったら整形せずにエラーを返す。
+func Source(src string) (string, error) {
+	return Config{}.Source(src)
+}
+
+func (c Config) Source(src string) (string, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+
+	if details := p.ErrorDetails(); len(details) != 0 {
+		return "", fmt.Errorf("%s", details[0])
+	}
+
+	return c.Program(program), nil
+}
+
+func (c Config) Program(program *ast.Program) string {
+	indent := c.Indent
+	if indent == "" {
+		indent = "\t"
+	}
+
+	pr := &printer{indent: indent}
+	for _, stmt := range program.Statements {
+		pr.statement(stmt)
+		pr.newline()
+	}
+
+	return pr.out.String()
+}
+
+// 演算子の優先順位。parser の LOWEST 〜 INDEX と同じ並び
+const (
+	precLowest = iota
+	precEquals
+	precLessGreater
+	precSum
+	precProduct
+	precPrefix
+	precCall
+)
+
+var infixPrecedences = map[string]int{
+	"==": precEquals,
+	"!=": precEquals,
+	"<":  precLessGreater,
+	">":  precLessGreater,
+	"+":  precSum,
+	"-":  precSum,
+	"*":  precProduct,
+	"/":  precProduct,
+	"%":  precProduct,
+}
+
+type printer struct {
+	out    strings.Builder
+	indent string
+	depth  int
+}
+
+func (pr *printer) write(s string) {
+	pr.out.WriteString(s)
+}
+
+func (pr *printer) newline() {
+	pr.out.WriteString("\n")
+}
+
+func (pr *printer) writeIndent() {
+	pr.out.WriteString(strings.Repeat(pr.indent, pr.depth))
+}
+
+func (pr *printer) statement(stmt ast.Statement) {
+	pr.writeIndent()
+
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		pr.write("let " + stmt.Name.Value + " = ")
+		pr.expression(stmt.Value, precLowest)
+		pr.write(";")
+
+	case *ast.ReturnStatement:
+		pr.write("return ")
+		pr.expression(stmt.ReturnValue, precLowest)
+		pr.write(";")
+
+	case *ast.ExpressionStatement:
+		pr.expression(stmt.Expression, precLowest)
+		// if はブロックで終わっているので ; を付けないほうが見慣れた形になる
+		if _, ok := stmt.Expression.(*ast.IfExpression); !ok {
+			pr.write(";")
+		}
+
+	case *ast.BlockStatement:
+		pr.block(stmt)
+
+	default:
+		pr.write(stmt.String())
+	}
+}
+
+// block は `{` から `}` までを書く。中身は1文1行で1段下げる。空なら {}
+func (pr *printer) block(block *ast.BlockStatement) {
+	if block == nil || len(block.Statements) == 0 {
+		pr.write("{}")
+		return
+	}
+
+	pr.write("{")
+	pr.newline()
+	pr.depth++
+	for _, stmt := range block.Statements {
+		pr.statement(stmt)
+		pr.newline()
+	}
+	pr.depth--
+	pr.writeIndent()
+	pr.write("}")
+}
+
+// expression は expr を書く。expr の優先順位が outer より低ければ括弧で囲む。
+func (pr *printer) expression(expr ast.Expression, outer int) {
+	if expr == nil {
+		return
+	}
+
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		pr.write(expr.Value)
+
+	case *ast.IntegerLiteral:
+		// 書いてあったとおりに書く(int64 に収まらない大きい整数もそのまま)
+		if expr.Token.Literal != "" {
+			pr.write(expr.Token.Literal)
+		} else {
+			pr.write(expr.String())
+		}
+
+	case *ast.StringLiteral:
+		pr.write(`"` + expr.Value + `"`)
+
+	case *ast.Boolean, *ast.NullLiteral:
+		pr.write(expr.TokenLiteral())
+
+	case *ast.PrefixExpression:
+		pr.parenthesize(outer > precPrefix, func() {
+			pr.write(expr.Operator)
+			pr.expression(expr.Right, precPrefix)
+		})
+
+	case *ast.InfixExpression:
+		prec := infixPrecedences[expr.Operator]
+		pr.parenthesize(outer > prec, func() {
+			pr.expression(expr.Left, prec)
+			pr.write(" " + expr.Operator + " ")
+			// 左結合なので、右側に同じ優先順位の式が来たら括弧が要る(a - (b - c))
+			pr.expression(expr.Right, prec+1)
+		})
+
+	case *ast.IfExpression:
+		pr.write("if (")
+		pr.expression(expr.Condition, precLowest)
+		pr.write(") ")
+		pr.block(expr.Consequence)
+		if expr.Alternative != nil {
+			pr.write(" else ")
+			pr.block(expr.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		pr.function("fn", expr.Parameters, expr.Body)
+
+	case *ast.MacroLiteral:
+		pr.function("macro", expr.Parameters, expr.Body)
+
+	case *ast.CallExpression:
+		pr.expression(expr.Function, precCall)
+		pr.write("(")
+		pr.expressionList(expr.Arguments)
+		pr.write(")")
+
+	case *ast.ArrayLiteral:
+		pr.write("[")
+		pr.expressionList(expr.Elements)
+		pr.write("]")
+
+	case *ast.HashLiteral:
+		pr.hash(expr)
+
+	case *ast.IndexExpression:
+		pr.expression(expr.Left, precCall)
+		pr.write("[")
+		pr.expression(expr.Index, precLowest)
+		pr.write("]")
+
+	case *ast.SliceExpression:
+		pr.expression(expr.Left, precCall)
+		pr.write("[")
+		pr.expression(expr.Start, precLowest)
+		pr.write(":")
+		pr.expression(expr.End, precLowest)
+		pr.write("]")
+
+	case *ast.QuoteExpression:
+		pr.write("quote(")
+		pr.expression(expr.Expression, precLowest)
+		pr.write(")")
+
+	case *ast.UnquoteExpression:
+		pr.write(expr.TokenLiteral() + "(")
+		pr.expression(expr.Expression, precLowest)
+		pr.write(")")
+
+	default:
+		pr.write(expr.String())
+	}
+}
+
+func (pr *printer) parenthesize(needed bool, f func()) {
+	if needed {
+		pr.write("(")
+	}
+	f()
+	if needed {
+		pr.write(")")
+	}
+}
+
+func (pr *printer) function(keyword string, parameters []*ast.Identifier, body *ast.BlockStatement) {
+	names := make([]string, len(parameters))
+	for i, param := range parameters {
+		names[i] = param.Value
+	}
+
+	pr.write(keyword + "(" + strings.Join(names, ", ") + ") ")
+	pr.block(body)
+}
+
+func (pr *printer) expressionList(expressions []ast.Expression) {
+	for i, expr := range expressions {
+		if i > 0 {
+			pr.write(", ")
+		}
+		pr.expression(expr, precLowest)
+	}
+}
+
+// hash はキーを整形した文字列の順に並べて書く(Pairs はマップなので、そのままだと毎回順番が変わる)
+func (pr *printer) hash(hash *ast.HashLiteral) {
+	type pair struct {
+		key, value string
+	}
+
+	pairs := make([]pair, 0, len(hash.Pairs))
+	for key, value := range hash.Pairs {
+		pairs = append(pairs, pair{key: pr.sub(key), value: pr.sub(value)})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].key < pairs[j].key
+	})
+
+	pr.write("{")
+	for i, p := range pairs {
+		if i > 0 {
+			pr.write(", ")
+		}
+		pr.write(p.key + ": " + p.value)
+	}
+	pr.write("}")
+}
+
+// sub は expr を今の字下げのまま別の printer で書いて、文字列でもらう
+func (pr *printer) sub(expr ast.Expression) string {
+	sub := &printer{indent: pr.indent, depth: pr.depth}
+	sub.expression(expr, precLowest)
+
+	return sub.out.String()
+}
@@ -0,0 +1,87 @@
+package format_test
+
+import (
+	"gomonkey/format"
+	"gomonkey/lexer"
+	"gomonkey/parser"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a=1+2*3", "let a = 1 + 2 * 3;\n"},
+		{"(1+2)*3;1-(2-3);(1-2)-3", "(1 + 2) * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n"},
+		{"!(1<2); -(-x); (-a)[0]; -f(x)", "!(1 < 2);\n--x;\n(-a)[0];\n-f(x);\n"},
+		{"return   x", "return x;\n"},
+		{`let h={"b":2,"a":[1,2][0:1]}`, "let h = {\"a\": [1, 2][0:1], \"b\": 2};\n"},
+		{"a[:1]; a[1:]; {}; []; null; true", "a[:1];\na[1:];\n{};\n[];\nnull;\ntrue;\n"},
+		{"if(x>1){1}else{2}", "if (x > 1) {\n\t1;\n} else {\n\t2;\n}\n"},
+		{"if(x){}", "if (x) {}\n"},
+		{"let f=fn(x,y){let z=x;return z*y}", "let f = fn(x, y) {\n\tlet z = x;\n\treturn z * y;\n};\n"},
+		{"map(a,fn(x){x*2})", "map(a, fn(x) {\n\tx * 2;\n});\n"},
+		{"let m=macro(a){`(~a+f(~@xs))}", "let m = macro(a) {\n\tquote(unquote(a) + f(unquote_splicing(xs)));\n};\n"},
+		{"99999999999999999999+1", "99999999999999999999 + 1;\n"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := format.Source(tt.input)
+			if err != nil {
+				t.Fatalf("エラーになっちゃった: %s", err)
+			}
+			if got != tt.expected {
+				t.Errorf("%q じゃないよ。got=%q", tt.expected, got)
+			}
+
+			// 整形したものをもう1回パースしたら同じ AST になるし、もう1回整形しても変わらない
+			p := parser.New(lexer.New(got))
+			reparsed := p.ParseProgram()
+			if len(p.Errors()) != 0 {
+				t.Fatalf("整形したものがパースできないよ: %v", p.Errors())
+			}
+			original := parser.New(lexer.New(tt.input)).ParseProgram()
+			if reparsed.String() != original.String() {
+				t.Errorf("整形で意味が変わっちゃった。want=%q, got=%q", original.String(), reparsed.String())
+			}
+			if again := format.Program(reparsed); again != got {
+				t.Errorf("2回目の整形で変わっちゃった。got=%q", again)
+			}
+		})
+	}
+}
+
+func TestSourceIndent(t *testing.T) {
+	t.Parallel()
+
+	got, err := format.Config{Indent: "  "}.Source("fn(){if(x){1}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "fn() {\n  if (x) {\n    1;\n  }\n};\n"
+	if got != expected {
+		t.Errorf("%q じゃないよ。got=%q", expected, got)
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	t.Parallel()
+
+	_, err := format.Source("let = 1;")
+	if err == nil {
+		t.Fatal("パースエラーなのにエラーにならないよ")
+	}
+
+	expected := "1:5: 😢 次のトークンは IDENT になってほしいけど、 = が来ちゃってる！"
+	if err.Error() != expected {
+		t.Errorf("%q じゃないよ。got=%q", expected, err.Error())
+	}
+}
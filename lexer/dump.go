@@ -0,0 +1,23 @@
+package lexer
+
+import (
+	"fmt"
+	"gomonkey/token"
+	"io"
+	"text/tabwriter"
+)
+
+// WriteTokens はトークンを1行に1個、位置と種類とリテラルを揃えて書く。
+// リテラルは空白や空文字列もわかるように "" で囲む。
+//
+//	1:1  LET    "let"
+//	1:5  IDENT  "x"
+//	1:7  =      "="
+func WriteTokens(w io.Writer, tokens []token.Token) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, tok := range tokens {
+		fmt.Fprintf(tw, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+
+	return tw.Flush()
+}
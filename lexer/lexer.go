@@ -9,15 +9,25 @@ type Lexer struct {
 	position     int // 現在見ている文字
 	readPosition int // 次の文字
 	ch           byte
+	line         int // ch の行(1始まり)
+	column       int // ch の列(1始まり、バイト単位)
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	// 今の文字が改行なら、次の文字は次の行の先頭
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -33,6 +43,8 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.skipWhitespace()
 
+	pos := token.Position{Line: l.line, Column: l.column}
+
 	switch l.ch {
 	case '"':
 		tok.Type = token.STRING
@@ -54,6 +66,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.ASTERISK, l.ch)
 	case '/':
 		tok = newToken(token.SLASH, l.ch)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
 		tok = newToken(token.LT, l.ch)
 	case '>':
@@ -76,6 +90,17 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '`':
+		tok = newToken(token.BACKQUOTE, l.ch)
+	case '~':
+		if l.peekChar() == '@' {
+			ch := l.ch
+			l.readChar()
+			tok.Type = token.TILDE_AT
+			tok.Literal = string(ch) + string(l.ch)
+		} else {
+			tok = newToken(token.TILDE, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -92,10 +117,12 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok // もうreadCharしてるから、ここで早期リターン
 		} else if isDigit(l.ch) {
 			tok.Literal = l.readNumber()
 			tok.Type = token.INT // 整数だけの世界線でいくぞ
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -104,6 +131,8 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.readChar()
 
+	tok.Pos = pos
+
 	return tok
 }
 
@@ -120,7 +149,9 @@ func isLetter(ch byte) bool {
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	// 先頭は英字かアンダースコアだけど、2文字目からは数字もOK(macroexpand_1 とか)
+	// math.sqrt みたいに、ドットのすぐ後ろに英字が続くなら、モジュールの関数名としてまとめて1つの識別子にする
+	for isLetter(l.ch) || isDigit(l.ch) || (l.ch == '.' && isLetter(l.peekChar())) {
 		l.readChar()
 	}
 
@@ -170,3 +201,16 @@ func (l *Lexer) readString() string {
 
 	return l.input[position:l.position]
 }
+
+// All は今の位置から最後までトークンを読んで、最後の EOF も含めて返す。
+// パーサーを通さずにトークンの並びを見たいツール(gomonkey tokens とか)向け。読んだ分だけ Lexer は進む。
+func (l *Lexer) All() []token.Token {
+	var tokens []token.Token
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
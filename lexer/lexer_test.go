@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"gomonkey/token"
+	"strings"
 	"testing"
 )
 
@@ -9,6 +10,7 @@ func TestNextToken_1文字(t *testing.T) {
 	input := `=+(){},;
 !-/*5
 <>
+%
 `
 
 	tests := []struct {
@@ -34,6 +36,8 @@ func TestNextToken_1文字(t *testing.T) {
 		{token.LT, "<"},
 		{token.GT, ">"},
 
+		{token.PERCENT, "%"},
+
 		{token.EOF, ""},
 	}
 
@@ -317,3 +321,229 @@ func TestNextToken_ハッシュリテラルに関係するやつ(t *testing.T) {
 		}
 	}
 }
+
+func TestNextToken_位置(t *testing.T) {
+	input := `let x = 10;
+  "ab" != y
+`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{"let", token.Position{Line: 1, Column: 1}},
+		{"x", token.Position{Line: 1, Column: 5}},
+		{"=", token.Position{Line: 1, Column: 7}},
+		{"10", token.Position{Line: 1, Column: 9}},
+		{";", token.Position{Line: 1, Column: 11}},
+		{"ab", token.Position{Line: 2, Column: 3}},
+		{"!=", token.Position{Line: 2, Column: 8}},
+		{"y", token.Position{Line: 2, Column: 11}},
+		{"", token.Position{Line: 3, Column: 1}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%s, got=%s", i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestNextToken_quoteとunquote(t *testing.T) {
+	input := `quote(unquote(x), unquote_splicing(xs), null)`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.QUOTE, "quote"},
+		{token.LPAREN, "("},
+		{token.UNQUOTE, "unquote"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.COMMA, ","},
+		{token.UNQUOTE_SPLICING, "unquote_splicing"},
+		{token.LPAREN, "("},
+		{token.IDENT, "xs"},
+		{token.RPAREN, ")"},
+		{token.COMMA, ","},
+		{token.NULL, "null"},
+		{token.RPAREN, ")"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextToken_quoteとunquoteの略記(t *testing.T) {
+	input := "`(~a + f(~@xs)) ~ @"
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.BACKQUOTE, "`"},
+		{token.LPAREN, "("},
+		{token.TILDE, "~"},
+		{token.IDENT, "a"},
+		{token.PLUS, "+"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.TILDE_AT, "~@"},
+		{token.IDENT, "xs"},
+		{token.RPAREN, ")"},
+		{token.RPAREN, ")"},
+		// 間が空いていたら ~@ にはならない
+		{token.TILDE, "~"},
+		{token.ILLEGAL, "@"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextToken_モジュールの関数名(t *testing.T) {
+	input := "math.sqrt(9) str.split a. b .c x.1"
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.IDENT, "math.sqrt"},
+		{token.LPAREN, "("},
+		{token.INT, "9"},
+		{token.RPAREN, ")"},
+		{token.IDENT, "str.split"},
+		// ドットのすぐ後ろが英字じゃなければ識別子には入れない
+		{token.IDENT, "a"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "b"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "c"},
+		{token.IDENT, "x"},
+		{token.ILLEGAL, "."},
+		{token.INT, "1"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextToken_数字の入った識別子(t *testing.T) {
+	input := "x1 macroexpand_1 1x a1b2 math.log10"
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		// 2文字目からは数字も識別子に入る
+		{token.IDENT, "x1"},
+		{token.IDENT, "macroexpand_1"},
+		// 数字で始まったら数字。すぐ後ろの英字は別の識別子になる
+		{token.INT, "1"},
+		{token.IDENT, "x"},
+		{token.IDENT, "a1b2"},
+		{token.IDENT, "math.log10"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestAll(t *testing.T) {
+	tokens := New("x>=1").All()
+
+	// >= というトークンはないので、> と = に分かれる
+	expected := []token.Token{
+		{Type: token.IDENT, Literal: "x", Pos: token.Position{Line: 1, Column: 1}},
+		{Type: token.GT, Literal: ">", Pos: token.Position{Line: 1, Column: 2}},
+		{Type: token.ASSIGN, Literal: "=", Pos: token.Position{Line: 1, Column: 3}},
+		{Type: token.INT, Literal: "1", Pos: token.Position{Line: 1, Column: 4}},
+		{Type: token.EOF, Literal: "", Pos: token.Position{Line: 1, Column: 5}},
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("トークンが %d 個じゃないよ。got=%v", len(expected), tokens)
+	}
+	for i, tok := range tokens {
+		if tok != expected[i] {
+			t.Errorf("tokens[%d] が %+v じゃないよ。got=%+v", i, expected[i], tok)
+		}
+	}
+}
+
+func TestWriteTokens(t *testing.T) {
+	var out strings.Builder
+	if err := WriteTokens(&out, New("let s = \"a b\";\n@").All()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `1:1   LET      "let"
+1:5   IDENT    "s"
+1:7   =        "="
+1:9   STRING   "a b"
+1:14  ;        ";"
+2:1   ILLEGAL  "@"
+2:2   EOF      ""
+`
+	if out.String() != expected {
+		t.Errorf("出力がおかしいよ。\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
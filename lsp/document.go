@@ -0,0 +1,269 @@
+package lsp
+
+import (
+	"gomonkey/analysis"
+	"gomonkey/ast"
+	"gomonkey/format"
+	"gomonkey/lexer"
+	"gomonkey/parser"
+	"gomonkey/token"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// document は開いているファイル1個。中身が変わるたびに作り直す(Full 同期なので、差分を当てたりはしない)
+type document struct {
+	uri         string
+	text        string
+	lines       []string
+	program     *ast.Program
+	parseErrors []parser.Error
+	info        *analysis.Info // 解析できなかったら nil
+}
+
+func newDocument(uri, text string) *document {
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+
+	d := &document{
+		uri:         uri,
+		text:        text,
+		lines:       strings.Split(text, "\n"),
+		program:     program,
+		parseErrors: p.ErrorDetails(),
+	}
+	d.info = resolve(program)
+
+	return d
+}
+
+// resolve はパースエラーがあって AST が欠けていても、解析できるところまでは解析したい。
+// 欠け方によっては途中で panic するかもしれないので、そのときは解析結果なしにする(診断とかは出せなくなるだけ)
+func resolve(program *ast.Program) (info *analysis.Info) {
+	defer func() {
+		if recover() != nil {
+			info = nil
+		}
+	}()
+
+	return analysis.Resolve(program)
+}
+
+// toLSP はバイト数で1始まりの token.Position を、UTF-16 で0始まりの LSP の Position にする
+func (d *document) toLSP(pos token.Position) Position {
+	if !pos.IsValid() {
+		return Position{}
+	}
+
+	line := pos.Line - 1
+	if line >= len(d.lines) {
+		return d.endPosition()
+	}
+
+	text := d.lines[line]
+	column := pos.Column - 1
+	if column > len(text) {
+		column = len(text)
+	}
+
+	return Position{Line: line, Character: utf16Len(text[:column])}
+}
+
+// fromLSP は toLSP の逆
+func (d *document) fromLSP(pos Position) token.Position {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return token.Position{}
+	}
+
+	text := d.lines[pos.Line]
+	units := 0
+	for offset, r := range text {
+		if units >= pos.Character {
+			return token.Position{Line: pos.Line + 1, Column: offset + 1}
+		}
+		units += utf16RuneLen(r)
+	}
+
+	return token.Position{Line: pos.Line + 1, Column: len(text) + 1}
+}
+
+// span は pos から length バイト分の範囲
+func (d *document) span(pos token.Position, length int) Range {
+	end := pos
+	end.Column += length
+
+	return Range{Start: d.toLSP(pos), End: d.toLSP(end)}
+}
+
+func (d *document) identRange(ident *ast.Identifier) Range {
+	return d.span(ident.Token.Pos, len(ident.Value))
+}
+
+func (d *document) endPosition() Position {
+	last := len(d.lines) - 1
+	return Position{Line: last, Character: utf16Len(d.lines[last])}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16RuneLen(r)
+	}
+	return n
+}
+
+func utf16RuneLen(r rune) int {
+	// BMP の外(絵文字とか)はサロゲートペアで2つ分
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
+
+func (d *document) diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	for _, err := range d.parseErrors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.span(err.Pos, 1),
+			Severity: 1,
+			Source:   "gomonkey",
+			Message:  err.Message,
+		})
+	}
+
+	// パースエラーがあると AST が欠けていて「定義されてない」とかが的外れになりがちなので、lint はきれいにパースできたときだけ
+	if len(d.parseErrors) != 0 || d.info == nil {
+		return diagnostics
+	}
+
+	for _, diag := range analysis.Lint(d.info) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.span(diag.Pos, diag.Length),
+			Severity: lspSeverity(diag.Severity),
+			Source:   "gomonkey",
+			Message:  diag.Message,
+		})
+	}
+
+	return diagnostics
+}
+
+func lspSeverity(severity analysis.Severity) int {
+	switch severity {
+	case analysis.SeverityError:
+		return 1
+	case analysis.SeverityWarning:
+		return 2
+	default:
+		return 4
+	}
+}
+
+// bindingAt は pos にある識別子と、それが指している束縛を返す。束縛がなければ(組み込み関数とか) binding は nil
+func (d *document) bindingAt(pos Position) (*ast.Identifier, *analysis.Binding) {
+	if d.info == nil {
+		return nil, nil
+	}
+
+	ident := d.info.IdentifierAt(d.fromLSP(pos))
+	if ident == nil {
+		return nil, nil
+	}
+
+	return ident, d.info.Uses[ident]
+}
+
+func (d *document) location(ident *ast.Identifier) Location {
+	return Location{URI: d.uri, Range: d.identRange(ident)}
+}
+
+// references は束縛を指している識別子の場所を、ファイルの前から順に返す
+func (d *document) references(binding *analysis.Binding, includeDeclaration bool) []Location {
+	idents := append([]*ast.Identifier{}, binding.References...)
+	if includeDeclaration {
+		idents = append(idents, binding.Name)
+	}
+
+	sort.Slice(idents, func(i, j int) bool {
+		a, b := idents[i].Token.Pos, idents[j].Token.Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	locations := make([]Location, len(idents))
+	for i, ident := range idents {
+		locations[i] = d.location(ident)
+	}
+
+	return locations
+}
+
+// hover は束縛の定義を Markdown のコードブロックにする
+func hoverText(binding *analysis.Binding) string {
+	switch decl := binding.Decl.(type) {
+	case *ast.LetStatement:
+		source := format.Program(&ast.Program{Statements: []ast.Statement{decl}})
+		return "```monkey\n" + strings.TrimSuffix(source, "\n") + "\n```"
+
+	case *ast.FunctionLiteral:
+		return "```monkey\n(parameter) " + binding.Name.Value + "\n```\nparameter of `" + signature("fn", decl.Parameters) + "`"
+
+	case *ast.MacroLiteral:
+		return "```monkey\n(parameter) " + binding.Name.Value + "\n```\nparameter of `" + signature("macro", decl.Parameters) + "`"
+	}
+
+	return "```monkey\n" + binding.Name.Value + "\n```"
+}
+
+func signature(keyword string, parameters []*ast.Identifier) string {
+	names := make([]string, len(parameters))
+	for i, param := range parameters {
+		names[i] = param.Value
+	}
+
+	return keyword + "(" + strings.Join(names, ", ") + ")"
+}
+
+// symbols は let を DocumentSymbol にする。関数やマクロの中の let は子供にする
+func (d *document) symbols(statements []ast.Statement) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+
+	for _, stmt := range statements {
+		letStmt, ok := stmt.(*ast.LetStatement)
+		if !ok || letStmt.Name == nil {
+			continue
+		}
+
+		// 終わりの位置は AST に残っていないので、let から名前の終わりまでを範囲にする
+		nameRange := d.identRange(letStmt.Name)
+		symbol := DocumentSymbol{
+			Name:           letStmt.Name.Value,
+			Kind:           symbolKindVariable,
+			Range:          Range{Start: d.toLSP(letStmt.Token.Pos), End: nameRange.End},
+			SelectionRange: nameRange,
+		}
+
+		switch value := letStmt.Value.(type) {
+		case *ast.FunctionLiteral:
+			symbol.Kind = symbolKindFunction
+			symbol.Detail = signature("fn", value.Parameters)
+			if value.Body != nil {
+				symbol.Children = d.symbols(value.Body.Statements)
+			}
+		case *ast.MacroLiteral:
+			symbol.Kind = symbolKindFunction
+			symbol.Detail = signature("macro", value.Parameters)
+			if value.Body != nil {
+				symbol.Children = d.symbols(value.Body.Statements)
+			}
+		}
+
+		symbols = append(symbols, symbol)
+	}
+
+	return symbols
+}
@@ -0,0 +1,295 @@
+// Package lsp は Monkey の Language Server。`gomonkey lsp` で stdin/stdout を使って動く。
+// 診断(パースエラーと lint)、定義へジャンプ、参照の検索、ホバー、シンボル一覧、整形ができる。
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gomonkey/analysis"
+	"gomonkey/format"
+	"io"
+	"strings"
+)
+
+// ErrExitWithoutShutdown は shutdown をもらう前に exit が来た(か接続が切れた)ときのエラー。
+// 仕様ではこのときの終了コードは 1。
+var ErrExitWithoutShutdown = errors.New("lsp: exit without shutdown")
+
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+
+	initialized bool
+	shutdown    bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*document),
+	}
+}
+
+// Serve はメッセージを読んで返事をするのを、exit が来るまで繰り返す。
+// shutdown してから exit したら nil、そうでなければ ErrExitWithoutShutdown を返す。
+func (s *Server) Serve() error {
+	for {
+		msg, err := ReadMessage(s.in)
+		if err == io.EOF {
+			if s.shutdown {
+				return nil
+			}
+			return ErrExitWithoutShutdown
+		}
+
+		var rpcErr *ResponseError
+		if errors.As(err, &rpcErr) {
+			// JSON が壊れていたら id もわからないので、id: null で返す
+			if err := s.reply(json.RawMessage("null"), nil, rpcErr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return nil
+			}
+			return ErrExitWithoutShutdown
+		}
+
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *Message) error {
+	if msg.IsNotification() {
+		return s.handleNotification(msg)
+	}
+
+	if !s.initialized && msg.Method != "initialize" {
+		return s.reply(msg.ID, nil, &ResponseError{Code: codeServerNotInitialized, Message: "server not initialized"})
+	}
+
+	result, rpcErr := s.handleRequest(msg)
+
+	return s.reply(msg.ID, result, rpcErr)
+}
+
+func (s *Server) handleRequest(msg *Message) (any, *ResponseError) {
+	switch msg.Method {
+	case "initialize":
+		s.initialized = true
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:           textDocumentSyncFull,
+				DefinitionProvider:         true,
+				ReferencesProvider:         true,
+				HoverProvider:              true,
+				DocumentSymbolProvider:     true,
+				DocumentFormattingProvider: true,
+			},
+			ServerInfo: ServerInfo{Name: "gomonkey"},
+		}, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(params), nil
+
+	case "textDocument/references":
+		var params ReferenceParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.references(params), nil
+
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params), nil
+
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		doc, ok := s.documents[params.TextDocument.URI]
+		if !ok {
+			return []DocumentSymbol{}, nil
+		}
+		return doc.symbols(doc.program.Statements), nil
+
+	case "textDocument/formatting":
+		var params DocumentFormattingParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.formatting(params), nil
+
+	default:
+		return nil, &ResponseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+	}
+}
+
+func (s *Server) handleNotification(msg *Message) error {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if decodeParams(msg, &params) != nil {
+			return nil // 通知には返事ができないので、おかしなものは無視する
+		}
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if decodeParams(msg, &params) != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		// Full 同期なので最後の変更が全文
+		return s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if decodeParams(msg, &params) != nil {
+			return nil
+		}
+		delete(s.documents, params.TextDocument.URI)
+		// 閉じたファイルの波線は消しておく
+		return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+	}
+
+	// initialized とか $/cancelRequest とか、知らない通知は無視していい
+	return nil
+}
+
+func (s *Server) update(uri, text string) error {
+	doc := newDocument(uri, text)
+	s.documents[uri] = doc
+
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: doc.diagnostics()})
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) *Location {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+
+	_, binding := doc.bindingAt(params.Position)
+	if binding == nil {
+		return nil
+	}
+
+	location := doc.location(binding.Name)
+	return &location
+}
+
+func (s *Server) references(params ReferenceParams) []Location {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return []Location{}
+	}
+
+	_, binding := doc.bindingAt(params.Position)
+	if binding == nil {
+		return []Location{}
+	}
+
+	return doc.references(binding, params.Context.IncludeDeclaration)
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) *Hover {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+
+	ident, binding := doc.bindingAt(params.Position)
+	if ident == nil {
+		return nil
+	}
+
+	var text string
+	switch {
+	case binding != nil:
+		text = hoverText(binding)
+	case analysis.IsBuiltin(ident.Value):
+		text = "```monkey\n(builtin) " + ident.Value + "\n```"
+	default:
+		return nil
+	}
+
+	r := doc.identRange(ident)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: &r}
+}
+
+func (s *Server) formatting(params DocumentFormattingParams) []TextEdit {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return []TextEdit{}
+	}
+
+	config := format.Config{}
+	if params.Options.InsertSpaces && params.Options.TabSize > 0 {
+		config.Indent = strings.Repeat(" ", params.Options.TabSize)
+	}
+
+	// パースエラーがあるときは整形しない(消しちゃうと困るので)
+	formatted, err := config.Source(doc.text)
+	if err != nil || formatted == doc.text {
+		return []TextEdit{}
+	}
+
+	return []TextEdit{{
+		Range:   Range{Start: Position{}, End: doc.endPosition()},
+		NewText: formatted,
+	}}
+}
+
+func decodeParams(msg *Message, v any) *ResponseError {
+	if err := json.Unmarshal(msg.Params, v); err != nil {
+		return &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+
+	return nil
+}
+
+func (s *Server) reply(id json.RawMessage, result any, rpcErr *ResponseError) error {
+	resp := response{JSONRPC: "2.0", ID: id}
+
+	if rpcErr != nil {
+		resp.Error = rpcErr
+		return WriteMessage(s.out, resp)
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	rawMessage := json.RawMessage(raw)
+	resp.Result = &rawMessage
+
+	return WriteMessage(s.out, resp)
+}
+
+func (s *Server) notify(method string, params any) error {
+	return WriteMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
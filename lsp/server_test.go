@@ -0,0 +1,333 @@
+package lsp_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"gomonkey/lsp"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// client はテスト用の JSON-RPC クライアント。エディタの代わりに Server としゃべる
+type client struct {
+	t             *testing.T
+	w             io.Writer
+	r             *bufio.Reader
+	nextID        int
+	notifications []*lsp.Message
+}
+
+func startServer(t *testing.T) (*client, chan error) {
+	t.Helper()
+
+	clientToServer, serverIn := io.Pipe()
+	serverOut, serverToClient := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		err := lsp.NewServer(clientToServer, serverToClient).Serve()
+		_ = serverToClient.Close()
+		done <- err
+	}()
+
+	t.Cleanup(func() {
+		_ = serverIn.Close()
+		_ = serverOut.Close()
+	})
+
+	return &client{t: t, w: serverIn, r: bufio.NewReader(serverOut)}, done
+}
+
+// request は返事が来るまで待つ。途中で来た通知は notifications にためておく
+func (c *client) request(method string, params any) *lsp.Message {
+	c.t.Helper()
+
+	c.nextID++
+	id := c.nextID
+	if err := lsp.WriteMessage(c.w, map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		c.t.Fatalf("送れないよ: %s", err)
+	}
+
+	for {
+		msg := c.read()
+		if msg.IsNotification() {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if string(msg.ID) != jsonString(c.t, id) {
+			c.t.Fatalf("id が %d じゃないよ。got=%s", id, msg.ID)
+		}
+		return msg
+	}
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+
+	if err := lsp.WriteMessage(c.w, map[string]any{"jsonrpc": "2.0", "method": method, "params": params}); err != nil {
+		c.t.Fatalf("送れないよ: %s", err)
+	}
+}
+
+// diagnostics は次の publishDiagnostics を待つ
+func (c *client) diagnostics() lsp.PublishDiagnosticsParams {
+	c.t.Helper()
+
+	msg := c.read()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("publishDiagnostics が来てほしいけど %q が来た", msg.Method)
+	}
+
+	var params lsp.PublishDiagnosticsParams
+	decode(c.t, msg.Params, &params)
+
+	return params
+}
+
+func (c *client) read() *lsp.Message {
+	c.t.Helper()
+
+	msg, err := lsp.ReadMessage(c.r)
+	if err != nil {
+		c.t.Fatalf("読めないよ: %s", err)
+	}
+
+	return msg
+}
+
+func jsonString(t *testing.T, v any) string {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func decode(t *testing.T, raw json.RawMessage, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		t.Fatalf("デコードできないよ: %s (%s)", err, raw)
+	}
+}
+
+const uri = "file:///test.mk"
+
+// 4行目の "🐵" は UTF-16 だと2文字分なので、その後ろの文字位置はバイト数とずれる
+const source = "let add = fn(a, b) {\n  let unused = a;\n  a + b + c;\n};\nlet s = \"🐵\"; add(s, 1);\n"
+
+func pos(line, character int) lsp.Position {
+	return lsp.Position{Line: line, Character: character}
+}
+
+func rng(line, start, end int) lsp.Range {
+	return lsp.Range{Start: pos(line, start), End: pos(line, end)}
+}
+
+func textDocumentPosition(p lsp.Position) lsp.TextDocumentPositionParams {
+	return lsp.TextDocumentPositionParams{TextDocument: lsp.TextDocumentIdentifier{URI: uri}, Position: p}
+}
+
+func TestServer(t *testing.T) {
+	c, done := startServer(t)
+
+	// initialize の前のリクエストはエラー
+	if resp := c.request("textDocument/hover", textDocumentPosition(pos(0, 0))); resp.Error == nil || resp.Error.Code != -32002 {
+		t.Errorf("initialize 前なのにエラーにならないよ。got=%+v", resp)
+	}
+
+	var initResult lsp.InitializeResult
+	decode(t, c.request("initialize", map[string]any{"capabilities": map[string]any{}}).Result, &initResult)
+	if !initResult.Capabilities.DefinitionProvider || initResult.Capabilities.TextDocumentSync != 1 {
+		t.Errorf("capabilities がおかしいよ。got=%+v", initResult.Capabilities)
+	}
+	c.notify("initialized", map[string]any{})
+
+	c.notify("textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, LanguageID: "monkey", Version: 1, Text: source},
+	})
+
+	t.Run("diagnostics", func(t *testing.T) {
+		expected := []lsp.Diagnostic{
+			{Range: rng(1, 6, 12), Severity: 4, Source: "gomonkey", Message: "unused declared but not used"},
+			{Range: rng(2, 10, 11), Severity: 2, Source: "gomonkey", Message: "undefined: c"},
+		}
+		if got := c.diagnostics(); got.URI != uri || !reflect.DeepEqual(got.Diagnostics, expected) {
+			t.Errorf("diagnostics がおかしいよ。got=%+v", got)
+		}
+	})
+
+	t.Run("definition", func(t *testing.T) {
+		tests := []struct {
+			position lsp.Position
+			expected string
+		}{
+			{pos(4, 15), jsonString(t, lsp.Location{URI: uri, Range: rng(0, 4, 7)})},
+			// 🐵 の後ろの s。バイトだと 21 文字目だけど UTF-16 だと 18
+			{pos(4, 18), jsonString(t, lsp.Location{URI: uri, Range: rng(4, 4, 5)})},
+			{pos(2, 2), jsonString(t, lsp.Location{URI: uri, Range: rng(0, 13, 14)})},
+			// 定義がないところは null
+			{pos(2, 10), "null"},
+			{pos(3, 0), "null"},
+		}
+
+		for _, tt := range tests {
+			resp := c.request("textDocument/definition", textDocumentPosition(tt.position))
+			if string(resp.Result) != tt.expected {
+				t.Errorf("%+v: %s じゃないよ。got=%s", tt.position, tt.expected, resp.Result)
+			}
+		}
+	})
+
+	t.Run("references", func(t *testing.T) {
+		var locations []lsp.Location
+		decode(t, c.request("textDocument/references", lsp.ReferenceParams{
+			TextDocumentPositionParams: textDocumentPosition(pos(1, 15)),
+			Context:                    lsp.ReferenceContext{IncludeDeclaration: true},
+		}).Result, &locations)
+
+		expected := []lsp.Location{
+			{URI: uri, Range: rng(0, 13, 14)},
+			{URI: uri, Range: rng(1, 15, 16)},
+			{URI: uri, Range: rng(2, 2, 3)},
+		}
+		if !reflect.DeepEqual(locations, expected) {
+			t.Errorf("references がおかしいよ。got=%+v", locations)
+		}
+
+		decode(t, c.request("textDocument/references", lsp.ReferenceParams{
+			TextDocumentPositionParams: textDocumentPosition(pos(0, 5)),
+		}).Result, &locations)
+
+		if expected := []lsp.Location{{URI: uri, Range: rng(4, 14, 17)}}; !reflect.DeepEqual(locations, expected) {
+			t.Errorf("includeDeclaration なしの references がおかしいよ。got=%+v", locations)
+		}
+	})
+
+	t.Run("hover", func(t *testing.T) {
+		tests := []struct {
+			position lsp.Position
+			expected string
+		}{
+			{pos(4, 15), "```monkey\nlet add = fn(a, b) {\n\tlet unused = a;\n\ta + b + c;\n};\n```"},
+			{pos(2, 6), "```monkey\n(parameter) b\n```\nparameter of `fn(a, b)`"},
+		}
+
+		for _, tt := range tests {
+			var hover lsp.Hover
+			decode(t, c.request("textDocument/hover", textDocumentPosition(tt.position)).Result, &hover)
+			if hover.Contents.Value != tt.expected {
+				t.Errorf("%+v: %q じゃないよ。got=%q", tt.position, tt.expected, hover.Contents.Value)
+			}
+		}
+
+		if resp := c.request("textDocument/hover", textDocumentPosition(pos(3, 0))); string(resp.Result) != "null" {
+			t.Errorf("何もないところのホバーは null のはず。got=%s", resp.Result)
+		}
+	})
+
+	t.Run("documentSymbol", func(t *testing.T) {
+		var symbols []lsp.DocumentSymbol
+		decode(t, c.request("textDocument/documentSymbol", lsp.DocumentSymbolParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		}).Result, &symbols)
+
+		expected := []lsp.DocumentSymbol{
+			{Name: "add", Detail: "fn(a, b)", Kind: 12, Range: rng(0, 0, 7), SelectionRange: rng(0, 4, 7), Children: []lsp.DocumentSymbol{
+				{Name: "unused", Kind: 13, Range: rng(1, 2, 12), SelectionRange: rng(1, 6, 12)},
+			}},
+			{Name: "s", Kind: 13, Range: rng(4, 0, 5), SelectionRange: rng(4, 4, 5)},
+		}
+		if !reflect.DeepEqual(symbols, expected) {
+			t.Errorf("symbols がおかしいよ。got=%+v", symbols)
+		}
+	})
+
+	t.Run("formatting", func(t *testing.T) {
+		var edits []lsp.TextEdit
+		decode(t, c.request("textDocument/formatting", lsp.DocumentFormattingParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+			Options:      lsp.FormattingOptions{TabSize: 2, InsertSpaces: true},
+		}).Result, &edits)
+
+		expected := []lsp.TextEdit{{
+			Range:   rng(5, 0, 0),
+			NewText: "let add = fn(a, b) {\n  let unused = a;\n  a + b + c;\n};\nlet s = \"🐵\";\nadd(s, 1);\n",
+		}}
+		expected[0].Range.Start = pos(0, 0)
+		if !reflect.DeepEqual(edits, expected) {
+			t.Errorf("formatting がおかしいよ。got=%+v", edits)
+		}
+	})
+
+	t.Run("didChange", func(t *testing.T) {
+		c.notify("textDocument/didChange", lsp.DidChangeTextDocumentParams{
+			TextDocument:   lsp.TextDocumentIdentifier{URI: uri},
+			ContentChanges: []lsp.TextDocumentContentChangeEvent{{Text: "let x = 1;\nlet = 2;"}},
+		})
+
+		got := c.diagnostics()
+		expected := []lsp.Diagnostic{
+			{Range: rng(1, 4, 5), Severity: 1, Source: "gomonkey", Message: "😢 次のトークンは IDENT になってほしいけど、 = が来ちゃってる！"},
+			// パーサーは let を諦めたあと = から読み直すので、もう1個出る
+			{Range: rng(1, 4, 5), Severity: 1, Source: "gomonkey", Message: "👺 = に対する前置演算のパースの関数がないよ！ マジで！"},
+		}
+		if !reflect.DeepEqual(got.Diagnostics, expected) {
+			t.Errorf("パースエラーの diagnostics がおかしいよ。got=%+v", got.Diagnostics)
+		}
+
+		// パースできないうちは整形しない
+		resp := c.request("textDocument/formatting", lsp.DocumentFormattingParams{TextDocument: lsp.TextDocumentIdentifier{URI: uri}})
+		if string(resp.Result) != "[]" {
+			t.Errorf("パースエラーがあるのに整形しちゃった。got=%s", resp.Result)
+		}
+
+		// それでも定義へのジャンプはできるところはできる
+		c.notify("textDocument/didChange", lsp.DidChangeTextDocumentParams{
+			TextDocument:   lsp.TextDocumentIdentifier{URI: uri},
+			ContentChanges: []lsp.TextDocumentContentChangeEvent{{Text: "let x = 1;\nx + ;"}},
+		})
+		if got := c.diagnostics(); len(got.Diagnostics) != 1 {
+			t.Errorf("パースエラーは1個のはず。got=%+v", got.Diagnostics)
+		}
+		resp = c.request("textDocument/definition", textDocumentPosition(pos(1, 0)))
+		if expected := jsonString(t, lsp.Location{URI: uri, Range: rng(0, 4, 5)}); string(resp.Result) != expected {
+			t.Errorf("%s じゃないよ。got=%s", expected, resp.Result)
+		}
+	})
+
+	t.Run("didClose", func(t *testing.T) {
+		c.notify("textDocument/didClose", lsp.DidCloseTextDocumentParams{TextDocument: lsp.TextDocumentIdentifier{URI: uri}})
+		if got := c.diagnostics(); len(got.Diagnostics) != 0 {
+			t.Errorf("閉じたら diagnostics は空のはず。got=%+v", got.Diagnostics)
+		}
+	})
+
+	if resp := c.request("workspace/symbol", map[string]any{}); resp.Error == nil || resp.Error.Code != -32601 {
+		t.Errorf("知らないメソッドなのに -32601 にならないよ。got=%+v", resp)
+	}
+
+	if resp := c.request("shutdown", nil); string(resp.Result) != "null" || resp.Error != nil {
+		t.Errorf("shutdown の返事がおかしいよ。got=%+v", resp)
+	}
+	c.notify("exit", nil)
+
+	if err := <-done; err != nil {
+		t.Errorf("shutdown してから exit したのにエラー: %s", err)
+	}
+}
+
+func TestServerExitWithoutShutdown(t *testing.T) {
+	c, done := startServer(t)
+
+	c.request("initialize", map[string]any{})
+	c.notify("exit", nil)
+
+	if err := <-done; err != lsp.ErrExitWithoutShutdown {
+		t.Errorf("ErrExitWithoutShutdown になってほしいけど %v", err)
+	}
+}
@@ -2,12 +2,18 @@ package main
 
 import (
 	"fmt"
+	"gomonkey/cli"
 	"gomonkey/repl"
 	"os"
 	"os/user"
 )
 
 func main() {
+	// `gomonkey expand file.mk` みたいにサブコマンドが付いていたらそっちへ
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	me, err := user.Current()
 	if err != nil {
 		panic(err)
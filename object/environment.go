@@ -1,8 +1,19 @@
 package object
 
+import "sort"
+
+// BuiltinLookup は組み込み関数を名前で引けるもの。evaluator.Registry がこれを実装している。
+// object パッケージから evaluator は import できないので、インターフェースにしておく。
+type BuiltinLookup interface {
+	Lookup(name string) (*Builtin, bool)
+}
+
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store    map[string]Object
+	outer    *Environment
+	builtins BuiltinLookup
+	io       *IO
+	hooks    EvalHooks
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
@@ -19,6 +30,16 @@ func NewEnvironment() *Environment {
 	return &Environment{store: s}
 }
 
+// NewEnvironmentWithBuiltins は、使える組み込み関数を builtins に限定した環境を作る。
+// NewEnvironment() で作った環境だと、evaluator の標準の組み込み関数が全部使える。
+func NewEnvironmentWithBuiltins(builtins BuiltinLookup) *Environment {
+	env := NewEnvironment()
+
+	env.builtins = builtins
+
+	return env
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 
@@ -36,3 +57,62 @@ func (e *Environment) Set(name string, val Object) Object {
 
 	return val
 }
+
+// Builtins は外側の環境まで遡って、組み込み関数の引き先を返す。どこにも設定されていなければ nil。
+func (e *Environment) Builtins() BuiltinLookup {
+	for env := e; env != nil; env = env.outer {
+		if env.builtins != nil {
+			return env.builtins
+		}
+	}
+
+	return nil
+}
+
+// SetIO はこの環境(と、この環境を外側に持つ環境)で使う入出力を設定する
+func (e *Environment) SetIO(io *IO) {
+	e.io = io
+}
+
+// IO は外側の環境まで遡って、入出力を返す。どこにも設定されていなければプロセスの標準入出力。
+func (e *Environment) IO() *IO {
+	for env := e; env != nil; env = env.outer {
+		if env.io != nil {
+			return env.io
+		}
+	}
+
+	return StandardIO()
+}
+
+// SetHooks はこの環境(と、この環境を外側に持つ環境)での評価で呼ぶフックを設定する。nil なら外す。
+func (e *Environment) SetHooks(hooks EvalHooks) {
+	e.hooks = hooks
+}
+
+// Hooks は外側の環境まで遡って、評価のフックを返す。どこにも設定されていなければ nil。
+func (e *Environment) Hooks() EvalHooks {
+	for env := e; env != nil; env = env.outer {
+		if env.hooks != nil {
+			return env.hooks
+		}
+	}
+
+	return nil
+}
+
+// Outer は外側の環境。一番外なら nil
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Names はこの環境に直接登録されている名前を並べて返す(外側の環境のものは入れない)
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
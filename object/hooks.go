@@ -0,0 +1,62 @@
+package object
+
+import "gomonkey/ast"
+
+// EvalHooks は評価の途中で呼ばれるフック。デバッガとかプロファイラが評価をのぞき見るのに使う。
+// Environment.SetHooks で設定すると、その環境(と、その環境を外側に持つ環境)での評価で呼ばれる。
+type EvalHooks interface {
+	// BeforeEval と AfterEval は、ノードを1個評価する前と後に呼ばれる。env はそのノードを評価する環境
+	BeforeEval(node ast.Node, env *Environment)
+	AfterEval(node ast.Node, env *Environment, result Object)
+
+	// EnterFunction と ExitFunction は、関数(組み込み関数も)を呼ぶ直前と、返ってきた直後に呼ばれる。
+	// 引数はもう評価し終わっている。
+	EnterFunction(call *ast.CallExpression, fn Object, args []Object)
+	ExitFunction(call *ast.CallExpression, fn Object, result Object)
+}
+
+// JoinHooks は hooks を全部、渡した順に呼ぶ EvalHooks を作る。nil は飛ばす。
+// テストランナーの記録とカバレッジみたいに、フックを2つ以上同時に使いたいときに
+func JoinHooks(hooks ...EvalHooks) EvalHooks {
+	var joined multiHooks
+	for _, h := range hooks {
+		if h != nil {
+			joined = append(joined, h)
+		}
+	}
+
+	switch len(joined) {
+	case 0:
+		return nil
+	case 1:
+		return joined[0]
+	}
+
+	return joined
+}
+
+type multiHooks []EvalHooks
+
+func (m multiHooks) BeforeEval(node ast.Node, env *Environment) {
+	for _, h := range m {
+		h.BeforeEval(node, env)
+	}
+}
+
+func (m multiHooks) AfterEval(node ast.Node, env *Environment, result Object) {
+	for _, h := range m {
+		h.AfterEval(node, env, result)
+	}
+}
+
+func (m multiHooks) EnterFunction(call *ast.CallExpression, fn Object, args []Object) {
+	for _, h := range m {
+		h.EnterFunction(call, fn, args)
+	}
+}
+
+func (m multiHooks) ExitFunction(call *ast.CallExpression, fn Object, result Object) {
+	for _, h := range m {
+		h.ExitFunction(call, fn, result)
+	}
+}
@@ -0,0 +1,46 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// IO は評価中のプログラムがつながっている入出力。puts や read_line はここを使う。
+// 環境に持たせておけば、REPL のテストや組み込み先のアプリが出力を横取りできる。
+type IO struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	// Stdin は bufio.Reader にしておく。REPL が行を読むのと read_line が同じバッファを使わないと、
+	// 先読みした分を片方が食べちゃうので。
+	Stdin *bufio.Reader
+}
+
+// NewIO は IO を作る。nil を渡したところは、読んでもすぐ EOF・書いても捨てるだけになる。
+func NewIO(stdin io.Reader, stdout, stderr io.Writer) *IO {
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	reader, ok := stdin.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(stdin)
+	}
+
+	return &IO{Stdout: stdout, Stderr: stderr, Stdin: reader}
+}
+
+// standardIO はプロセスの標準入出力。環境に IO が設定されていないときに使う。
+var standardIO = NewIO(os.Stdin, os.Stdout, os.Stderr)
+
+// StandardIO はプロセスの標準入出力につながった IO を返す
+func StandardIO() *IO {
+	return standardIO
+}
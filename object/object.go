@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"gomonkey/ast"
 	"hash/fnv"
+	"math/big"
 	"strings"
 )
 
@@ -55,6 +56,21 @@ func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
 
+// BigInteger は int64 に収まらない整数。
+// Monkeyの世界ではただの INTEGER なので、Type() は Integer と同じにしている。
+// int64 に収まる値は必ず Integer のほうで表現する(BigIntegerになるのは溢れたときだけ)ルールです。
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Type() Type {
+	return IntegerObj
+}
+
+func (bi *BigInteger) Inspect() string {
+	return bi.Value.String()
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -143,8 +159,17 @@ func (s *String) Inspect() string {
 
 type BuiltinFunction func(args ...Object) Object
 
+// IOBuiltinFunction は入出力を使う組み込み関数。呼び出したところの環境の IO が渡ってくる。
+type IOBuiltinFunction func(io *IO, args ...Object) Object
+
+// EnvBuiltinFunction は環境を見る組み込み関数。呼び出したところの環境が渡ってくる(macroexpand がマクロを探すのに使う)。
+type EnvBuiltinFunction func(env *Environment, args ...Object) Object
+
+// Builtin は Fn か IOFn か EnvFn のどれか1個を持つ
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn    BuiltinFunction
+	IOFn  IOBuiltinFunction
+	EnvFn EnvBuiltinFunction
 }
 
 func (b *Builtin) Type() Type {
@@ -202,6 +227,15 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (bi *BigInteger) HashKey() HashKey {
+	// int64に収まらない値しか来ないので、Integerと同じ値になることはない。
+	// 文字列表現をハッシュしちゃう。
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(bi.Value.String()))
+
+	return HashKey{Type: bi.Type(), Value: h.Sum64()}
+}
+
 func (b *Boolean) HashKey() HashKey {
 	var v uint64
 	if b.Value {
@@ -2,6 +2,7 @@ package object_test
 
 import (
 	"gomonkey/object"
+	"math/big"
 	"testing"
 )
 
@@ -41,6 +42,25 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("違う値なのに、ハッシュ値が一緒になっているのはおかしいぞ！")
 	}
 }
+func TestBigIntegerHashKey(t *testing.T) {
+	newBig := func(s string) *object.BigInteger {
+		v, _ := new(big.Int).SetString(s, 10)
+		return &object.BigInteger{Value: v}
+	}
+
+	big1 := newBig("100000000000000000000")
+	big2 := newBig("100000000000000000000")
+
+	diff1 := newBig("200000000000000000000")
+
+	if big1.HashKey() != big2.HashKey() {
+		t.Errorf("同じ値なのに、ハッシュ値が異なるぞ！？")
+	}
+
+	if big1.HashKey() == diff1.HashKey() {
+		t.Errorf("違う値なのに、ハッシュ値が一緒になっているのはおかしいぞ！")
+	}
+}
 func TestBooleanHashKey(t *testing.T) {
 	true1 := &object.Boolean{Value: true}
 	true2 := &object.Boolean{Value: true}
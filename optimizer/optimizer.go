@@ -0,0 +1,416 @@
+// Package optimizer は評価する前の AST を、結果が変わらない範囲で軽くする。
+// 関数の本体は呼ぶたびに評価し直すので、`1 + 2 * 3` や `!true` みたいな定数だけの式を毎回計算しなくていいように先に計算しておく。
+//
+//   - 定数畳み込み: リテラルだけの前置演算式・中置演算式(算術、比較、文字列の連結)を計算した結果のリテラルにする
+//   - 死んだ枝の削除: `if (true)` / `if (false)` みたいに条件が定数の if を、通る方の枝だけにする
+//   - 定数の展開: `let x = 5;` のあとで x を使っているところを 5 にする(束縛し直されないとわかる場合だけ)
+//
+// マクロを展開したあと、評価する前に通す。quote() の中は実行時に AST として見えるので触らない。
+package optimizer
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+	"gomonkey/token"
+)
+
+// Optimize は program を書き換えて返す(program 自体も書き換わる)。
+// 定数を展開するとまた畳み込めるところが出てくるので、畳み込み → 展開 → 畳み込みの順に通す。
+func Optimize(program *ast.Program) (*ast.Program, error) {
+	o := &optimizer{
+		quoted: quotedNodes(program),
+		env:    object.NewEnvironment(),
+	}
+
+	if err := o.simplify(program); err != nil {
+		return nil, err
+	}
+	if err := o.inline(program); err != nil {
+		return nil, err
+	}
+	if err := o.simplify(program); err != nil {
+		return nil, err
+	}
+
+	return program, nil
+}
+
+type optimizer struct {
+	quoted map[ast.Node]bool   // quote() とマクロの中のノード。書き換えない
+	env    *object.Environment // 畳み込みで評価するときの環境。リテラルしか評価しないので空っぽでいい
+}
+
+// simplify は畳み込みと死んだ枝の削除をする。帰りがけ順なので、子ノードが先に畳み込まれている
+func (o *optimizer) simplify(program *ast.Program) error {
+	_, err := ast.Modify(program, func(node ast.Node) ast.Node {
+		if o.quoted[node] {
+			return node
+		}
+
+		switch n := node.(type) {
+		case *ast.PrefixExpression:
+			if isConstant(n.Right) {
+				return o.fold(n, n.Token.Pos)
+			}
+
+		case *ast.InfixExpression:
+			if isConstant(n.Left) && isConstant(n.Right) {
+				return o.fold(n, constantPos(n.Left))
+			}
+
+		case *ast.IfExpression:
+			return simplifyIf(n)
+
+		case *ast.Program:
+			n.Statements = simplifyStatements(n.Statements)
+
+		case *ast.BlockStatement:
+			n.Statements = simplifyStatements(n.Statements)
+		}
+
+		return node
+	})
+
+	return err
+}
+
+// fold は定数だけの式を、evaluator で評価した結果のリテラルにする。
+// 評価器そのものを使うので、オーバーフローで大きい整数になるとかの細かいところも実行したときと同じになる。
+// 0 で割るとかでエラーになる式は、実行したときにエラーになってほしいので畳み込まない。
+func (o *optimizer) fold(node ast.Expression, pos token.Position) ast.Node {
+	lit := literal(evaluator.Eval(node, o.env), pos)
+	if lit == nil {
+		return node
+	}
+
+	return lit
+}
+
+// simplifyIf は条件が定数の if を、通る方の枝だけにする。
+// 通る枝がないなら null、式が1個だけのブロックならその式にする。
+// 文が何個もあるブロックは式の形にできないので、条件を true にした if に残しておく(文のところにあれば simplifyStatements で展開される)。
+func simplifyIf(n *ast.IfExpression) ast.Node {
+	taken, ok := branch(n)
+	if !ok {
+		return n
+	}
+
+	if taken == nil {
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null", Pos: n.Token.Pos}}
+	}
+
+	if len(taken.Statements) == 1 {
+		if stmt, ok := taken.Statements[0].(*ast.ExpressionStatement); ok && stmt.Expression != nil {
+			return stmt.Expression
+		}
+	}
+
+	n.Condition = &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Pos: constantPos(n.Condition)}, Value: true}
+	n.Consequence = taken
+	n.Alternative = nil
+
+	return n
+}
+
+// branch は if の条件が定数なら、通る方のブロックを返す。else がなくてどこも通らないなら nil。
+// 条件が定数じゃなければ ok が false
+func branch(n *ast.IfExpression) (taken *ast.BlockStatement, ok bool) {
+	var truthy bool
+	switch c := n.Condition.(type) {
+	case *ast.Boolean:
+		truthy = c.Value
+	case *ast.NullLiteral:
+		truthy = false
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		// null と false 以外は truthy
+		truthy = true
+	default:
+		return nil, false
+	}
+
+	if truthy {
+		return n.Consequence, true
+	}
+
+	return n.Alternative, true
+}
+
+// simplifyStatements は文の並びの中で、
+//   - 条件が定数の if の文を、通る方のブロックの中身に置き換える(ブロックはスコープを作らないので、展開しても同じ)
+//   - 最後じゃない、定数だけの式文を消す(値は次の文で上書きされるし、副作用もない)
+//
+// 最後の文はブロックの値になるので、値が変わらないように残す。
+func simplifyStatements(statements []ast.Statement) []ast.Statement {
+	simplified := make([]ast.Statement, 0, len(statements))
+
+	for i, stmt := range statements {
+		last := i == len(statements)-1
+
+		es, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			simplified = append(simplified, stmt)
+			continue
+		}
+
+		if ifExp, ok := es.Expression.(*ast.IfExpression); ok {
+			if taken, ok := branch(ifExp); ok && taken != nil && (len(taken.Statements) > 0 || !last) {
+				simplified = append(simplified, taken.Statements...)
+				continue
+			}
+		}
+
+		if !last && isConstant(es.Expression) {
+			continue
+		}
+
+		simplified = append(simplified, stmt)
+	}
+
+	return simplified
+}
+
+// inline は、スコープ(プログラムのトップレベルか関数の本体)の中で1回しか let されない、値が定数の名前を、
+// その let より後ろの文の中で定数に置き換える。
+// 関数の引数と同じ名前や、同じスコープで何回も let される名前は、どの値を指すのか実行するまでわからないので置き換えない。
+// let 自体は、前に作ったクロージャが実行時に参照するかもしれないので残す。
+func (o *optimizer) inline(program *ast.Program) error {
+	replacements := map[*ast.Identifier]ast.Expression{}
+
+	scopes := []scope{{root: program}}
+	for len(scopes) > 0 {
+		s := scopes[0]
+		scopes = scopes[1:]
+
+		lists, lets, inner := s.collect()
+		scopes = append(scopes, inner...)
+
+		for _, list := range lists {
+			for i, stmt := range list {
+				let, ok := stmt.(*ast.LetStatement)
+				if !ok || let.Name == nil || !isConstant(let.Value) {
+					continue
+				}
+				name := let.Name.Value
+				if lets[name] != 1 || s.isParameter(name) {
+					continue
+				}
+
+				for _, later := range list[i+1:] {
+					for _, ident := range uses(later, name) {
+						replacements[ident] = let.Value
+					}
+				}
+			}
+		}
+	}
+
+	if len(replacements) == 0 {
+		return nil
+	}
+
+	_, err := ast.Modify(program, func(node ast.Node) ast.Node {
+		ident, ok := node.(*ast.Identifier)
+		if !ok {
+			return node
+		}
+		if value, ok := replacements[ident]; ok {
+			return constantAt(value, ident.Token.Pos)
+		}
+
+		return node
+	})
+
+	return err
+}
+
+// scope は let が束縛される環境1個分。root はプログラムか、関数の本体
+type scope struct {
+	root       ast.Node
+	parameters []*ast.Identifier
+}
+
+func (s scope) isParameter(name string) bool {
+	for _, param := range s.parameters {
+		if param.Value == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collect はスコープの中(内側の関数は除く)の文の並びと、名前ごとの let の回数と、内側の関数のスコープを集める。
+// if のブロックは新しい環境を作らないので、同じスコープに入る。
+func (s scope) collect() (lists [][]ast.Statement, lets map[string]int, inner []scope) {
+	lets = map[string]int{}
+
+	ast.Inspect(s.root, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.Program:
+			lists = append(lists, n.Statements)
+		case *ast.BlockStatement:
+			lists = append(lists, n.Statements)
+		case *ast.LetStatement:
+			if n.Name != nil {
+				lets[n.Name.Value]++
+			}
+		case *ast.FunctionLiteral:
+			if n.Body != nil {
+				inner = append(inner, scope{root: n.Body, parameters: n.Parameters})
+			}
+			return false
+		case *ast.QuoteExpression, *ast.MacroLiteral:
+			return false
+		}
+
+		return true
+	})
+
+	return lists, lets, inner
+}
+
+// uses は node の中で name を参照している識別子を集める。
+// 内側の関数が同じ名前を引数か let で持っていたら、その関数の中は別の値を指すかもしれないので見ない
+func uses(node ast.Node, name string) []*ast.Identifier {
+	var idents []*ast.Identifier
+
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.Identifier:
+			if n.Value == name {
+				idents = append(idents, n)
+			}
+		case *ast.FunctionLiteral:
+			return !shadows(n, name)
+		case *ast.QuoteExpression, *ast.MacroLiteral:
+			return false
+		}
+
+		return true
+	})
+
+	return idents
+}
+
+// shadows は fn の中で name が引数か let で束縛されるかどうか。もっと内側の関数の let も数える(安全側に倒す)
+func shadows(fn *ast.FunctionLiteral, name string) bool {
+	for _, param := range fn.Parameters {
+		if param.Value == name {
+			return true
+		}
+	}
+
+	found := false
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		if let, ok := node.(*ast.LetStatement); ok && let.Name != nil && let.Name.Value == name {
+			found = true
+		}
+
+		return !found
+	})
+
+	return found
+}
+
+// quotedNodes は quote() とマクロの中のノードを集める。quote() の中は評価されずに AST のまま値になるので、書き換えると結果が変わる
+func quotedNodes(program *ast.Program) map[ast.Node]bool {
+	quoted := map[ast.Node]bool{}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.QuoteExpression:
+			ast.Inspect(n.Expression, func(node ast.Node) bool {
+				if node != nil {
+					quoted[node] = true
+				}
+				return true
+			})
+			return false
+		case *ast.MacroLiteral:
+			ast.Inspect(n, func(node ast.Node) bool {
+				if node != nil {
+					quoted[node] = true
+				}
+				return true
+			})
+			return false
+		}
+
+		return true
+	})
+
+	return quoted
+}
+
+// isConstant は評価しなくても値がわかる式かどうか
+func isConstant(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean, *ast.NullLiteral:
+		return true
+	}
+
+	return false
+}
+
+// constantPos は定数の位置
+func constantPos(expr ast.Expression) token.Position {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		return e.Token.Pos
+	case *ast.StringLiteral:
+		return e.Token.Pos
+	case *ast.Boolean:
+		return e.Token.Pos
+	case *ast.NullLiteral:
+		return e.Token.Pos
+	}
+
+	return token.Position{}
+}
+
+// constantAt は定数をコピーして、位置を pos にしたもの。同じノードを木のあちこちに置かないようにコピーする
+func constantAt(expr ast.Expression, pos token.Position) ast.Expression {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		c := *e
+		c.Token.Pos = pos
+		return &c
+	case *ast.StringLiteral:
+		c := *e
+		c.Token.Pos = pos
+		return &c
+	case *ast.Boolean:
+		c := *e
+		c.Token.Pos = pos
+		return &c
+	case *ast.NullLiteral:
+		c := *e
+		c.Token.Pos = pos
+		return &c
+	}
+
+	return expr
+}
+
+// literal は評価した結果をリテラルのノードに戻す。リテラルにできない値(エラーとか)なら nil
+func literal(obj object.Object, pos token.Position) ast.Expression {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value), Pos: pos}, Value: obj.Value}
+	case *object.BigInteger:
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: obj.Value.String(), Pos: pos}, BigValue: obj.Value}
+	case *object.Boolean:
+		if obj.Value {
+			return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Pos: pos}, Value: true}
+		}
+		return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false", Pos: pos}, Value: false}
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: obj.Value, Pos: pos}, Value: obj.Value}
+	case *object.Null:
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null", Pos: pos}}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package optimizer_test
+
+import (
+	"gomonkey/ast"
+	"gomonkey/evaluator"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/optimizer"
+	"gomonkey/parser"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("パースエラーだよ: %v", p.Errors())
+	}
+
+	return program
+}
+
+func optimize(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	program, err := optimizer.Optimize(parse(t, input))
+	if err != nil {
+		t.Fatalf("Optimize がエラーを返したよ: %s", err)
+	}
+
+	return program
+}
+
+func eval(program *ast.Program) object.Object {
+	env := object.NewEnclosedEnvironment(object.NewEnvironmentWithBuiltins(evaluator.DefaultRegistry()))
+	return evaluator.Eval(program, env)
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 定数畳み込み
+		{"1 + 2 * 3", "7"},
+		{"!true", "false"},
+		{"-(5 - 10)", "5"},
+		{`"foo" + "bar"`, "foobar"},
+		{"1 < 2 == true", "true"},
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"fn(x) { x + 2 * 3 }", "fn(x) { (x + 6) }"},
+		// 0 で割るのは実行したときにエラーになってほしいので、そのまま
+		{"1 / 0", "(1 / 0)"},
+		// 変数が入っていたら畳み込めない
+		{"x + 1 + 2", "((x + 1) + 2)"},
+
+		// 死んだ枝の削除
+		{"if (true) { 1 } else { 2 }", "1"},
+		{"if (1 > 2) { 1 } else { 2 }", "2"},
+		{"if (false) { 1 }", "null"},
+		{`if ("") { 1 }`, "1"},
+		{"let f = fn() { if (true) { puts(1); 2 } }", "let f = fn() { puts(1)2 };"},
+		{"if (false) { 1 }; x", "x"},
+		{"let y = if (true) { puts(1); 2 };", "let y = iftrue puts(1)2;"},
+
+		// 定数の展開
+		{"let x = 5; x * 2", "let x = 5;10"},
+		{"let s = \"a\"; fn() { s + \"b\" }", "let s = a;fn() { ab }"},
+		{"let x = 2; if (x > 1) { x } else { 0 }", "let x = 2;2"},
+		// 引数や、中の let で同じ名前を使っている関数の中は置き換えない
+		{"let x = 5; fn(x) { x }", "let x = 5;fn(x) { x }"},
+		{"let x = 5; fn() { let x = 1; x }", "let x = 5;fn() { let x = 1;1 }"},
+		// 何回も let される名前は置き換えない
+		{"let x = 5; let x = 6; x", "let x = 5;let x = 6;x"},
+		{"let x = 5; if (y) { let x = 6; }; x", "let x = 5;ify let x = 6;x"},
+		// let より前は置き換えない
+		{"x; let x = 5;", "xlet x = 5;"},
+		// quote の中は AST のまま値になるので触らない
+		{"let x = 1; quote(x + 1 + 2)", "let x = 1;quote(((x + 1) + 2))"},
+	}
+
+	for _, tt := range tests {
+		got := optimize(t, tt.input).String()
+		if got != tt.expected {
+			t.Errorf("%q を最適化したら %q になってほしいけど、そうじゃないよ。got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// 最適化しても、しなくても、評価した結果は同じ
+func TestOptimizePreservesSemantics(t *testing.T) {
+	tests := []string{
+		"1 + 2 * 3 - 4 / 2",
+		"!!true == !false",
+		`"a" + "b" == "ab"`,
+		"9223372036854775807 * 3 - 1",
+		"-(-9223372036854775807 - 1)",
+		"7 % 3",
+		"1 / 0",
+		`"a" - "b"`,
+		"let x = 1 / 0; x",
+		"if (false) { 1 }",
+		"if (null) { 1 } else { 2 }",
+		"if (0) { 1 } else { 2 }",
+		"if (true) { }",
+		"let f = fn() { if (true) { let a = 1; a + 1 } }; f()",
+		"let f = fn() { if (false) { return 1; }; 2 }; f()",
+		"let f = fn() { if (true) { return 1; }; 2 }; f()",
+		"let f = fn(n) { let k = 10; n * k + 2 * 3 }; f(4)",
+		"let x = 5; let f = fn(x) { x * 2 }; f(1) + x",
+		"let x = 5; let f = fn() { let x = 1; x }; f() + x",
+		"let f = fn() { x }; let x = 5; f()",
+		"let x = 5; let f = fn() { fn() { x + 1 } }; f()()",
+		"let x = 5; let y = if (x > 3) { x * 2 } else { 0 }; y",
+		"let a = [1 + 1, 2 * 2]; a[3 - 2]",
+		`let h = {"a" + "b": 1 + 2}; h["ab"]`,
+		"let q = 1; quote(q + 1 + 2)",
+		"let x = 1; if (true) { let x = 2; }; x",
+		"let n = 3; let loop = fn(i) { if (i < n) { loop(i + 1) } else { i } }; loop(0)",
+	}
+
+	for _, input := range tests {
+		want := eval(parse(t, input))
+		got := eval(optimize(t, input))
+
+		if got.Inspect() != want.Inspect() || got.Type() != want.Type() {
+			t.Errorf("%q の結果が最適化で変わっちゃったよ。want=%s (%s), got=%s (%s)", input, want.Inspect(), want.Type(), got.Inspect(), got.Type())
+		}
+	}
+}
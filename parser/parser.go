@@ -5,6 +5,7 @@ import (
 	"gomonkey/ast"
 	"gomonkey/lexer"
 	"gomonkey/token"
+	"math/big"
 	"strconv"
 )
 
@@ -32,6 +33,7 @@ var precedences = map[token.Type]int{
 
 	token.ASTERISK: PRODUCT,
 	token.SLASH:    PRODUCT,
+	token.PERCENT:  PRODUCT,
 
 	token.LPAREN: CALL,
 
@@ -59,9 +61,20 @@ type (
 	infixParseFn  func(ast.Expression) ast.Expression
 )
 
+// Error はパースエラー1個。Pos はエラーに気づいたトークンの位置。
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e Error) String() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []Error
+	tracer *tracer // WithTrace のときだけ
 
 	curToken  token.Token
 	peekToken token.Token
@@ -78,10 +91,13 @@ func (p *Parser) registerInfix(tokenType token.Type, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
-func New(l *lexer.Lexer) *Parser {
+func New(l *lexer.Lexer, options ...Option) *Parser {
 	p := Parser{
 		l:      l,
-		errors: []string{},
+		errors: []Error{},
+	}
+	for _, option := range options {
+		option(&p)
 	}
 
 	p.nextToken()
@@ -119,6 +135,18 @@ func New(l *lexer.Lexer) *Parser {
 	// A.5.2 マクロリテラル
 	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 
+	// quote と unquote は関数呼び出しじゃなくて専用の構文
+	p.registerPrefix(token.QUOTE, p.parseQuoteExpression)
+	p.registerPrefix(token.UNQUOTE, p.parseUnquoteExpression)
+	p.registerPrefix(token.UNQUOTE_SPLICING, p.parseUnquoteExpression)
+
+	// `(...)、~x、~@xs は quote(...)、unquote(x)、unquote_splicing(xs) の略記
+	p.registerPrefix(token.BACKQUOTE, p.parseQuasiQuote)
+	p.registerPrefix(token.TILDE, p.parseQuasiQuote)
+	p.registerPrefix(token.TILDE_AT, p.parseQuasiQuote)
+
+	p.registerPrefix(token.NULL, p.parseNullLiteral)
+
 	p.infixParseFns = make(map[token.Type]infixParseFn)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
@@ -128,6 +156,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 
 	// 2.8.5 関数の呼び出し式
 	// `(` を 中置演算式におけるOperatorだと思うってこと！
@@ -141,14 +170,29 @@ func New(l *lexer.Lexer) *Parser {
 	return &p
 }
 
+// Errors はエラーメッセージだけを返す。位置も欲しいときは ErrorDetails を使う。
 func (p *Parser) Errors() []string {
+	messages := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		messages[i] = err.Message
+	}
+
+	return messages
+}
+
+// ErrorDetails は位置つきのエラーを返す。エディタで波線を引くときとかに使う。
+func (p *Parser) ErrorDetails() []Error {
 	return p.errors
 }
 
+func (p *Parser) addError(pos token.Position, msg string) {
+	p.errors = append(p.errors, Error{Pos: pos, Message: msg})
+}
+
 func (p *Parser) peekError(t token.Type) {
 	msg := fmt.Sprintf("😢 次のトークンは %s になってほしいけど、 %s が来ちゃってる！", t, p.peekToken.Type)
 
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken.Pos, msg)
 }
 
 func (p *Parser) nextToken() {
@@ -175,14 +219,30 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 func (p *Parser) parseStatement() ast.Statement {
 
+	// *ast.LetStatement の nil をそのまま ast.Statement で返すと「nil じゃない interface」になっちゃって、
+	// ParseProgram の stmt != nil をすり抜けてしまう。なので nil はちゃんと nil で返す
+	var stmt ast.Statement
+	if p.tracer != nil {
+		p.trace("%s %s", statementParserName(p.curToken.Type), p.curToken.Pos)
+		defer func() { p.untrace(stmt) }()
+	}
+
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		if letStmt := p.parseLetStatement(); letStmt != nil {
+			stmt = letStmt
+		}
 	case token.RETURN:
-		return p.parseReturnStatement()
+		if returnStmt := p.parseReturnStatement(); returnStmt != nil {
+			stmt = returnStmt
+		}
 	default:
-		return p.parseExpressionStatement()
+		if exprStmt := p.parseExpressionStatement(); exprStmt != nil {
+			stmt = exprStmt
+		}
 	}
+
+	return stmt
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
@@ -250,7 +310,6 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	//defer untrace(trace("parseExpressionStatement()"))
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -262,8 +321,11 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	return stmt
 }
 
-func (p *Parser) parseExpression(curPrecedence int) ast.Expression {
-	//defer untrace(trace(fmt.Sprintf("parseExression() precedence=%d", curPrecedence)))
+func (p *Parser) parseExpression(curPrecedence int) (leftExp ast.Expression) {
+	if p.tracer != nil {
+		p.trace("parseExpression %s, cur %s", precedenceName(curPrecedence), tokenString(p.curToken))
+		defer func() { p.untrace(leftExp) }()
+	}
 
 	// myArray[1 + 2]
 	//   ↑
@@ -272,11 +334,13 @@ func (p *Parser) parseExpression(curPrecedence int) ast.Expression {
 	prefixFn := p.prefixParseFns[p.curToken.Type]
 
 	if prefixFn == nil {
+		p.tracef("no prefix parse function for %s", tokenString(p.curToken))
 		p.noPrefixParseFnError(p.curToken.Type)
 		return nil
 	}
 
-	leftExp := prefixFn() // *ast.Identifier{myArray}
+	p.tracePrefix()
+	leftExp = prefixFn() // *ast.Identifier{myArray}
 
 	// 条件1: 次がセミコロンだったら、 `3;`みたいなやつだったってこと！
 	// 条件2: この条件に当てはまる
@@ -288,14 +352,17 @@ func (p *Parser) parseExpression(curPrecedence int) ast.Expression {
 		// myArray[1 + 2]
 		//    ↑
 		if infixFn == nil {
+			p.traceStop(curPrecedence)
 			return leftExp
 		}
 
+		p.traceInfix(curPrecedence)
 		p.nextToken()
 		// myArray[1 + 2]
 		//        ↑
 		leftExp = infixFn(leftExp)
 	}
+	p.traceStop(curPrecedence)
 
 	return leftExp
 }
@@ -308,29 +375,34 @@ func (p *Parser) parseIdentifier() ast.Expression {
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	//defer untrace(trace("parseIntegerLiteral()"))
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
-	if err != nil {
-		msg := fmt.Sprintf("Could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+	if err == nil {
+		lit.Value = value
+		return lit
 	}
 
-	lit.Value = value
+	// int64 に収まらないだけなら多倍長整数にしちゃう
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		if bigValue, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			lit.BigValue = bigValue
+			return lit
+		}
+	}
 
-	return lit
+	msg := fmt.Sprintf("Could not parse %q as integer", p.curToken.Literal)
+	p.addError(p.curToken.Pos, msg)
+	return nil
 }
 
 func (p *Parser) noPrefixParseFnError(t token.Type) {
 	//msg := fmt.Sprintf("no prefix parse function for %s found", t)
 	msg := fmt.Sprintf("👺 %s に対する前置演算のパースの関数がないよ！ マジで！", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken.Pos, msg)
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	//defer untrace(trace("parsePrefixExpression()"))
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
@@ -338,13 +410,16 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 	p.nextToken()
 
+	if p.tracer != nil {
+		p.trace("parsePrefixExpression %q, right side with PREFIX", expression.Operator)
+		defer p.untrace(expression)
+	}
 	expression.Right = p.parseExpression(PREFIX) // ここまじで意味わからん
 
 	return expression
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	//defer untrace(trace(fmt.Sprintf("parseInfixExpression() left=%[1]T %[1]q", left)))
 	// `3 + 4`
 	infixExpr := &ast.InfixExpression{
 		Token:    p.curToken,
@@ -356,6 +431,11 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 
 	p.nextToken()
 
+	// 右側は自分の優先順位でパースするので、同じ優先順位の演算子が続いたら左結合になる
+	if p.tracer != nil {
+		p.trace("parseInfixExpression %q, left %s, right side with %s", infixExpr.Operator, nodeString(left), precedenceName(curPrecedence))
+		defer p.untrace(infixExpr)
+	}
 	infixExpr.Right = p.parseExpression(curPrecedence)
 
 	return infixExpr
@@ -370,11 +450,15 @@ func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return boolean
 }
 
-func (p *Parser) parseGroupedExpression() ast.Expression {
+func (p *Parser) parseGroupedExpression() (grouped ast.Expression) {
 	// カッコがあるASTノードなんてものは、不要！ そんなのいらない！
 	// 単純にこれでいい！
 	// 	- カッコを剥がした式でパースする ← 閉じカッコは優先順位が最低値だから、どのみちカッコ内の演算子が優先されるので心配いらない
 	// 	- 閉じカッコがちゃんとあるかを確かめる
+	if p.tracer != nil {
+		p.trace("parseGroupedExpression, inside with LOWEST")
+		defer func() { p.untrace(grouped) }()
+	}
 	p.nextToken()
 
 	expr := p.parseExpression(LOWEST)
@@ -527,6 +611,10 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 		Token:    p.curToken,
 		Function: function,
 	}
+	if p.tracer != nil {
+		p.trace("parseCallExpression, function %s, arguments with LOWEST", nodeString(function))
+		defer p.untrace(callExpr)
+	}
 
 	callExpr.Arguments = p.parseExpressionList(token.RPAREN)
 
@@ -577,19 +665,34 @@ func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 
 }
 
-func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+func (p *Parser) parseIndexExpression(left ast.Expression) (indexed ast.Expression) {
 	// myArray[1 + 2]
 	//        ↑
-	indexExpr := &ast.IndexExpression{
-		Token: p.curToken,
-		Left:  left,
+	lbracket := p.curToken
+	if p.tracer != nil {
+		p.trace("parseIndexExpression, left %s, index with LOWEST", nodeString(left))
+		defer func() { p.untrace(indexed) }()
+	}
+
+	// myArray[:2] ← 開始位置が省略されたスライス
+	//         ↑
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(lbracket, left, nil)
 	}
 
 	p.nextToken()
 
 	// myArray[1 + 2]
 	//         ↑
-	indexExpr.Index = p.parseExpression(LOWEST)
+	index := p.parseExpression(LOWEST)
+
+	// myArray[1:2] ← `:` が来たらスライス式になる
+	//          ↑
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(lbracket, left, index)
+	}
 
 	// myArray[1 + 2]
 	//             ↑
@@ -597,7 +700,36 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 		return nil
 	}
 
-	return indexExpr
+	return &ast.IndexExpression{
+		Token: lbracket,
+		Left:  left,
+		Index: index,
+	}
+}
+
+func (p *Parser) parseSliceExpression(lbracket token.Token, left, start ast.Expression) ast.Expression {
+	// myArray[1:2]
+	//          ↑
+	sliceExpr := &ast.SliceExpression{
+		Token: lbracket,
+		Left:  left,
+		Start: start,
+	}
+
+	// myArray[1:] ← 終了位置が省略されたスライス
+	//          ↑
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		sliceExpr.End = p.parseExpression(LOWEST)
+	}
+
+	// myArray[1:2]
+	//            ↑
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return sliceExpr
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
@@ -686,3 +818,89 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 
 	return macroLit
 }
+
+func (p *Parser) parseQuoteExpression() ast.Expression {
+	// quote(<expression>)
+	quoteExpr := &ast.QuoteExpression{Token: p.curToken}
+
+	quoteExpr.Expression = p.parseSpecialFormArgument()
+	if quoteExpr.Expression == nil {
+		return nil
+	}
+
+	return quoteExpr
+}
+
+func (p *Parser) parseUnquoteExpression() ast.Expression {
+	// unquote(<expression>) と unquote_splicing(<expression>)
+	unquoteExpr := &ast.UnquoteExpression{Token: p.curToken}
+
+	unquoteExpr.Expression = p.parseSpecialFormArgument()
+	if unquoteExpr.Expression == nil {
+		return nil
+	}
+
+	return unquoteExpr
+}
+
+// parseSpecialFormArgument は quote(...) とかの括弧の中の式を1つだけ読む。
+// 関数呼び出しと同じ見た目なので引数リストとして読んでから、数が1つかどうかをチェックする。
+func (p *Parser) parseSpecialFormArgument() ast.Expression {
+	name := p.curToken.Literal
+	pos := p.curToken.Pos
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	errorCount := len(p.errors)
+	args := p.parseExpressionList(token.RPAREN)
+	if len(p.errors) > errorCount {
+		return nil
+	}
+
+	if len(args) != 1 {
+		msg := fmt.Sprintf("argument error: wrong number of arguments to %s (given %d, expected 1)", name, len(args))
+		p.addError(pos, msg)
+		return nil
+	}
+
+	return args[0]
+}
+
+// parseQuasiQuote は `(...)、~x、~@xs を読んで、quote(...) とかと同じノードにする。
+// トークンも quote とかに置き換えるので、String() も評価も quote(...) と書いたときと全く同じになる。位置だけ記号のところ。
+func (p *Parser) parseQuasiQuote() ast.Expression {
+	sigil := p.curToken
+
+	p.nextToken()
+
+	// Lisp と同じで、記号はすぐ後ろの1つにだけくっつく。
+	// ~a + ~b は unquote(a) + unquote(b)、~f(~@xs) は unquote(f)(unquote_splicing(xs))。まとめたいときは ~(a + b)
+	expr := p.parseExpression(INDEX)
+	if expr == nil {
+		return nil
+	}
+
+	switch sigil.Type {
+	case token.BACKQUOTE:
+		return &ast.QuoteExpression{
+			Token:      token.Token{Type: token.QUOTE, Literal: "quote", Pos: sigil.Pos},
+			Expression: expr,
+		}
+	case token.TILDE_AT:
+		return &ast.UnquoteExpression{
+			Token:      token.Token{Type: token.UNQUOTE_SPLICING, Literal: "unquote_splicing", Pos: sigil.Pos},
+			Expression: expr,
+		}
+	default:
+		return &ast.UnquoteExpression{
+			Token:      token.Token{Type: token.UNQUOTE, Literal: "unquote", Pos: sigil.Pos},
+			Expression: expr,
+		}
+	}
+}
+
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
@@ -5,6 +5,7 @@ import (
 	"gomonkey/ast"
 	"gomonkey/lexer"
 	"gomonkey/parser"
+	"gomonkey/token"
 	"testing"
 )
 
@@ -182,6 +183,38 @@ func TestIntegerLiteralExpression(t *testing.T) {
 
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	// int64 の最大値は 9223372036854775807 なので、それより1大きい
+	input := `9223372036854775808;`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] が *ast.ExpressionStatementじゃないよ.got=%T", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp が *ast.IntegerLiteral じゃないよ。got=%T", stmt.Expression)
+	}
+
+	if literal.BigValue == nil {
+		t.Fatalf("literal.BigValue が nil だよ")
+	}
+
+	if literal.BigValue.String() != "9223372036854775808" {
+		t.Errorf("literal.BigValue が %s じゃないよ。got=%s", "9223372036854775808", literal.BigValue.String())
+	}
+
+	if literal.String() != "9223372036854775808" {
+		t.Errorf("literal.String() が %s じゃないよ。got=%s", "9223372036854775808", literal.String())
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input         string
@@ -329,6 +362,8 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"a + b - c", "((a + b) - c)"},
 		{"a * b * c", "((a * b) * c)"},
 		{"a * b / c", "((a * b) / c)"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a * b % c", "((a * b) % c)"},
 		{"3 + 4; -5 * 5", "(3 + 4)((-5) * 5)"},
 		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
 		{"5 < 4 != 3 > 4", "((5 < 4) != (3 > 4))"},
@@ -849,6 +884,72 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"myArray[1:2]", "(myArray[1:2])"},
+		{"myArray[:2]", "(myArray[:2])"},
+		{"myArray[1:]", "(myArray[1:])"},
+		{"myArray[:]", "(myArray[:])"},
+		{"myArray[-2:-1]", "(myArray[(-2):(-1)])"},
+		{"myArray[1 + 1:len(myArray)]", "(myArray[(1 + 1):len(myArray)])"},
+
+		// スライスした結果にも添字できる
+		{"myArray[1:][0]", "((myArray[1:])[0])"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			program := p.ParseProgram()
+			checkParseErrors(t, p)
+
+			exprStmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+			if !ok {
+				t.Fatalf("*ast.ExpressionStatementじゃないよ。got=%T", program.Statements[0])
+			}
+
+			if exprStmt.String() != tt.expected {
+				t.Errorf("want=%q, got=%q", tt.expected, exprStmt.String())
+			}
+		})
+	}
+}
+
+func TestParsingSliceExpressionFields(t *testing.T) {
+	input := "myArray[1:]"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	exprStmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("*ast.ExpressionStatementじゃないよ。got=%T", program.Statements[0])
+	}
+
+	sliceExpr, ok := exprStmt.Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("*ast.SliceExpressionになってないよ！ got=%T", exprStmt.Expression)
+	}
+
+	if !testIdentifier(t, sliceExpr.Left, "myArray") {
+		return
+	}
+
+	if !testIntegerLiteral(t, sliceExpr.Start, 1) {
+		return
+	}
+
+	if sliceExpr.End != nil {
+		t.Errorf("省略したのに End が nil じゃないよ。got=%T", sliceExpr.End)
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -1006,3 +1107,210 @@ func TestMacroLiteralParsing(t *testing.T) {
 
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
+
+func TestQuoteUnquoteParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1 + 2)`, `quote((1 + 2))`},
+		{`quote(unquote(a) * 2)`, `quote((unquote(a) * 2))`},
+		{`quote(f(unquote_splicing(xs)))`, `quote(f(unquote_splicing(xs)))`},
+		{`quote(null)`, `quote(null)`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			program := p.ParseProgram()
+			checkParseErrors(t, p)
+
+			exprStmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+			if !ok {
+				t.Fatalf("*ast.ExpressionStatement じゃないよ。got=%T", program.Statements[0])
+			}
+
+			if _, ok := exprStmt.Expression.(*ast.QuoteExpression); !ok {
+				t.Fatalf("*ast.QuoteExpression じゃないよ。got=%T", exprStmt.Expression)
+			}
+
+			if program.String() != tt.expected {
+				t.Errorf("want=%q, got=%q", tt.expected, program.String())
+			}
+		})
+	}
+}
+
+func TestUnquoteSplicingParsing(t *testing.T) {
+	l := lexer.New(`unquote_splicing(xs)`)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	exprStmt := program.Statements[0].(*ast.ExpressionStatement)
+
+	unquote, ok := exprStmt.Expression.(*ast.UnquoteExpression)
+	if !ok {
+		t.Fatalf("*ast.UnquoteExpression じゃないよ。got=%T", exprStmt.Expression)
+	}
+
+	if !unquote.Splicing() {
+		t.Errorf("unquote_splicing なのに Splicing() が false だよ")
+	}
+
+	testIdentifier(t, unquote.Expression, "xs")
+}
+
+func TestQuoteUnquoteParsingErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote()`, "argument error: wrong number of arguments to quote (given 0, expected 1)"},
+		{`quote(1, 2)`, "argument error: wrong number of arguments to quote (given 2, expected 1)"},
+		{`quote(unquote(a, b))`, "argument error: wrong number of arguments to unquote (given 2, expected 1)"},
+		{`unquote_splicing()`, "argument error: wrong number of arguments to unquote_splicing (given 0, expected 1)"},
+		// quote はキーワードなので上書きできない
+		{`let quote = fn(x) { x };`, "😢 次のトークンは IDENT になってほしいけど、 QUOTE が来ちゃってる！"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			p.ParseProgram()
+
+			if len(p.Errors()) == 0 {
+				t.Fatalf("パースエラーにならないとだめだよ")
+			}
+
+			if p.Errors()[0] != tt.expected {
+				t.Errorf("want=%q, got=%q", tt.expected, p.Errors()[0])
+			}
+		})
+	}
+}
+
+func TestQuasiQuoteParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		longForm string
+	}{
+		{"`(1 + 2)", "quote(1 + 2)"},
+		{"`x", "quote(x)"},
+		{"`(~a * 2)", "quote(unquote(a) * 2)"},
+		{"`(~a + ~b)", "quote(unquote(a) + unquote(b))"},
+		{"`(~(a + b) * 2)", "quote(unquote(a + b) * 2)"},
+		{"`(f(1, ~@xs))", "quote(f(1, unquote_splicing(xs)))"},
+		{"`([~@xs, ~y])", "quote([unquote_splicing(xs), unquote(y)])"},
+		{"`(if (!~cond) { ~cons })", "quote(if (!unquote(cond)) { unquote(cons) })"},
+		{"`(`(~~x))", "quote(quote(unquote(unquote(x))))"},
+		{"-~x", "-unquote(x)"},
+		// 記号はすぐ後ろの1つにだけくっつく
+		{"`(~f(~@xs))", "quote(unquote(f)(unquote_splicing(xs)))"},
+		{"`(~xs[0])", "quote(unquote(xs)[0])"},
+		{"`f(x)", "quote(f)(x)"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParseErrors(t, p)
+
+			longP := parser.New(lexer.New(tt.longForm))
+			longProgram := longP.ParseProgram()
+			checkParseErrors(t, longP)
+
+			// 略記でも quote(...) と書いたのと同じ AST になる
+			if program.String() != longProgram.String() {
+				t.Errorf("want=%q, got=%q", longProgram.String(), program.String())
+			}
+		})
+	}
+}
+
+func TestQuasiQuoteParsingNodes(t *testing.T) {
+	p := parser.New(lexer.New("`(~a + ~@b)"))
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	exprStmt := program.Statements[0].(*ast.ExpressionStatement)
+
+	quote, ok := exprStmt.Expression.(*ast.QuoteExpression)
+	if !ok {
+		t.Fatalf("*ast.QuoteExpression じゃないよ。got=%T", exprStmt.Expression)
+	}
+
+	if quote.Token.Type != token.QUOTE || quote.Token.Pos.Column != 1 {
+		t.Errorf("トークンがおかしいよ。got=%+v", quote.Token)
+	}
+
+	infix, ok := quote.Expression.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("*ast.InfixExpression じゃないよ。got=%T", quote.Expression)
+	}
+
+	left, ok := infix.Left.(*ast.UnquoteExpression)
+	if !ok || left.Splicing() {
+		t.Errorf("左は unquote じゃないとだめだよ。got=%T(%s)", infix.Left, infix.Left)
+	}
+
+	right, ok := infix.Right.(*ast.UnquoteExpression)
+	if !ok || !right.Splicing() {
+		t.Errorf("右は unquote_splicing じゃないとだめだよ。got=%T(%s)", infix.Right, infix.Right)
+	}
+
+	// 位置は記号のところ
+	if right.Token.Pos.Column != 8 {
+		t.Errorf("~@ の位置がおかしいよ。got=%s", right.Token.Pos)
+	}
+}
+
+func TestErrorDetails(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x 5;", []string{"1:7: 😢 次のトークンは = になってほしいけど、 INT が来ちゃってる！"}},
+		{"let x = 1;\n  quote(1, 2)", []string{"2:3: argument error: wrong number of arguments to quote (given 2, expected 1)"}},
+		{"1 +\n", []string{"2:1: 👺 EOF に対する前置演算のパースの関数がないよ！ マジで！"}},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		details := p.ErrorDetails()
+		if len(details) != len(tt.expected) {
+			t.Fatalf("%q: エラーは %d 個のはず。got=%v", tt.input, len(tt.expected), details)
+		}
+		for i, detail := range details {
+			if detail.String() != tt.expected[i] {
+				t.Errorf("%q: %q じゃないよ。got=%q", tt.input, tt.expected[i], detail.String())
+			}
+			// Errors() のほうはメッセージだけ
+			if p.Errors()[i] != detail.Message {
+				t.Errorf("%q: Errors() と ErrorDetails() のメッセージが違うよ", tt.input)
+			}
+		}
+	}
+}
+
+func TestParseErrorDoesNotLeaveNilStatements(t *testing.T) {
+	// 失敗した let/return の *ast.XxxStatement(nil) が Statements に紛れ込むと、Walk とかで panic しちゃう
+	p := parser.New(lexer.New("let = 1; let x = 2; return"))
+	program := p.ParseProgram()
+
+	for i, stmt := range program.Statements {
+		if letStmt, ok := stmt.(*ast.LetStatement); ok && letStmt == nil {
+			t.Errorf("Statements[%d] が nil の *ast.LetStatement だよ", i)
+		}
+	}
+
+	ast.Inspect(program, func(ast.Node) bool { return true })
+}
@@ -2,31 +2,156 @@ package parser
 
 import (
 	"fmt"
+	"gomonkey/ast"
+	"gomonkey/token"
+	"io"
 	"strings"
 )
 
-var traceLevel int = 0
+// Option は New に渡す設定
+type Option func(*Parser)
 
-const traceIdentPlaceholder string = "\t"
+// WithTrace はパース関数の呼び出しを字下げした木にして w に書く。
+// どのトークンでどのパース関数が呼ばれて、優先順位の比べっこで中置演算式に進んだのか止まったのかがわかるので、
+// 優先順位がおかしいときに使う。
+//
+//	parseExpressionStatement 1:1
+//	  parseExpression LOWEST, cur INT "1"
+//	    prefix INT "1"
+//	    peek "+" SUM > LOWEST: infix
+//	    ...
+//	  = (1 + (2 * 3))
+//
+// トレースは Parser ごとなので、別々の Parser なら同時に使っても大丈夫。
+func WithTrace(w io.Writer) Option {
+	return func(p *Parser) {
+		p.tracer = &tracer{w: w}
+	}
+}
+
+// tracer は今どのくらい深く呼ばれているかを覚えておいて、その分字下げして書く
+type tracer struct {
+	w     io.Writer
+	depth int
+}
+
+func (t *tracer) printf(format string, args ...interface{}) {
+	fmt.Fprintf(t.w, "%s%s\n", strings.Repeat("  ", t.depth), fmt.Sprintf(format, args...))
+}
+
+// trace は呼び出しの始まりを書いて、字下げを1段深くする。トレースしてないなら何もしない
+func (p *Parser) trace(format string, args ...interface{}) {
+	if p.tracer == nil {
+		return
+	}
+
+	p.tracer.printf(format, args...)
+	p.tracer.depth++
+}
+
+// untrace は字下げを1段戻して、パースできたものを書く
+func (p *Parser) untrace(node ast.Node) {
+	if p.tracer == nil {
+		return
+	}
+
+	p.tracer.depth--
+	p.tracer.printf("= %s", nodeString(node))
+}
+
+// tracef は今の深さで1行書く
+func (p *Parser) tracef(format string, args ...interface{}) {
+	if p.tracer == nil {
+		return
+	}
+
+	p.tracer.printf(format, args...)
+}
 
-func identLevel() string {
-	return strings.Repeat(traceIdentPlaceholder, traceLevel-1)
+// tracePrefix は parseExpression で、今のトークンの前置演算式のパース関数を呼ぶところ
+func (p *Parser) tracePrefix() {
+	if p.tracer == nil {
+		return
+	}
+
+	p.tracef("prefix %s", tokenString(p.curToken))
+}
+
+// traceInfix は parseExpression のループで、次のトークンを中置演算式としてパースすると決めたところ
+func (p *Parser) traceInfix(curPrecedence int) {
+	if p.tracer == nil {
+		return
+	}
+
+	p.tracef("peek %s %s > %s: infix", tokenString(p.peekToken), precedenceName(p.peekPrecedence()), precedenceName(curPrecedence))
+}
+
+// traceStop は parseExpression のループを抜けたところ。なんで抜けたのかを書く
+func (p *Parser) traceStop(curPrecedence int) {
+	if p.tracer == nil {
+		return
+	}
+
+	switch {
+	case p.peekTokenIs(token.SEMICOLON):
+		p.tracef("peek %s: stop", tokenString(p.peekToken))
+	case p.infixParseFns[p.peekToken.Type] == nil && curPrecedence < p.peekPrecedence():
+		p.tracef("peek %s: no infix parse function, stop", tokenString(p.peekToken))
+	default:
+		p.tracef("peek %s %s <= %s: stop", tokenString(p.peekToken), precedenceName(p.peekPrecedence()), precedenceName(curPrecedence))
+	}
 }
 
-func tracePrint(fs string) {
-	fmt.Printf("%s%s\n", identLevel(), fs)
+func statementParserName(t token.Type) string {
+	switch t {
+	case token.LET:
+		return "parseLetStatement"
+	case token.RETURN:
+		return "parseReturnStatement"
+	default:
+		return "parseExpressionStatement"
+	}
 }
 
-func incIdent() { traceLevel = traceLevel + 1 }
-func decIdent() { traceLevel = traceLevel - 1 }
+// tokenString は `INT "1"` みたいに。`+` みたいに種類とリテラルが同じなら `"+"` だけ
+func tokenString(tok token.Token) string {
+	if string(tok.Type) == tok.Literal {
+		return fmt.Sprintf("%q", tok.Literal)
+	}
 
-func trace(msg string) string {
-	incIdent()
-	tracePrint("BEGIN " + msg)
-	return msg
+	return fmt.Sprintf("%s %q", tok.Type, tok.Literal)
 }
 
-func untrace(msg string) {
-	tracePrint("END " + msg)
-	decIdent()
+var precedenceNames = map[int]string{
+	LOWEST:      "LOWEST",
+	EQUALS:      "EQUALS",
+	LESSGREATER: "LESSGREATER",
+	SUM:         "SUM",
+	PRODUCT:     "PRODUCT",
+	PREFIX:      "PREFIX",
+	CALL:        "CALL",
+	INDEX:       "INDEX",
+}
+
+func precedenceName(precedence int) string {
+	if name, ok := precedenceNames[precedence]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("%d", precedence)
+}
+
+// nodeString はパースに失敗したときも書けるように。失敗すると nil や、子が nil のノードが返ってきて String() が panic するので
+func nodeString(node ast.Node) (s string) {
+	if node == nil {
+		return "<nil>"
+	}
+
+	defer func() {
+		if recover() != nil {
+			s = "<incomplete>"
+		}
+	}()
+
+	return node.String()
 }
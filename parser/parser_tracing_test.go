@@ -0,0 +1,78 @@
+package parser_test
+
+import (
+	"gomonkey/lexer"
+	"gomonkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	var out strings.Builder
+	p := parser.New(lexer.New("1 - 2 * 3;"), parser.WithTrace(&out))
+	p.ParseProgram()
+
+	expected := `parseExpressionStatement 1:1
+  parseExpression LOWEST, cur INT "1"
+    prefix INT "1"
+    peek "-" SUM > LOWEST: infix
+    parseInfixExpression "-", left 1, right side with SUM
+      parseExpression SUM, cur INT "2"
+        prefix INT "2"
+        peek "*" PRODUCT > SUM: infix
+        parseInfixExpression "*", left 2, right side with PRODUCT
+          parseExpression PRODUCT, cur INT "3"
+            prefix INT "3"
+            peek ";": stop
+          = 3
+        = (2 * 3)
+        peek ";": stop
+      = (2 * 3)
+    = (1 - (2 * 3))
+    peek ";": stop
+  = (1 - (2 * 3))
+= (1 - (2 * 3))
+`
+	if out.String() != expected {
+		t.Errorf("トレースがおかしいよ。\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestTraceDecisions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // トレースのどこかにこの行があるはず
+	}{
+		// 同じ優先順位なら止まるので、左結合になる
+		{"a - b - c", `    peek "-" SUM <= SUM: stop`},
+		{"-a * b", `        peek "*" PRODUCT <= PREFIX: stop`},
+		{"f(x)[0]", `    peek "[" INDEX > LOWEST: infix`},
+		{"f(x)[0]", `    parseIndexExpression, left f(x), index with LOWEST`},
+		{"(a + b) * c", `    parseGroupedExpression, inside with LOWEST`},
+		{"1 +", `        no prefix parse function for EOF ""`},
+		{"let x = ;", `    no prefix parse function for ";"`},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		p := parser.New(lexer.New(tt.input), parser.WithTrace(&out))
+		p.ParseProgram()
+
+		if !strings.Contains(out.String(), tt.expected+"\n") {
+			t.Errorf("%q のトレースに %q がないよ。got=\n%s", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestTraceDoesNotChangeProgram(t *testing.T) {
+	input := "let f = fn(x) { if (x > 1) { x * f(x - 1) } else { 1 } }; f([1, 2][0]) + {\"a\": -1}[\"a\"];"
+
+	plain := parser.New(lexer.New(input)).ParseProgram()
+
+	var out strings.Builder
+	traced := parser.New(lexer.New(input), parser.WithTrace(&out)).ParseProgram()
+
+	if plain.String() != traced.String() {
+		t.Errorf("トレースするとパース結果が変わっちゃうよ。\nwant=%s\ngot =%s", plain.String(), traced.String())
+	}
+}
@@ -0,0 +1,225 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// pprof の profile.proto を手で書く(依存を増やしたくないので)。使うフィールドだけ。
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+//
+// 値は [呼び出し回数, その関数そのものにかかった時間(ナノ秒)] の2つ。
+// Location は関数1個につき1個で、行は関数リテラルの行にしてある(どの行で時間がかかったかまでは測っていない)。
+const (
+	profileSampleType        = 1
+	profileSample            = 2
+	profileLocation          = 4
+	profileFunction          = 5
+	profileStringTable       = 6
+	profileTimeNanos         = 9
+	profileDurationNanos     = 10
+	profilePeriodType        = 11
+	profilePeriod            = 12
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// WritePprof は gzip した profile.proto を書き出す。`go tool pprof -top file` とかで読める
+func (p *Profiler) WritePprof(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(p.encodeProfile()); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+func (p *Profiler) encodeProfile() []byte {
+	table := &stringTable{index: map[string]int64{"": 0}, list: []string{""}}
+	b := &protoBuffer{}
+
+	for _, typ := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}} {
+		typ := typ
+		b.message(profileSampleType, func(b *protoBuffer) {
+			b.int64(valueTypeType, table.add(typ[0]))
+			b.int64(valueTypeUnit, table.add(typ[1]))
+		})
+	}
+
+	// map の順番は毎回変わるので、スタックのキーで並べて出力を安定させる
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := p.samples[key]
+		b.message(profileSample, func(b *protoBuffer) {
+			b.packedUint64s(sampleLocationID, s.locations)
+			b.packedInt64s(sampleValue, []int64{s.calls, int64(s.time)})
+		})
+	}
+
+	for _, fn := range p.functions {
+		fn := fn
+		b.message(profileLocation, func(b *protoBuffer) {
+			b.uint64(locationID, fn.id)
+			b.message(locationLine, func(b *protoBuffer) {
+				b.uint64(lineFunctionID, fn.id)
+				b.int64(lineLine, int64(fn.Pos.Line))
+			})
+		})
+	}
+
+	for _, fn := range p.functions {
+		fn := fn
+		b.message(profileFunction, func(b *protoBuffer) {
+			b.uint64(functionID, fn.id)
+			name := pprofName(fn)
+			b.int64(functionName, table.add(name))
+			b.int64(functionSystemName, table.add(name))
+			if !fn.Builtin {
+				b.int64(functionFilename, table.add(p.path))
+			}
+			b.int64(functionStartLine, int64(fn.Pos.Line))
+		})
+	}
+
+	// 文字列表は最後に書く(ほかのところで add し終わってから)
+	timeType := table.add("time")
+	nanoseconds := table.add("nanoseconds")
+	for _, s := range table.list {
+		b.string(profileStringTable, s)
+	}
+
+	b.int64(profileTimeNanos, p.started.UnixNano())
+	b.int64(profileDurationNanos, int64(p.total))
+	b.message(profilePeriodType, func(b *protoBuffer) {
+		b.int64(valueTypeType, timeType)
+		b.int64(valueTypeUnit, nanoseconds)
+	})
+	b.int64(profilePeriod, 1)
+	b.int64(profileDefaultSampleType, timeType)
+
+	return b.buf
+}
+
+// pprofName は pprof で表示する名前。pprof は C++ のテンプレート引数だと思って <...> を消しちゃうので、
+// "<main>" は "main" に、"<anonymous>" は区別できるように "anonymous@5:21" みたいに位置を付ける
+func pprofName(fn *Function) string {
+	name := strings.Trim(fn.Name, "<>")
+	if fn.Name == "<anonymous>" && fn.Pos.IsValid() {
+		name = fmt.Sprintf("%s@%d:%d", name, fn.Pos.Line, fn.Pos.Column)
+	}
+
+	return name
+}
+
+// stringTable は pprof の文字列表。0番目は空文字列と決まっている
+type stringTable struct {
+	index map[string]int64
+	list  []string
+}
+
+func (t *stringTable) add(s string) int64 {
+	if i, ok := t.index[s]; ok {
+		return i
+	}
+
+	i := int64(len(t.list))
+	t.index[s] = i
+	t.list = append(t.list, s)
+
+	return i
+}
+
+// protoBuffer は protobuf のワイヤーフォーマットを書くだけのもの
+type protoBuffer struct {
+	buf []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.buf = append(b.buf, byte(x)|0x80)
+		x >>= 7
+	}
+	b.buf = append(b.buf, byte(x))
+}
+
+func (b *protoBuffer) key(field, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// uint64 と int64 は 0 なら書かない(proto3 のデフォルト値)
+func (b *protoBuffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+// string は repeated の要素になるので、空文字列でも書く
+func (b *protoBuffer) string(field int, s string) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(s)))
+	b.buf = append(b.buf, s...)
+}
+
+func (b *protoBuffer) packedUint64s(field int, xs []uint64) {
+	sub := &protoBuffer{}
+	for _, x := range xs {
+		sub.varint(x)
+	}
+	b.bytes(field, sub.buf)
+}
+
+func (b *protoBuffer) packedInt64s(field int, xs []int64) {
+	sub := &protoBuffer{}
+	for _, x := range xs {
+		sub.varint(uint64(x))
+	}
+	b.bytes(field, sub.buf)
+}
+
+func (b *protoBuffer) message(field int, f func(*protoBuffer)) {
+	sub := &protoBuffer{}
+	f(sub)
+	b.bytes(field, sub.buf)
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(data)))
+	b.buf = append(b.buf, data...)
+}
@@ -0,0 +1,315 @@
+// Package profiler は Monkey のプログラムのどの関数に時間がかかっているかを測る。
+// 評価のフック(object.EvalHooks)で関数の呼び出しとノードの評価を数えるので、使わないときは何もかからない。
+// 結果はテキストの表(WriteText)か、`go tool pprof` で読める protobuf(WritePprof)で書き出す。
+package profiler
+
+import (
+	"fmt"
+	"gomonkey/ast"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+	"gomonkey/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Function は測った関数1個の結果。同じ関数リテラルから作った関数(クロージャ)はまとめて1個として数える
+type Function struct {
+	Name      string         // let で付けた名前。名前がなければ "<anonymous>"、トップレベルは "<main>"
+	Pos       token.Position // 関数リテラルの位置。組み込み関数とトップレベルは無効な位置
+	Builtin   bool
+	Calls     int
+	Inclusive time.Duration // 中で呼んだ関数の時間も含めた時間(再帰しても二重には数えない)
+	Exclusive time.Duration // この関数そのものにかかった時間
+
+	id     uint64
+	active int // 今スタックに何段積まれているか(再帰の二重カウントよけ)
+}
+
+type frame struct {
+	fn       *Function
+	start    time.Time
+	children time.Duration // 中で呼んだ関数にかかった時間
+	stack    string        // sample のキー
+}
+
+// sample は呼び出しスタック1通りの結果。pprof の Sample になる
+type sample struct {
+	locations []uint64 // 内側の関数から順に Function.id
+	calls     int64
+	time      time.Duration
+}
+
+// Profiler は object.EvalHooks を実装している
+type Profiler struct {
+	// Now は時刻の取り方。テストで差し替えられるように
+	Now func() time.Time
+
+	path      string
+	literals  map[*ast.BlockStatement]*Function // 関数リテラルの本体から引く
+	builtins  map[string]*Function
+	functions []*Function
+	main      *Function
+	frames    []*frame
+	samples   map[string]*sample
+	nodes     map[string]int
+	started   time.Time
+	total     time.Duration
+}
+
+// New は program を測る Profiler を作る。program は評価するもの(マクロ展開済み)を渡す。
+// 関数の名前はここで program の let から拾っておく。path はレポートに出すファイル名。
+func New(path string, program *ast.Program) *Profiler {
+	p := &Profiler{
+		Now:      time.Now,
+		path:     path,
+		literals: make(map[*ast.BlockStatement]*Function),
+		builtins: make(map[string]*Function),
+		samples:  make(map[string]*sample),
+		nodes:    make(map[string]int),
+	}
+	p.main = p.newFunction("<main>", token.Position{}, false)
+
+	ast.Walk(&namer{p: p, names: make(map[*ast.FunctionLiteral]string)}, program)
+
+	return p
+}
+
+// namer は `let name = fn(...) {...}` の name を関数リテラルに付ける
+type namer struct {
+	p     *Profiler
+	names map[*ast.FunctionLiteral]string
+}
+
+func (n *namer) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		if lit, ok := node.Value.(*ast.FunctionLiteral); ok && node.Name != nil {
+			n.names[lit] = node.Name.Value
+		}
+	case *ast.FunctionLiteral:
+		name, ok := n.names[node]
+		if !ok {
+			name = "<anonymous>"
+		}
+		if node.Body != nil {
+			n.p.literals[node.Body] = n.p.newFunction(name, node.Token.Pos, false)
+		}
+	}
+
+	return n
+}
+
+func (p *Profiler) newFunction(name string, pos token.Position, builtin bool) *Function {
+	fn := &Function{Name: name, Pos: pos, Builtin: builtin, id: uint64(len(p.functions) + 1)}
+	p.functions = append(p.functions, fn)
+
+	return fn
+}
+
+// Run は program を env で評価しながら測る。env にもうフック(トレースとか)があれば、それもそのまま呼ぶ
+func (p *Profiler) Run(program *ast.Program, env *object.Environment) object.Object {
+	hooks := env.Hooks()
+	env.SetHooks(object.JoinHooks(hooks, p))
+	defer env.SetHooks(hooks)
+
+	// 全体の時間は <main> の cum と同じにしておく(時計を別に読むとずれるので)
+	p.enter(p.main)
+	p.started = p.frames[0].start
+	result := evaluator.Eval(program, env)
+	p.exit()
+	p.total = p.main.Inclusive
+
+	return result
+}
+
+func (p *Profiler) BeforeEval(node ast.Node, env *object.Environment) {
+	p.nodes[nodeType(node)]++
+}
+
+func (p *Profiler) AfterEval(node ast.Node, env *object.Environment, result object.Object) {}
+
+func (p *Profiler) EnterFunction(call *ast.CallExpression, fn object.Object, args []object.Object) {
+	p.enter(p.function(call, fn))
+}
+
+func (p *Profiler) ExitFunction(call *ast.CallExpression, fn object.Object, result object.Object) {
+	p.exit()
+}
+
+// function は呼ばれた関数の記録を探す。program の外で作られた関数(マクロが作ったものとか)はここで作る
+func (p *Profiler) function(call *ast.CallExpression, fn object.Object) *Function {
+	name := "<anonymous>"
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		name = ident.Value
+	}
+
+	switch fn := fn.(type) {
+	case *object.Function:
+		if f, ok := p.literals[fn.Body]; ok {
+			return f
+		}
+		f := p.newFunction(name, fn.Body.Token.Pos, false)
+		p.literals[fn.Body] = f
+		return f
+
+	case *object.Builtin:
+		if f, ok := p.builtins[name]; ok {
+			return f
+		}
+		f := p.newFunction(name, token.Position{}, true)
+		p.builtins[name] = f
+		return f
+	}
+
+	// 関数じゃないものを呼ぼうとした(エラーになる)ときも、スタックの釣り合いは取っておく
+	return p.newFunction(name, token.Position{}, true)
+}
+
+func (p *Profiler) enter(fn *Function) {
+	stack := strconv.FormatUint(fn.id, 10)
+	if len(p.frames) > 0 {
+		stack = p.frames[len(p.frames)-1].stack + "," + stack
+	}
+
+	fn.Calls++
+	fn.active++
+	p.frames = append(p.frames, &frame{fn: fn, start: p.Now(), stack: stack})
+	p.sample(stack).calls++
+}
+
+func (p *Profiler) exit() {
+	f := p.frames[len(p.frames)-1]
+	p.frames = p.frames[:len(p.frames)-1]
+
+	elapsed := p.Now().Sub(f.start)
+	exclusive := elapsed - f.children
+
+	f.fn.active--
+	if f.fn.active == 0 {
+		f.fn.Inclusive += elapsed
+	}
+	f.fn.Exclusive += exclusive
+	p.sample(f.stack).time += exclusive
+
+	if len(p.frames) > 0 {
+		p.frames[len(p.frames)-1].children += elapsed
+	}
+}
+
+func (p *Profiler) sample(stack string) *sample {
+	if s, ok := p.samples[stack]; ok {
+		return s
+	}
+
+	// キーは外側から順なので、pprof 用に内側から順に並べ直す
+	ids := strings.Split(stack, ",")
+	locations := make([]uint64, len(ids))
+	for i, id := range ids {
+		locations[len(ids)-1-i], _ = strconv.ParseUint(id, 10, 64)
+	}
+
+	s := &sample{locations: locations}
+	p.samples[stack] = s
+
+	return s
+}
+
+// Total は Run にかかった時間
+func (p *Profiler) Total() time.Duration {
+	return p.total
+}
+
+// Functions は呼ばれた関数を、それ自体にかかった時間の長い順に返す(同じなら呼ばれた回数の多い順、名前順)
+func (p *Profiler) Functions() []*Function {
+	var functions []*Function
+	for _, fn := range p.functions {
+		if fn.Calls > 0 {
+			functions = append(functions, fn)
+		}
+	}
+
+	sort.SliceStable(functions, func(i, j int) bool {
+		a, b := functions[i], functions[j]
+		if a.Exclusive != b.Exclusive {
+			return a.Exclusive > b.Exclusive
+		}
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		return a.Name < b.Name
+	})
+
+	return functions
+}
+
+// NodeCount はノードの種類ごとの評価回数
+type NodeCount struct {
+	Type  string // "InfixExpression" みたいに ast の型の名前
+	Count int
+}
+
+// NodeCounts はノードの種類ごとの評価回数を多い順に返す
+func (p *Profiler) NodeCounts() []NodeCount {
+	counts := make([]NodeCount, 0, len(p.nodes))
+	for typ, count := range p.nodes {
+		counts = append(counts, NodeCount{Type: typ, Count: count})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Type < counts[j].Type
+	})
+
+	return counts
+}
+
+// WriteText は関数ごとの表とノードの評価回数を書き出す。flat はその関数そのもの、cum は中で呼んだ関数も含めた時間
+func (p *Profiler) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	// 最後の列(名前)はタブで終わらせないので、右寄せにならずに左から並ぶ
+	fmt.Fprintf(tw, "total time: %s\n\n", p.total)
+	fmt.Fprintf(tw, "calls\tflat\tflat%%\tcum\tcum%%\t  function\n")
+	for _, fn := range p.Functions() {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t  %s\n",
+			fn.Calls, fn.Exclusive, p.percent(fn.Exclusive), fn.Inclusive, p.percent(fn.Inclusive), p.location(fn))
+	}
+
+	fmt.Fprintf(tw, "\nevaluations\t  node\n")
+	for _, count := range p.NodeCounts() {
+		fmt.Fprintf(tw, "%d\t  %s\n", count.Count, count.Type)
+	}
+
+	return tw.Flush()
+}
+
+func (p *Profiler) percent(d time.Duration) string {
+	if p.total <= 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.1f%%", float64(d)*100/float64(p.total))
+}
+
+// location は "fib (fib.mk:1:11)" みたいに、名前と定義した場所
+func (p *Profiler) location(fn *Function) string {
+	switch {
+	case fn.Builtin:
+		return fn.Name + " (builtin)"
+	case fn.Pos.IsValid():
+		return fmt.Sprintf("%s (%s:%d:%d)", fn.Name, p.path, fn.Pos.Line, fn.Pos.Column)
+	default:
+		return fn.Name + " (" + p.path + ")"
+	}
+}
+
+func nodeType(node ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
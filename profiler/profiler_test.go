@@ -0,0 +1,181 @@
+package profiler_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"gomonkey/profiler"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const script = `let fib = fn(n) {
+	if (n < 2) { return n; }
+	fib(n - 1) + fib(n - 2)
+};
+let apply = fn(f, x) { f(x) };
+apply(fn(x) { len(x) }, "abc");
+fib(5);
+`
+
+// fakeClock は呼ばれるたびに1ミリ秒進む時計
+func fakeClock() func() time.Time {
+	now := time.Unix(0, 0)
+	return func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+}
+
+func runProfile(t *testing.T, input string) (*profiler.Profiler, object.Object) {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("パースエラーだよ: %v", p.Errors())
+	}
+
+	prof := profiler.New("script.mk", program)
+	prof.Now = fakeClock()
+
+	return prof, prof.Run(program, object.NewEnvironment())
+}
+
+func TestFunctions(t *testing.T) {
+	prof, result := runProfile(t, script)
+
+	if result.Inspect() != "5" {
+		t.Fatalf("評価の結果が 5 じゃないよ。got=%s", result.Inspect())
+	}
+
+	tests := []struct {
+		name    string
+		line    int
+		builtin bool
+		calls   int
+	}{
+		{"fib", 1, false, 15},
+		{"apply", 5, false, 1},
+		{"<anonymous>", 6, false, 1},
+		{"len", 0, true, 1},
+		{"<main>", 0, false, 1},
+	}
+
+	functions := make(map[string]*profiler.Function)
+	for _, fn := range prof.Functions() {
+		functions[fn.Name] = fn
+	}
+
+	for _, tt := range tests {
+		fn, ok := functions[tt.name]
+		if !ok {
+			t.Errorf("%s が測られてないよ", tt.name)
+			continue
+		}
+
+		if fn.Calls != tt.calls {
+			t.Errorf("%s の呼び出し回数が %d じゃないよ。got=%d", tt.name, tt.calls, fn.Calls)
+		}
+		if fn.Pos.Line != tt.line {
+			t.Errorf("%s の行が %d じゃないよ。got=%d", tt.name, tt.line, fn.Pos.Line)
+		}
+		if fn.Builtin != tt.builtin {
+			t.Errorf("%s の Builtin が %t じゃないよ", tt.name, tt.builtin)
+		}
+		if fn.Exclusive <= 0 || fn.Inclusive < fn.Exclusive {
+			t.Errorf("%s の時間がおかしいよ。flat=%s, cum=%s", tt.name, fn.Exclusive, fn.Inclusive)
+		}
+	}
+
+	// 全部の関数の flat を足すと全体の時間になるし、<main> の cum は全体の時間
+	var sum time.Duration
+	for _, fn := range prof.Functions() {
+		sum += fn.Exclusive
+	}
+	if sum != prof.Total() {
+		t.Errorf("flat の合計 %s が全体の時間 %s と合わないよ", sum, prof.Total())
+	}
+	if functions["<main>"].Inclusive != prof.Total() {
+		t.Errorf("<main> の cum %s が全体の時間 %s と合わないよ", functions["<main>"].Inclusive, prof.Total())
+	}
+
+	// 再帰しても cum は二重に数えない
+	if functions["fib"].Inclusive > prof.Total() {
+		t.Errorf("fib の cum %s が全体の時間 %s より長いよ", functions["fib"].Inclusive, prof.Total())
+	}
+}
+
+func TestNodeCounts(t *testing.T) {
+	prof, _ := runProfile(t, "let x = 1 + 2;\nx * x;")
+
+	expected := map[string]int{
+		"Program":             1,
+		"LetStatement":        1,
+		"ExpressionStatement": 1,
+		"InfixExpression":     2,
+		"IntegerLiteral":      2,
+		"Identifier":          2,
+	}
+
+	counts := prof.NodeCounts()
+	if len(counts) != len(expected) {
+		t.Fatalf("ノードの種類が %d 個じゃないよ。got=%v", len(expected), counts)
+	}
+
+	for i, count := range counts {
+		if expected[count.Type] != count.Count {
+			t.Errorf("%s の評価回数が %d じゃないよ。got=%d", count.Type, expected[count.Type], count.Count)
+		}
+		if i > 0 && counts[i-1].Count < count.Count {
+			t.Errorf("多い順に並んでないよ。got=%v", counts)
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	prof, _ := runProfile(t, script)
+
+	var out strings.Builder
+	if err := prof.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"total time:", "fib (script.mk:1:11)", "len (builtin)", "<main> (script.mk)", "InfixExpression"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("レポートに %q がないよ。got=\n%s", want, out.String())
+		}
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	prof, _ := runProfile(t, script)
+
+	var out bytes.Buffer
+	if err := prof.WritePprof(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("gzip になってないよ: %s", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 文字列表に関数の名前とファイル名が入っている。<...> は pprof が消しちゃうので外してある
+	for _, want := range []string{"fib", "main", "anonymous@6:7", "script.mk", "nanoseconds"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("プロファイルに %q がないよ", want)
+		}
+	}
+	if bytes.Contains(data, []byte("<main>")) {
+		t.Errorf("<main> は main にしてほしいよ")
+	}
+}
@@ -2,12 +2,14 @@ package repl
 
 import (
 	"bufio"
-	"fmt"
+	"gomonkey/ast"
 	"gomonkey/evaluator"
+	"gomonkey/format"
 	"gomonkey/lexer"
 	"gomonkey/object"
 	"gomonkey/parser"
 	"io"
+	"strings"
 )
 
 const PROMPT = ">> "
@@ -25,21 +27,46 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
+// Start は in から1行ずつ読んで評価する。プロンプトも結果もプログラムの出力(puts とか)も out に書く。
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	StartWithIO(object.NewIO(in, out, out))
+}
+
+// StartWithIO は Start の stderr を分けたい人向け。
+// 評価するプログラムの read_line は、REPL が行を読むのと同じ stdio.Stdin から読む。
+func StartWithIO(stdio *object.IO) {
+	out := stdio.Stdout
 	macroEnv := object.NewEnvironment()
+	macroEnv.SetIO(stdio)
+	// macroexpand() がマクロを探せるように、評価用の環境からもマクロが見えるようにしておく
+	env := object.NewEnclosedEnvironment(macroEnv)
 
 	for {
-		fmt.Print(PROMPT)
+		_, _ = io.WriteString(out, PROMPT)
 
-		scanned := scanner.Scan()
-
-		if !scanned {
+		line, ok := readLine(stdio.Stdin)
+		if !ok {
 			return
 		}
 
-		line := scanner.Text()
+		// `:expand <code>` はマクロを展開した結果を表示するだけで、評価はしない
+		if strings.HasPrefix(line, ":expand ") {
+			printExpanded(out, strings.TrimPrefix(line, ":expand "), macroEnv)
+			continue
+		}
+
+		// `:tokens <code>` はレキサーが出すトークンを表示するだけで、パースも評価もしない
+		if strings.HasPrefix(line, ":tokens ") {
+			_ = lexer.WriteTokens(out, lexer.New(strings.TrimPrefix(line, ":tokens ")).All())
+			continue
+		}
+
+		// `:trace on` / `:trace off` で、評価したノードと結果を stderr に書くかどうかを切り替える
+		if line == ":trace" || strings.HasPrefix(line, ":trace ") {
+			setTrace(out, strings.TrimSpace(strings.TrimPrefix(line, ":trace")), env, stdio.Stderr)
+			continue
+		}
+
 		l := lexer.New(line)
 		p := parser.New(l)
 
@@ -52,7 +79,11 @@ func Start(in io.Reader, out io.Writer) {
 
 		// マクロ展開フェーズ！！！
 		evaluator.DefineMacros(program, macroEnv)
-		expanded := evaluator.ExpandMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			_, _ = io.WriteString(out, "macro expansion error: "+err.Error()+"\n")
+			continue
+		}
 
 		evaluated := evaluator.Eval(expanded, env)
 		if evaluated != nil {
@@ -62,6 +93,38 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
+func printExpanded(out io.Writer, line string, macroEnv *object.Environment) {
+	p := parser.New(lexer.New(line))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return
+	}
+
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		_, _ = io.WriteString(out, "macro expansion error: "+err.Error()+"\n")
+		return
+	}
+
+	_, _ = io.WriteString(out, format.Program(expanded.(*ast.Program)))
+}
+
+func setTrace(out io.Writer, arg string, env *object.Environment, traceOut io.Writer) {
+	switch arg {
+	case "on":
+		env.SetHooks(evaluator.NewTracer(traceOut))
+		_, _ = io.WriteString(out, "trace on\n")
+	case "off":
+		env.SetHooks(nil)
+		_, _ = io.WriteString(out, "trace off\n")
+	default:
+		_, _ = io.WriteString(out, "usage: :trace on|off\n")
+	}
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	_, _ = io.WriteString(out, MONKEY_FACE)
 	_, _ = io.WriteString(out, "Woops! We ran into some monkey business here!\n")
@@ -70,3 +133,15 @@ func printParserErrors(out io.Writer, errors []string) {
 		_, _ = io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+// readLine は1行読んで改行を取って返す。もう読むものがなければ false。
+// bufio.Scanner だと先読みした分を read_line に渡せないので、stdio.Stdin から直接読む。
+func readLine(r *bufio.Reader) (string, bool) {
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		return "", false
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), true
+}
@@ -0,0 +1,74 @@
+package repl_test
+
+import (
+	"bytes"
+	"gomonkey/object"
+	"gomonkey/repl"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	t.Parallel()
+
+	// 2行目の read_line は、REPL が読む行じゃなくて次の行("monkey")を読む
+	in := strings.NewReader("puts(1 + 2)\nlet name = read_line()\nmonkey\nprint(\"hi \", name)\n")
+	var out bytes.Buffer
+
+	repl.Start(in, &out)
+
+	// puts の出力の後に戻り値の NULL、let は何も表示しない
+	expected := ">> 3\nNULL\n>> >> hi monkeyNULL\n>> "
+	if out.String() != expected {
+		t.Errorf("出力が %q じゃないよ。got=%q", expected, out.String())
+	}
+}
+
+func TestStartTrace(t *testing.T) {
+	t.Parallel()
+
+	in := strings.NewReader(":trace on\n1 + 2\n:trace off\n3\n:trace maybe\n")
+	var out, trace bytes.Buffer
+
+	repl.StartWithIO(object.NewIO(in, &out, &trace))
+
+	expected := ">> trace on\n>> 3\n>> trace off\n>> 3\n>> usage: :trace on|off\n>> "
+	if out.String() != expected {
+		t.Errorf("出力が %q じゃないよ。got=%q", expected, out.String())
+	}
+
+	// off にした後の 3 はトレースされない
+	expectedTrace := "env 0       1 => 1\nenv 0       2 => 2\nenv 0     (1 + 2) => 3\n"
+	if trace.String() != expectedTrace {
+		t.Errorf("トレースが %q じゃないよ。got=%q", expectedTrace, trace.String())
+	}
+}
+
+func TestStartExpand(t *testing.T) {
+	t.Parallel()
+
+	in := strings.NewReader("let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };\n" +
+		":expand unless(x > 1, \"small\", \"big\")\n")
+	var out bytes.Buffer
+
+	repl.Start(in, &out)
+
+	expected := ">> >> if (!(x > 1)) {\n\t\"small\";\n} else {\n\t\"big\";\n}\n>> "
+	if out.String() != expected {
+		t.Errorf("出力が %q じゃないよ。got=%q", expected, out.String())
+	}
+}
+
+func TestStartTokens(t *testing.T) {
+	t.Parallel()
+
+	in := strings.NewReader(":tokens x>=1\n")
+	var out bytes.Buffer
+
+	repl.Start(in, &out)
+
+	expected := ">> 1:1  IDENT  \"x\"\n1:2  >      \">\"\n1:3  =      \"=\"\n1:4  INT    \"1\"\n1:5  EOF    \"\"\n>> "
+	if out.String() != expected {
+		t.Errorf("出力が %q じゃないよ。got=%q", expected, out.String())
+	}
+}
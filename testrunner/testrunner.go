@@ -0,0 +1,131 @@
+// Package testrunner は Monkey で書いたテストを動かす。
+// テストはトップレベルで `let test_xxx = fn() { ... };` と定義した引数なしの関数で、
+// 1個ずつ新しい環境でファイルのトップレベルを評価し直してから呼ぶので、テスト同士は影響し合わない。
+// 関数がエラーを返したら失敗(assert とかの組み込み関数は失敗するとエラーを返す)。
+package testrunner
+
+import (
+	"gomonkey/ast"
+	"gomonkey/evaluator"
+	"gomonkey/object"
+	"gomonkey/token"
+	"strings"
+)
+
+// Prefix はテスト関数の名前の頭
+const Prefix = "test_"
+
+// Test はテスト関数1個。Pos は let の位置
+type Test struct {
+	Name string
+	Pos  token.Position
+}
+
+// Result はテスト1個(か、テスト関数のないファイル1個)の結果
+type Result struct {
+	Test
+	Passed  bool
+	Message string         // 失敗したときのエラーメッセージ
+	ErrPos  token.Position // 失敗したときに、エラーになった一番内側の文の位置。わからなければ無効な位置
+}
+
+// Discover は program のトップレベルのテスト関数を、書いた順に返す。program はマクロ展開済みのものを渡す
+func Discover(program *ast.Program) []Test {
+	var tests []Test
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || let.Name == nil || !strings.HasPrefix(let.Name.Value, Prefix) {
+			continue
+		}
+		tests = append(tests, Test{Name: let.Name.Value, Pos: let.Token.Pos})
+	}
+
+	return tests
+}
+
+// Run は test を動かす。base(組み込み関数と IO の入った環境)の中に新しい環境を作って program を評価し、test の関数を引数なしで呼ぶ。
+// hooks はカバレッジとかを一緒に取りたいときに。nil でいい。
+func Run(program *ast.Program, base *object.Environment, test Test, hooks object.EvalHooks) Result {
+	return run(program, base, test, hooks, func(env *object.Environment) object.Object {
+		fn, ok := env.Get(test.Name)
+		if !ok {
+			return &object.Error{Message: test.Name + " is not defined"}
+		}
+		f, ok := fn.(*object.Function)
+		if !ok {
+			return &object.Error{Message: test.Name + " is not a function, got " + string(fn.Type())}
+		}
+		if len(f.Parameters) != 0 {
+			return &object.Error{Message: test.Name + " must take no arguments"}
+		}
+
+		call := &ast.CallExpression{
+			Token:    token.Token{Type: token.LPAREN, Literal: "(", Pos: test.Pos},
+			Function: &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: test.Name, Pos: test.Pos}, Value: test.Name},
+		}
+		return evaluator.Eval(call, env)
+	})
+}
+
+// RunProgram はテスト関数のないファイルを、ただのプログラムとして評価する。エラーで終わったら失敗
+func RunProgram(program *ast.Program, base *object.Environment, hooks object.EvalHooks) Result {
+	return run(program, base, Test{}, hooks, nil)
+}
+
+func run(program *ast.Program, base *object.Environment, test Test, hooks object.EvalHooks, call func(*object.Environment) object.Object) Result {
+	errors := &errorTracker{}
+	env := object.NewEnclosedEnvironment(base)
+	env.SetHooks(object.JoinHooks(errors, hooks))
+
+	result := evaluator.Eval(program, env)
+	if _, isErr := result.(*object.Error); !isErr && call != nil {
+		result = call(env)
+	}
+
+	if errObj, ok := result.(*object.Error); ok {
+		return Result{Test: test, Message: errObj.Message, ErrPos: errors.posOf(errObj)}
+	}
+
+	return Result{Test: test, Passed: true}
+}
+
+// errorTracker はエラーになった一番内側の文の位置を覚えておく。
+// エラーは内側の文から外側へ伝わっていくので、そのエラーで最初に終わった文がそれ。
+// assert_error で捕まえられたエラーもここを通るので、どのエラーの位置なのかも一緒に覚えておく
+type errorTracker struct {
+	err *object.Error
+	pos token.Position
+}
+
+func (e *errorTracker) BeforeEval(node ast.Node, env *object.Environment) {}
+
+func (e *errorTracker) AfterEval(node ast.Node, env *object.Environment, result object.Object) {
+	errObj, isErr := result.(*object.Error)
+	if !isErr || errObj == e.err {
+		return
+	}
+
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		e.err, e.pos = errObj, node.Token.Pos
+	case *ast.ReturnStatement:
+		e.err, e.pos = errObj, node.Token.Pos
+	case *ast.ExpressionStatement:
+		e.err, e.pos = errObj, node.Token.Pos
+	}
+}
+
+// posOf は errObj で終わった一番内側の文の位置を返す。文で起きたエラーじゃなければゼロ値
+func (e *errorTracker) posOf(errObj *object.Error) token.Position {
+	if errObj != e.err {
+		return token.Position{}
+	}
+
+	return e.pos
+}
+
+func (e *errorTracker) EnterFunction(call *ast.CallExpression, fn object.Object, args []object.Object) {
+}
+
+func (e *errorTracker) ExitFunction(call *ast.CallExpression, fn object.Object, result object.Object) {
+}
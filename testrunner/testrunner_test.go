@@ -0,0 +1,137 @@
+package testrunner_test
+
+import (
+	"gomonkey/ast"
+	"gomonkey/lexer"
+	"gomonkey/object"
+	"gomonkey/parser"
+	"gomonkey/testrunner"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("パースエラーだよ: %v", p.Errors())
+	}
+
+	return program
+}
+
+func TestDiscover(t *testing.T) {
+	program := parse(t, `let helper = fn() { 1 };
+let test_one = fn() { assert(true) };
+let testing = 1;
+
+let test_two = fn() { assert(true) };`)
+
+	tests := testrunner.Discover(program)
+
+	expected := []struct {
+		name string
+		line int
+	}{
+		{"test_one", 2},
+		{"test_two", 5},
+	}
+	if len(tests) != len(expected) {
+		t.Fatalf("テストが %d 個じゃないよ。got=%v", len(expected), tests)
+	}
+	for i, tt := range expected {
+		if tests[i].Name != tt.name || tests[i].Pos.Line != tt.line {
+			t.Errorf("%d 番目のテストが %s(%d 行目)じゃないよ。got=%s(%d 行目)", i, tt.name, tt.line, tests[i].Name, tests[i].Pos.Line)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	input := `let double = fn(x) { x * 2 };
+let test_pass = fn() {
+	assert_eq(double(2), 4);
+};
+let test_fail = fn() {
+	let x = double(3);
+	if (x > 0) {
+		assert_eq(x, 7, "double");
+	}
+};
+let test_args = fn(x) { x };
+let test_value = 1;
+let test_error = fn() {
+	1 + true;
+};
+let test_caught = fn() {
+	assert_error(fn() { 1 + true });
+	assert_eq(1, 2);
+};`
+
+	tests := []struct {
+		name    string
+		passed  bool
+		message string
+		errLine int
+	}{
+		{"test_pass", true, "", 0},
+		{"test_fail", false, "assert_eq failed: double\n\tgot:  6\n\twant: 7", 8},
+		{"test_args", false, "test_args must take no arguments", 0},
+		{"test_value", false, "test_value is not a function, got INTEGER", 0},
+		{"test_error", false, "type mismatch: INTEGER + BOOLEAN", 14},
+		// assert_error で捕まえたエラーの行じゃなくて、テストを失敗させたエラーの行
+		{"test_caught", false, "assert_eq failed\n\tgot:  1\n\twant: 2", 18},
+	}
+
+	program := parse(t, input)
+	found := testrunner.Discover(program)
+	if len(found) != len(tests) {
+		t.Fatalf("テストが %d 個じゃないよ。got=%d", len(tests), len(found))
+	}
+
+	for i, tt := range tests {
+		result := testrunner.Run(program, object.NewEnvironment(), found[i], nil)
+		if result.Name != tt.name {
+			t.Fatalf("%d 番目のテストが %s じゃないよ。got=%s", i, tt.name, result.Name)
+		}
+		if result.Passed != tt.passed || result.Message != tt.message || result.ErrPos.Line != tt.errLine {
+			t.Errorf("%s の結果がおかしいよ。got=passed %t, message %q, line %d", tt.name, result.Passed, result.Message, result.ErrPos.Line)
+		}
+	}
+}
+
+func TestRunInFreshEnvironment(t *testing.T) {
+	// テストの中で上書きした名前も、次のテストでは元に戻っている
+	program := parse(t, `let x = 1;
+let test_first = fn() { let x = 2; assert_eq(x, 2) };
+let test_second = fn() { assert_eq(x, 1) };`)
+
+	base := object.NewEnvironment()
+	for _, test := range testrunner.Discover(program) {
+		if result := testrunner.Run(program, base, test, nil); !result.Passed {
+			t.Errorf("%s が失敗したよ: %s", test.Name, result.Message)
+		}
+	}
+
+	if names := base.Names(); len(names) != 0 {
+		t.Errorf("base の環境に名前が入っちゃってるよ。got=%v", names)
+	}
+}
+
+func TestRunProgram(t *testing.T) {
+	tests := []struct {
+		input   string
+		passed  bool
+		errLine int
+	}{
+		{`let x = 1; assert(x == 1);`, true, 0},
+		{"let x = 1;\nassert(x == 2, \"x\");", false, 2},
+	}
+
+	for _, tt := range tests {
+		result := testrunner.RunProgram(parse(t, tt.input), object.NewEnvironment(), nil)
+		if result.Passed != tt.passed || result.ErrPos.Line != tt.errLine {
+			t.Errorf("%q の結果がおかしいよ。got=passed %t, line %d, message %q", tt.input, result.Passed, result.ErrPos.Line, result.Message)
+		}
+	}
+}
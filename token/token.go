@@ -1,10 +1,32 @@
 package token
 
+import "fmt"
+
 type Type string
 
 type Token struct {
 	Type    Type
 	Literal string
+	Pos     Position // トークンの先頭の位置。レキサーを通さずに作ったトークンはゼロ値のまま
+}
+
+// Position はソースコード上の位置。Line も Column も 1 始まりで、Column はバイト単位で数える。
+type Position struct {
+	Line   int
+	Column int
+}
+
+// IsValid はレキサーが付けた位置かどうか。ゼロ値(評価器がその場で作ったノードとか)は無効。
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -21,6 +43,7 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 
 	LT = "<"
 	GT = ">"
@@ -48,6 +71,18 @@ const (
 	RETURN   = "RETURN"
 
 	MACRO = "MACRO"
+
+	// quote(...) と unquote(...) は関数呼び出しじゃなくて専用の構文
+	QUOTE            = "QUOTE"
+	UNQUOTE          = "UNQUOTE"
+	UNQUOTE_SPLICING = "UNQUOTE_SPLICING"
+
+	NULL = "NULL"
+
+	// quote/unquote の略記。パーサーが quote(...) や unquote(...) と同じノードにする
+	BACKQUOTE = "`"  // `(<expression>) は quote(<expression>)
+	TILDE     = "~"  // ~x は unquote(x)
+	TILDE_AT  = "~@" // ~@xs は unquote_splicing(xs)
 )
 
 var keywords = map[string]Type{
@@ -59,6 +94,12 @@ var keywords = map[string]Type{
 	"else":   ELSE,
 	"return": RETURN,
 	"macro":  MACRO,
+
+	"quote":            QUOTE,
+	"unquote":          UNQUOTE,
+	"unquote_splicing": UNQUOTE_SPLICING,
+
+	"null": NULL,
 }
 
 func LookupIdent(ident string) Type {